@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"batch_download_videos/indexer"
+)
+
+// runImportArchive 执行 import-archive 子命令：把 yt-dlp 下载存档中的视频导入索引
+func runImportArchive(idx *indexer.Indexer, args []string) error {
+	flags := flag.NewFlagSet("import-archive", flag.ContinueOnError)
+	audio := flags.Bool("audio", false, "作为音频模式的下载记录导入")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		return fmt.Errorf("请指定下载存档文件，例如: import-archive Output/youtube/downloaded_archive.txt")
+	}
+
+	total := 0
+	for _, path := range flags.Args() {
+		imported, err := idx.ImportArchive(path, *audio)
+		if err != nil {
+			return fmt.Errorf("导入 %s 失败: %w", path, err)
+		}
+		fmt.Printf("%s: 导入 %d 条记录\n", path, imported)
+		total += imported
+	}
+
+	if err := idx.Save(); err != nil {
+		return fmt.Errorf("保存索引失败: %w", err)
+	}
+	fmt.Printf("共导入 %d 条记录，索引中共有 %d 条记录\n", total, idx.GetCount())
+	return nil
+}
+
+// runExportArchive 执行 export-archive 子命令：把索引导出为 yt-dlp 下载存档
+func runExportArchive(idx *indexer.Indexer, args []string) error {
+	flags := flag.NewFlagSet("export-archive", flag.ContinueOnError)
+	platform := flags.String("platform", "", "只导出指定平台的记录，例如 youtube")
+	audio := flags.Bool("audio", false, "导出音频模式的下载记录")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("请指定一个下载存档文件，例如: export-archive -platform youtube Output/youtube/downloaded_archive.txt")
+	}
+
+	path := flags.Arg(0)
+	exported, err := idx.ExportArchive(path, *platform, *audio)
+	if err != nil {
+		return fmt.Errorf("导出 %s 失败: %w", path, err)
+	}
+	fmt.Printf("%s: 新增 %d 条记录\n", path, exported)
+	return nil
+}
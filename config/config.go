@@ -5,61 +5,120 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"time"
+
+	"batch_download_videos/utils"
 )
 
 type Config struct {
-	BatchSize              int               `json:"batch_size"`
-	MaxConcurrency         int               `json:"max_concurrency"`
-	TimeoutPerVideo        time.Duration     `json:"timeout_per_video"`
-	MaxRetries             int               `json:"max_retries"`
-	BaseRetryDelay         time.Duration     `json:"base_retry_delay"`
-	DefaultOutputDir       string            `json:"default_output_dir"`
-	PlatformOutputDirs     map[string]string `json:"platform_output_dirs"`
-	ResourceUrlsDir        string            `json:"resource_urls_dir"`
-	CookieFile             string            `json:"cookie_file"`
-	IndexFile              string            `json:"index_file"`
-	RecordFile             string            `json:"record_file"`
-	DefaultResolution      string            `json:"default_resolution"`
-	DefaultDownloader      string            `json:"default_downloader"`
-	GenerateMetaFile       bool              `json:"generate_meta_file"`
-	OutputTemplate         string            `json:"output_template"`
-	FilenameMaxLength      int               `json:"filename_max_length"`
-	RecodeVideo            string            `json:"recode_video"`
-	MaxConcurrentDownloads int               `json:"max_concurrent_downloads"`
-	Proxy                  string            `json:"proxy"`
-	LimitRate              string            `json:"limit_rate"`
-	FfmpegPath             string            `json:"ffmpeg_path"`
+	BatchSize              int                    `json:"batch_size"`
+	MaxConcurrency         int                    `json:"max_concurrency"`
+	TimeoutPerVideo        time.Duration          `json:"timeout_per_video"`
+	MaxRetries             int                    `json:"max_retries"`
+	BaseRetryDelay         time.Duration          `json:"base_retry_delay"`
+	DefaultOutputDir       string                 `json:"default_output_dir"`
+	PlatformOutputDirs     map[string]string      `json:"platform_output_dirs"`
+	ResourceUrlsDir        string                 `json:"resource_urls_dir"`
+	CookieFile             string                 `json:"cookie_file"`
+	IndexFile              string                 `json:"index_file"`
+	RecordFile             string                 `json:"record_file"`
+	DefaultResolution      string                 `json:"default_resolution"`
+	DefaultDownloader      string                 `json:"default_downloader"`
+	GenerateMetaFile       bool                   `json:"generate_meta_file"`
+	OutputTemplate         string                 `json:"output_template"`
+	FilenameMaxLength      int                    `json:"filename_max_length"`
+	RecodeVideo            string                 `json:"recode_video"`
+	MaxConcurrentDownloads int                    `json:"max_concurrent_downloads"`
+	Proxy                  string                 `json:"proxy"`
+	LimitRate              string                 `json:"limit_rate"`
+	FfmpegPath             string                 `json:"ffmpeg_path"`
+	TaskFile               string                 `json:"task_file"`
+	DownloadSegments       int                    `json:"download_segments"`
+	PreferredCodecs        []string               `json:"preferred_codecs"`
+	PreferredContainers    []string               `json:"preferred_containers"`
+	MaxBitrate             int                    `json:"max_bitrate"`
+	AudioFormat            string                 `json:"audio_format"`
+	AudioBitrate           string                 `json:"audio_bitrate"`
+	SubtitleLangs          []string               `json:"subtitle_langs"`
+	SubtitleFormat         string                 `json:"subtitle_format"`
+	AutoSubtitles          bool                   `json:"auto_subtitles"`
+	EmbedSubtitles         bool                   `json:"embed_subtitles"`
+	WriteThumbnail         bool                   `json:"write_thumbnail"`
+	EmbedThumbnail         bool                   `json:"embed_thumbnail"`
+	StorageBackend         string                 `json:"storage_backend"`
+	DatabaseFile           string                 `json:"database_file"`
+	RoutingRules           []RoutingRule          `json:"routing_rules"`
+	PlaylistStart          int                    `json:"playlist_start"`
+	PlaylistEnd            int                    `json:"playlist_end"`
+	PlaylistMaxItems       int                    `json:"playlist_max_items"`
+	ChannelMaxItems        int                    `json:"channel_max_items"`
+	PlaylistOrder          string                 `json:"playlist_order"`
+	DateAfter              string                 `json:"date_after"`
+	DateBefore             string                 `json:"date_before"`
+	StopAtIndexed          bool                   `json:"stop_at_indexed"`
+	RetryPolicies          map[string]RetryPolicy `json:"retry_policies"`
+	DeadLetterFile         string                 `json:"dead_letter_file"`
+	ReportFiles            []string               `json:"report_files"`
 }
 
 // ConfigJSON 用于JSON序列化和反序列化的辅助结构体
 type ConfigJSON struct {
-	BatchSize              int               `json:"batch_size"`
-	MaxConcurrency         int               `json:"max_concurrency"`
-	TimeoutPerVideo        string            `json:"timeout_per_video"`
-	MaxRetries             int               `json:"max_retries"`
-	BaseRetryDelay         string            `json:"base_retry_delay"`
-	DefaultOutputDir       string            `json:"default_output_dir"`
-	PlatformOutputDirs     map[string]string `json:"platform_output_dirs"`
-	ResourceUrlsDir        string            `json:"resource_urls_dir"`
-	CookieFile             string            `json:"cookie_file"`
-	IndexFile              string            `json:"index_file"`
-	RecordFile             string            `json:"record_file"`
-	DefaultResolution      string            `json:"default_resolution"`
-	DefaultDownloader      string            `json:"default_downloader"`
-	GenerateMetaFile       bool              `json:"generate_meta_file"`
-	OutputTemplate         string            `json:"output_template"`
-	FilenameMaxLength      int               `json:"filename_max_length"`
-	RecodeVideo            string            `json:"recode_video"`
-	MaxConcurrentDownloads int               `json:"max_concurrent_downloads"`
-	Proxy                  string            `json:"proxy"`
-	LimitRate              string            `json:"limit_rate"`
-	FfmpegPath             string            `json:"ffmpeg_path"`
+	BatchSize              int                    `json:"batch_size"`
+	MaxConcurrency         int                    `json:"max_concurrency"`
+	TimeoutPerVideo        string                 `json:"timeout_per_video"`
+	MaxRetries             int                    `json:"max_retries"`
+	BaseRetryDelay         string                 `json:"base_retry_delay"`
+	DefaultOutputDir       string                 `json:"default_output_dir"`
+	PlatformOutputDirs     map[string]string      `json:"platform_output_dirs"`
+	ResourceUrlsDir        string                 `json:"resource_urls_dir"`
+	CookieFile             string                 `json:"cookie_file"`
+	IndexFile              string                 `json:"index_file"`
+	RecordFile             string                 `json:"record_file"`
+	DefaultResolution      string                 `json:"default_resolution"`
+	DefaultDownloader      string                 `json:"default_downloader"`
+	GenerateMetaFile       bool                   `json:"generate_meta_file"`
+	OutputTemplate         string                 `json:"output_template"`
+	FilenameMaxLength      int                    `json:"filename_max_length"`
+	RecodeVideo            string                 `json:"recode_video"`
+	MaxConcurrentDownloads int                    `json:"max_concurrent_downloads"`
+	Proxy                  string                 `json:"proxy"`
+	LimitRate              string                 `json:"limit_rate"`
+	FfmpegPath             string                 `json:"ffmpeg_path"`
+	TaskFile               string                 `json:"task_file"`
+	DownloadSegments       int                    `json:"download_segments"`
+	PreferredCodecs        []string               `json:"preferred_codecs"`
+	PreferredContainers    []string               `json:"preferred_containers"`
+	MaxBitrate             int                    `json:"max_bitrate"`
+	AudioFormat            string                 `json:"audio_format"`
+	AudioBitrate           string                 `json:"audio_bitrate"`
+	SubtitleLangs          []string               `json:"subtitle_langs"`
+	SubtitleFormat         string                 `json:"subtitle_format"`
+	AutoSubtitles          bool                   `json:"auto_subtitles"`
+	EmbedSubtitles         bool                   `json:"embed_subtitles"`
+	WriteThumbnail         bool                   `json:"write_thumbnail"`
+	EmbedThumbnail         bool                   `json:"embed_thumbnail"`
+	StorageBackend         string                 `json:"storage_backend"`
+	DatabaseFile           string                 `json:"database_file"`
+	RoutingRules           []RoutingRule          `json:"routing_rules"`
+	PlaylistStart          int                    `json:"playlist_start"`
+	PlaylistEnd            int                    `json:"playlist_end"`
+	PlaylistMaxItems       int                    `json:"playlist_max_items"`
+	ChannelMaxItems        int                    `json:"channel_max_items"`
+	PlaylistOrder          string                 `json:"playlist_order"`
+	DateAfter              string                 `json:"date_after"`
+	DateBefore             string                 `json:"date_before"`
+	StopAtIndexed          bool                   `json:"stop_at_indexed"`
+	RetryPolicies          map[string]RetryPolicy `json:"retry_policies"`
+	DeadLetterFile         string                 `json:"dead_letter_file"`
+	ReportFiles            []string               `json:"report_files"`
 }
 
 // UnmarshalJSON 实现自定义JSON反序列化方法
 func (c *Config) UnmarshalJSON(data []byte) error {
-	var jsonCfg ConfigJSON
+	// 以当前值为基础解析，配置文件中缺省的字段保留原有（默认）值
+	jsonCfg := c.toConfigJSON()
 	if err := json.Unmarshal(data, &jsonCfg); err != nil {
 		return err
 	}
@@ -84,6 +143,33 @@ func (c *Config) UnmarshalJSON(data []byte) error {
 	c.Proxy = jsonCfg.Proxy
 	c.LimitRate = jsonCfg.LimitRate
 	c.FfmpegPath = jsonCfg.FfmpegPath
+	c.TaskFile = jsonCfg.TaskFile
+	c.DownloadSegments = jsonCfg.DownloadSegments
+	c.PreferredCodecs = jsonCfg.PreferredCodecs
+	c.PreferredContainers = jsonCfg.PreferredContainers
+	c.MaxBitrate = jsonCfg.MaxBitrate
+	c.AudioFormat = jsonCfg.AudioFormat
+	c.AudioBitrate = jsonCfg.AudioBitrate
+	c.SubtitleLangs = jsonCfg.SubtitleLangs
+	c.SubtitleFormat = jsonCfg.SubtitleFormat
+	c.AutoSubtitles = jsonCfg.AutoSubtitles
+	c.EmbedSubtitles = jsonCfg.EmbedSubtitles
+	c.WriteThumbnail = jsonCfg.WriteThumbnail
+	c.EmbedThumbnail = jsonCfg.EmbedThumbnail
+	c.StorageBackend = jsonCfg.StorageBackend
+	c.DatabaseFile = jsonCfg.DatabaseFile
+	c.RoutingRules = jsonCfg.RoutingRules
+	c.PlaylistStart = jsonCfg.PlaylistStart
+	c.PlaylistEnd = jsonCfg.PlaylistEnd
+	c.PlaylistMaxItems = jsonCfg.PlaylistMaxItems
+	c.ChannelMaxItems = jsonCfg.ChannelMaxItems
+	c.PlaylistOrder = jsonCfg.PlaylistOrder
+	c.DateAfter = jsonCfg.DateAfter
+	c.DateBefore = jsonCfg.DateBefore
+	c.StopAtIndexed = jsonCfg.StopAtIndexed
+	c.RetryPolicies = jsonCfg.RetryPolicies
+	c.DeadLetterFile = jsonCfg.DeadLetterFile
+	c.ReportFiles = jsonCfg.ReportFiles
 
 	// 解析时间字段
 	var err error
@@ -101,12 +187,23 @@ func (c *Config) UnmarshalJSON(data []byte) error {
 		}
 	}
 
+	for name, policy := range c.RetryPolicies {
+		if err := policy.Validate(); err != nil {
+			return fmt.Errorf("重试策略 %s 无效: %w", name, err)
+		}
+	}
+
 	return nil
 }
 
 // MarshalJSON 实现自定义JSON序列化方法
 func (c *Config) MarshalJSON() ([]byte, error) {
-	jsonCfg := ConfigJSON{
+	return json.MarshalIndent(c.toConfigJSON(), "", "  ")
+}
+
+// toConfigJSON 转换为用于JSON序列化的辅助结构体
+func (c *Config) toConfigJSON() ConfigJSON {
+	return ConfigJSON{
 		BatchSize:              c.BatchSize,
 		MaxConcurrency:         c.MaxConcurrency,
 		TimeoutPerVideo:        c.TimeoutPerVideo.String(),
@@ -128,9 +225,121 @@ func (c *Config) MarshalJSON() ([]byte, error) {
 		Proxy:                  c.Proxy,
 		LimitRate:              c.LimitRate,
 		FfmpegPath:             c.FfmpegPath,
+		TaskFile:               c.TaskFile,
+		DownloadSegments:       c.DownloadSegments,
+		PreferredCodecs:        c.PreferredCodecs,
+		PreferredContainers:    c.PreferredContainers,
+		MaxBitrate:             c.MaxBitrate,
+		AudioFormat:            c.AudioFormat,
+		AudioBitrate:           c.AudioBitrate,
+		SubtitleLangs:          c.SubtitleLangs,
+		SubtitleFormat:         c.SubtitleFormat,
+		AutoSubtitles:          c.AutoSubtitles,
+		EmbedSubtitles:         c.EmbedSubtitles,
+		WriteThumbnail:         c.WriteThumbnail,
+		EmbedThumbnail:         c.EmbedThumbnail,
+		StorageBackend:         c.StorageBackend,
+		DatabaseFile:           c.DatabaseFile,
+		RoutingRules:           c.RoutingRules,
+		PlaylistStart:          c.PlaylistStart,
+		PlaylistEnd:            c.PlaylistEnd,
+		PlaylistMaxItems:       c.PlaylistMaxItems,
+		ChannelMaxItems:        c.ChannelMaxItems,
+		PlaylistOrder:          c.PlaylistOrder,
+		DateAfter:              c.DateAfter,
+		DateBefore:             c.DateBefore,
+		StopAtIndexed:          c.StopAtIndexed,
+		RetryPolicies:          c.RetryPolicies,
+		DeadLetterFile:         c.DeadLetterFile,
+		ReportFiles:            c.ReportFiles,
+	}
+}
+
+// RoutingRule 智能下载器（auto）的路由规则：匹配的URL依次尝试 Downloaders 中的下载器，
+// 前一个下载器失败（不包括已下载跳过）时自动使用下一个
+// Platform、Kinds、Pattern 都为空的规则匹配所有URL
+type RoutingRule struct {
+	// Platform 平台名称，例如 youtube、bilibili，为空时不限制
+	Platform string `json:"platform,omitempty"`
+	// Kinds 内容类型 video/short/live/playlist/channel，为空时不限制
+	Kinds []string `json:"kinds,omitempty"`
+	// Pattern 匹配完整URL的正则表达式，为空时不限制
+	Pattern string `json:"pattern,omitempty"`
+	// Downloaders 按顺序尝试的下载器：youtube 或 multi
+	Downloaders []string `json:"downloaders"`
+}
+
+// DefaultRoutingRules 默认路由规则：YouTube 单个视频和 Shorts 先用 YouTube 专用下载器，失败后用 yt-dlp；
+// 没有匹配规则的URL使用多平台下载器
+func DefaultRoutingRules() []RoutingRule {
+	return []RoutingRule{
+		{Platform: "youtube", Kinds: []string{"video", "short"}, Downloaders: []string{"youtube", "multi"}},
+	}
+}
+
+// RetryPolicy 一个下载路径的重试策略，retry_policies 中的键为 youtube、yt-dlp、douyin 或 task；
+// 配置了某个路径的策略时整个策略替换默认值，缺省的字段使用通用默认值
+type RetryPolicy struct {
+	// MaxAttempts 最多尝试次数（包括第一次），为 0 时使用 max_retries
+	MaxAttempts int `json:"max_attempts,omitempty"`
+	// Backoff 退避曲线：exponential（每次翻倍，默认）、linear（按次数递增）或 constant（固定）
+	Backoff string `json:"backoff,omitempty"`
+	// BaseDelay 第一次重试前的等待时间，为空时使用 base_retry_delay
+	BaseDelay string `json:"base_delay,omitempty"`
+	// MaxDelay 等待时间上限，为空时不限制
+	MaxDelay string `json:"max_delay,omitempty"`
+	// Jitter 随机抖动比例，例如 0.2 表示等待时间在 ±20% 范围内浮动
+	Jitter float64 `json:"jitter,omitempty"`
+	// MaxRetryAfter HTTP 429 响应的 Retry-After 超过此值时不再重试，为空时为 5 分钟
+	MaxRetryAfter string `json:"max_retry_after,omitempty"`
+	// RetryOn 需要重试的错误类别，为空时重试 rate_limited、network 和 unknown
+	RetryOn []string `json:"retry_on,omitempty"`
+}
+
+// RetryErrorClasses retry_on 中可用的错误类别，与 downloader.ErrorClassName 返回的名称一致
+var RetryErrorClasses = []string{
+	"geo_blocked", "login_required", "unavailable", "rate_limited",
+	"format_unavailable", "network", "tool_missing", "unknown",
+}
+
+// Validate 检查退避曲线、时间和错误类别是否有效
+func (p RetryPolicy) Validate() error {
+	switch p.Backoff {
+	case "", "exponential", "linear", "constant":
+	default:
+		return fmt.Errorf("未知的退避曲线: %s", p.Backoff)
+	}
+	if p.MaxAttempts < 0 {
+		return fmt.Errorf("max_attempts 不能为负数: %d", p.MaxAttempts)
+	}
+	if p.Jitter < 0 || p.Jitter >= 1 {
+		return fmt.Errorf("jitter 应在 0 到 1 之间: %v", p.Jitter)
+	}
+	for _, value := range []string{p.BaseDelay, p.MaxDelay, p.MaxRetryAfter} {
+		if value == "" {
+			continue
+		}
+		if _, err := time.ParseDuration(value); err != nil {
+			return fmt.Errorf("解析时间 %q 失败: %w", value, err)
+		}
+	}
+	for _, class := range p.RetryOn {
+		if !slices.Contains(RetryErrorClasses, class) {
+			return fmt.Errorf("未知的错误类别: %s", class)
+		}
 	}
+	return nil
+}
 
-	return json.MarshalIndent(jsonCfg, "", "  ")
+// DefaultRetryPolicies 默认重试策略：YouTube 专用下载器使用带抖动的指数退避，
+// yt-dlp 和抖音下载按次数线性增加等待时间，任务失败后不再整体重试
+func DefaultRetryPolicies() map[string]RetryPolicy {
+	return map[string]RetryPolicy{
+		"youtube": {Backoff: "exponential", MaxDelay: "30s", Jitter: 0.2},
+		"yt-dlp":  {Backoff: "linear"},
+		"douyin":  {Backoff: "linear"},
+		"task":    {MaxAttempts: 1},
+	}
 }
 
 func DefaultConfig() *Config {
@@ -162,6 +371,33 @@ func DefaultConfig() *Config {
 		Proxy:                  "",
 		LimitRate:              "",
 		FfmpegPath:             "./deps/ffmpeg.exe",
+		TaskFile:               ".download_tasks.json",
+		DownloadSegments:       4,
+		PreferredCodecs:        []string{},
+		PreferredContainers:    []string{},
+		MaxBitrate:             0,
+		AudioFormat:            "",
+		AudioBitrate:           "",
+		SubtitleLangs:          []string{},
+		SubtitleFormat:         "srt",
+		AutoSubtitles:          true,
+		EmbedSubtitles:         false,
+		WriteThumbnail:         true,
+		EmbedThumbnail:         false,
+		StorageBackend:         "file",
+		DatabaseFile:           "downloads.db",
+		RoutingRules:           DefaultRoutingRules(),
+		PlaylistStart:          0,
+		PlaylistEnd:            0,
+		PlaylistMaxItems:       0,
+		ChannelMaxItems:        10,
+		PlaylistOrder:          "",
+		DateAfter:              "",
+		DateBefore:             "",
+		StopAtIndexed:          false,
+		RetryPolicies:          DefaultRetryPolicies(),
+		DeadLetterFile:         "failed_downloads.json",
+		ReportFiles:            []string{},
 	}
 }
 
@@ -223,7 +459,13 @@ func (c *Config) GetOutputDir(baseDir string) string {
 }
 
 // GetPlatformOutputDir 根据平台获取对应的输出目录
+// platform 也可以是视频URL，此时按平台匹配规则（utils.MatchURL）识别平台
 func (c *Config) GetPlatformOutputDir(platform string) string {
+	if strings.Contains(platform, "://") {
+		platform = utils.GetWebsiteType(platform)
+	}
+	platform = strings.ToLower(platform)
+
 	// 如果PlatformOutputDirs不为空且包含该平台的配置，返回对应的目录
 	if c.PlatformOutputDirs != nil {
 		if dir, ok := c.PlatformOutputDirs[platform]; ok {
@@ -237,3 +479,8 @@ func (c *Config) GetPlatformOutputDir(platform string) string {
 	// 否则返回默认输出目录
 	return c.DefaultOutputDir
 }
+
+// GetPlatformAudioDir 获取平台的音频输出目录（平台输出目录下的 audio 子目录）
+func (c *Config) GetPlatformAudioDir(platform string) string {
+	return filepath.Join(c.GetPlatformOutputDir(platform), "audio")
+}
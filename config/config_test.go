@@ -66,8 +66,8 @@ func TestLoadConfig(t *testing.T) {
 		t.Errorf("DefaultOutputDir = %q, want %q", cfg.DefaultOutputDir, "TestOutput")
 	}
 
-	if cfg.ResourceURLsDir != "test_urls" {
-		t.Errorf("ResourceURLsDir = %q, want %q", cfg.ResourceURLsDir, "test_urls")
+	if cfg.ResourceUrlsDir != "test_urls" {
+		t.Errorf("ResourceUrlsDir = %q, want %q", cfg.ResourceUrlsDir, "test_urls")
 	}
 
 	if cfg.CookieFile != "test_cookies.txt" {
@@ -120,11 +120,17 @@ func TestLoadConfig(t *testing.T) {
 }
 
 func TestLoadConfigNonExistent(t *testing.T) {
-	cfg, err := LoadConfig("non_existent_config.json")
+	configFile := filepath.Join(t.TempDir(), "non_existent_config.json")
+	cfg, err := LoadConfig(configFile)
 	if err != nil {
 		t.Fatalf("LoadConfig() should not fail for non-existent file: %v", err)
 	}
 
+	// 配置文件不存在时写入默认配置
+	if _, err := os.Stat(configFile); err != nil {
+		t.Errorf("LoadConfig() did not save the default config: %v", err)
+	}
+
 	// Check if default values are set
 	if cfg.BatchSize != 10 {
 		t.Errorf("Default BatchSize = %d, want 10", cfg.BatchSize)
@@ -150,7 +156,7 @@ func TestSaveConfig(t *testing.T) {
 		MaxRetries:             3,
 		BaseRetryDelay:         2 * time.Second,
 		DefaultOutputDir:       "Output",
-		ResourceURLsDir:        "resource_urls",
+		ResourceUrlsDir:        "resource_urls",
 		CookieFile:             "cookies.txt",
 		IndexFile:              ".video_downloaded.index",
 		RecordFile:             "下载记录.md",
@@ -206,3 +212,70 @@ func TestGetOutputDir(t *testing.T) {
 		t.Errorf("GetOutputDir() with baseDir = %q, want %q", outputDir, "subdir")
 	}
 }
+
+func TestLoadConfigKeepsDefaultsForMissingFields(t *testing.T) {
+	tempDir := t.TempDir()
+	configFile := filepath.Join(tempDir, "config.json")
+
+	if err := os.WriteFile(configFile, []byte(`{"max_retries": 5}`), 0644); err != nil {
+		t.Fatalf("Failed to write test config file: %v", err)
+	}
+
+	cfg, err := LoadConfig(configFile)
+	if err != nil {
+		t.Fatalf("LoadConfig() failed: %v", err)
+	}
+
+	if cfg.MaxRetries != 5 {
+		t.Errorf("MaxRetries = %d, want 5", cfg.MaxRetries)
+	}
+
+	if cfg.TaskFile != ".download_tasks.json" {
+		t.Errorf("TaskFile = %q, want default %q", cfg.TaskFile, ".download_tasks.json")
+	}
+
+	if cfg.TimeoutPerVideo != 60*time.Minute {
+		t.Errorf("TimeoutPerVideo = %v, want default 1h0m0s", cfg.TimeoutPerVideo)
+	}
+
+	if len(cfg.RoutingRules) != 1 || cfg.RoutingRules[0].Platform != "youtube" || len(cfg.RoutingRules[0].Downloaders) != 2 {
+		t.Errorf("RoutingRules = %+v, want default youtube rule", cfg.RoutingRules)
+	}
+
+	if cfg.ChannelMaxItems != 10 || cfg.PlaylistMaxItems != 0 {
+		t.Errorf("ChannelMaxItems = %d, PlaylistMaxItems = %d, want defaults 10, 0", cfg.ChannelMaxItems, cfg.PlaylistMaxItems)
+	}
+}
+
+func TestLoadConfigRetryPolicies(t *testing.T) {
+	tempDir := t.TempDir()
+	configFile := filepath.Join(tempDir, "config.json")
+
+	content := `{"retry_policies": {"youtube": {"max_attempts": 5, "backoff": "linear", "retry_on": ["network"]}}}`
+	if err := os.WriteFile(configFile, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write test config file: %v", err)
+	}
+	cfg, err := LoadConfig(configFile)
+	if err != nil {
+		t.Fatalf("LoadConfig() failed: %v", err)
+	}
+	if policy := cfg.RetryPolicies["youtube"]; policy.MaxAttempts != 5 || policy.Backoff != "linear" || policy.MaxDelay != "" {
+		t.Errorf("RetryPolicies[youtube] = %+v, want configured policy replacing the default", policy)
+	}
+	if policy := cfg.RetryPolicies["task"]; policy.MaxAttempts != 1 {
+		t.Errorf("RetryPolicies[task] = %+v, want default", policy)
+	}
+
+	for _, content := range []string{
+		`{"retry_policies": {"task": {"backoff": "fibonacci"}}}`,
+		`{"retry_policies": {"task": {"base_delay": "soon"}}}`,
+		`{"retry_policies": {"task": {"retry_on": ["everything"]}}}`,
+	} {
+		if err := os.WriteFile(configFile, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write test config file: %v", err)
+		}
+		if _, err := LoadConfig(configFile); err == nil {
+			t.Errorf("LoadConfig(%s) succeeded, want error", content)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package downloader
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// ytDlpCommand 创建与 ctx 绑定的 yt-dlp 命令，ctx 取消时子进程会被结束
+func ytDlpCommand(ctx context.Context, ytDlpPath string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, ytDlpPath, args...)
+	// 进程被结束后最多再等待输出管道 5 秒，避免孙进程占用管道导致 Wait 卡住
+	cmd.WaitDelay = 5 * time.Second
+	return cmd
+}
+
+// isPartialFile 判断文件名是否为下载过程中的临时文件
+func isPartialFile(name string) bool {
+	return strings.HasSuffix(name, ".part") ||
+		strings.HasSuffix(name, ".ytdl") ||
+		strings.Contains(name, ".part-Frag")
+}
@@ -0,0 +1,180 @@
+package downloader
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// ytDlpItemPrefix yt-dlp 输出单个视频下载结果的行前缀，用于与其他输出区分
+const ytDlpItemPrefix = "[batch-item]"
+
+var (
+	// ytDlpArchivedPattern yt-dlp 跳过下载存档中已有视频时的输出，只包含视频标题（没有标题时为视频ID）
+	ytDlpArchivedPattern = regexp.MustCompile(`^\[download\] (.+) has already been recorded in the archive`)
+	// ytDlpErrorPattern yt-dlp 单个视频下载失败时的错误输出，例如 "ERROR: [youtube] VIDEO_ID: Video unavailable"
+	ytDlpErrorPattern = regexp.MustCompile(`^ERROR: \[[^\]]+\] ([^\s:]+): (.+)$`)
+)
+
+// ytDlpItemArgs 让 yt-dlp 在每个视频下载并移动到最终位置后输出视频ID、URL、文件路径和标题
+// 使用 --print 时 yt-dlp 进入静默模式，--no-quiet 保留原有的控制台输出，以便识别跳过的视频
+func ytDlpItemArgs() []string {
+	return []string{
+		"--no-quiet",
+		"--print", "after_move:" + ytDlpItemPrefix + "%(id)s\t%(webpage_url)s\t%(filepath)s\t%(title)s",
+	}
+}
+
+// collectionItem 频道/播放列表中一个视频的下载结果
+type collectionItem struct {
+	result    *DownloadResult
+	sourceURL string
+}
+
+// collectionResults 从 yt-dlp 的输出中收集频道/播放列表中每个视频的下载结果
+type collectionResults struct {
+	mutex sync.Mutex
+	items []*collectionItem
+	// byID 按视频ID查找结果，同一视频先失败后成功时以成功为准
+	byID map[string]*collectionItem
+	// stderrLines 最近的错误输出，没有识别出失败的视频时用于判断错误类别
+	stderrLines []string
+}
+
+// maxStderrLines collectionResults 保留的错误输出行数
+const maxStderrLines = 20
+
+func newCollectionResults() *collectionResults {
+	return &collectionResults{byID: make(map[string]*collectionItem)}
+}
+
+// handleStdout 处理一行标准输出，返回是否为下载结果行（不需要再打印）
+func (c *collectionResults) handleStdout(line string) bool {
+	line = strings.TrimSpace(line)
+	if fields, ok := strings.CutPrefix(line, ytDlpItemPrefix); ok {
+		parts := strings.SplitN(fields, "\t", 4)
+		if len(parts) < 3 || parts[0] == "" {
+			return true
+		}
+		result := &DownloadResult{Success: true, VideoID: parts[0], FilePath: parts[2]}
+		if len(parts) == 4 && parts[3] != "NA" {
+			result.Title = parts[3]
+		}
+		if info, err := os.Stat(result.FilePath); err == nil {
+			result.FileSize = info.Size()
+		}
+		sourceURL := parts[1]
+		if sourceURL == "NA" {
+			sourceURL = ""
+		}
+		c.add(&collectionItem{result: result, sourceURL: sourceURL})
+		return true
+	}
+
+	if match := ytDlpArchivedPattern.FindStringSubmatch(line); match != nil {
+		c.add(&collectionItem{result: alreadyDownloaded("", match[1])})
+	}
+	return false
+}
+
+// handleStderr 处理一行错误输出，记录下载失败的视频
+func (c *collectionResults) handleStderr(line string) {
+	line = strings.TrimSpace(line)
+	c.mutex.Lock()
+	c.stderrLines = append(c.stderrLines, line)
+	if len(c.stderrLines) > maxStderrLines {
+		c.stderrLines = c.stderrLines[1:]
+	}
+	c.mutex.Unlock()
+
+	match := ytDlpErrorPattern.FindStringSubmatch(line)
+	if match == nil {
+		return
+	}
+	err := &DownloadError{Class: classifyYtDlpOutput(match[2]), Err: errors.New(match[2])}
+	c.add(&collectionItem{result: &DownloadResult{VideoID: match[1], Error: err}})
+}
+
+// stderr 返回最近的错误输出
+func (c *collectionResults) stderr() string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return strings.Join(c.stderrLines, "\n")
+}
+
+func (c *collectionResults) add(item *collectionItem) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	id := item.result.VideoID
+	if id == "" {
+		c.items = append(c.items, item)
+		return
+	}
+	if existing, ok := c.byID[id]; ok {
+		if item.result.Success || !existing.result.Success {
+			*existing = *item
+		}
+		return
+	}
+	c.byID[id] = item
+	c.items = append(c.items, item)
+}
+
+// list 返回按输出顺序排列的结果
+func (c *collectionResults) list() []*collectionItem {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return append([]*collectionItem(nil), c.items...)
+}
+
+// summarizeItems 统计成功、跳过和失败的视频数以及成功下载的总大小
+func summarizeItems(items []*DownloadResult) (succeeded, skipped, failed int, size int64) {
+	for _, item := range items {
+		switch {
+		case item.Success:
+			succeeded++
+			size += item.FileSize
+		case isSkipped(item):
+			skipped++
+		default:
+			failed++
+		}
+	}
+	return succeeded, skipped, failed, size
+}
+
+// collectionError 频道/播放列表中有视频下载失败时的错误，errors.Is 可以匹配每个失败视频的错误，
+// 因此按错误类别判断是否重试时，失败的视频中有不可重试的错误（例如视频不可用）时整个频道/播放列表也不重试
+type collectionError struct {
+	failed, total int
+	errs          []error
+}
+
+// newCollectionError 根据每个视频的结果返回频道/播放列表的错误
+func newCollectionError(items []*DownloadResult) error {
+	err := &collectionError{total: len(items)}
+	for _, item := range items {
+		if item.Success || isSkipped(item) {
+			continue
+		}
+		err.failed++
+		if item.Error != nil {
+			err.errs = append(err.errs, item.Error)
+		}
+	}
+	return err
+}
+
+func (e *collectionError) Error() string {
+	return fmt.Sprintf("频道/播放列表中 %d/%d 个视频下载失败", e.failed, e.total)
+}
+
+func (e *collectionError) Unwrap() []error {
+	return e.errs
+}
@@ -0,0 +1,81 @@
+package downloader
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCollectionResults(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "First_abc123.mp4")
+	if err := os.WriteFile(file, []byte("video data"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	items := newCollectionResults()
+	lines := []struct {
+		line     string
+		consumed bool
+	}{
+		{"[youtube:tab] Downloading page 1", false},
+		{"[download] Old video has already been recorded in the archive", false},
+		{ytDlpItemPrefix + "abc123\thttps://www.youtube.com/watch?v=abc123\t" + file + "\tFirst", true},
+		{ytDlpItemPrefix + "retry01\tNA\t" + filepath.Join(dir, "missing.mp4") + "\tNA", true},
+	}
+	for _, tt := range lines {
+		if got := items.handleStdout(tt.line); got != tt.consumed {
+			t.Errorf("handleStdout(%q) = %t, want %t", tt.line, got, tt.consumed)
+		}
+	}
+	items.handleStderr("WARNING: [youtube] something")
+	items.handleStderr("ERROR: [youtube] priv001: Private video. Sign in if you've been granted access")
+	// 同一视频先成功后失败时以成功为准
+	items.handleStderr("ERROR: [youtube] retry01: HTTP Error 503")
+
+	list := items.list()
+	if len(list) != 4 {
+		t.Fatalf("list() length = %d, want 4", len(list))
+	}
+	if skip := list[0].result; !isSkipped(skip) || skip.Title != "Old video" {
+		t.Errorf("list()[0] = %+v, want skipped Old video", skip)
+	}
+	if ok := list[1]; !ok.result.Success || ok.result.VideoID != "abc123" || ok.result.FileSize != 10 || ok.sourceURL != "https://www.youtube.com/watch?v=abc123" {
+		t.Errorf("list()[1] = %+v, %q, want downloaded abc123", ok.result, ok.sourceURL)
+	}
+	if retried := list[2].result; !retried.Success || retried.Title != "" || list[2].sourceURL != "" {
+		t.Errorf("list()[2] = %+v, want successful retry01 without title", retried)
+	}
+	if failed := list[3].result; failed.Success || failed.VideoID != "priv001" || failed.Error == nil {
+		t.Errorf("list()[3] = %+v, want failed priv001", failed)
+	}
+
+	results := make([]*DownloadResult, len(list))
+	for i, item := range list {
+		results[i] = item.result
+	}
+	succeeded, skipped, failed, size := summarizeItems(results)
+	if succeeded != 2 || skipped != 1 || failed != 1 || size != 10 {
+		t.Errorf("summarizeItems() = %d, %d, %d, %d, want 2, 1, 1, 10", succeeded, skipped, failed, size)
+	}
+}
+
+func TestNewCollectionError(t *testing.T) {
+	network := &DownloadError{Class: ErrNetwork, Err: errors.New("connection reset")}
+	items := []*DownloadResult{
+		{Success: true, VideoID: "v1"},
+		{VideoID: "v2", Error: ErrAlreadyDownloaded},
+		{VideoID: "v3", Error: network},
+	}
+	err := newCollectionError(items)
+	if err.Error() != "频道/播放列表中 1/3 个视频下载失败" || ErrorClassName(err) != "network" {
+		t.Errorf("newCollectionError() = %q (%s), want 1/3 failed with class network", err, ErrorClassName(err))
+	}
+
+	// 有不可重试的错误时整个频道/播放列表按不可重试的类别处理
+	items = append(items, &DownloadResult{VideoID: "v4", Error: ErrUnavailable})
+	if err := newCollectionError(items); ErrorClassName(err) != "unavailable" {
+		t.Errorf("ErrorClassName(newCollectionError()) = %s, want unavailable", ErrorClassName(err))
+	}
+}
@@ -1,8 +1,14 @@
 package downloader
 
 import (
+	"context"
+	"errors"
 	"io"
+	"log"
+	"os"
 	"time"
+
+	"batch_download_videos/indexer"
 )
 
 type VideoInfo struct {
@@ -22,15 +28,60 @@ type DownloadResult struct {
 	Title      string
 	FilePath   string
 	FileSize   int64
+	Subtitles  []string // 已下载的字幕文件路径
+	Thumbnail  string   // 已下载的缩略图路径
 	Error      error
 	RetryCount int
+	Downloader string // 完成下载的下载器，智能下载器按路由规则尝试多个下载器时记录
+	// Items 频道/播放列表下载时每个视频的结果，跳过的视频 Error 为 ErrAlreadyDownloaded
+	Items []*DownloadResult
+}
+
+// newIndexRecord 生成下载完成后写入索引的记录，文件大小和校验和从 filePath 读取
+func newIndexRecord(id, platform, sourceURL, title, filePath, downloaderName string) indexer.Record {
+	record := indexer.Record{
+		ID:         id,
+		Platform:   platform,
+		SourceURL:  sourceURL,
+		Title:      title,
+		FilePath:   filePath,
+		Downloader: downloaderName,
+	}
+	if info, err := os.Stat(filePath); err == nil {
+		record.FileSize = info.Size()
+	}
+	checksum, err := indexer.FileChecksum(filePath)
+	if err != nil {
+		log.Printf("计算文件校验和失败: %v", err)
+	}
+	record.Checksum = checksum
+	return record
+}
+
+// alreadyDownloaded 返回视频已在索引中时的下载结果，调度器把它计为跳过
+func alreadyDownloaded(videoID, title string) *DownloadResult {
+	return &DownloadResult{
+		Success: false,
+		VideoID: videoID,
+		Title:   title,
+		Error:   ErrAlreadyDownloaded,
+	}
+}
+
+// isSkipped 判断下载结果是否为视频已下载而跳过
+func isSkipped(result *DownloadResult) bool {
+	return result != nil && errors.Is(result.Error, ErrAlreadyDownloaded)
 }
 
 type Downloader interface {
 	Name() string
 	SupportedPlatforms() []string
 	GetVideoInfo(url string) (*VideoInfo, error)
+	// GetVideoInfoContext 与 GetVideoInfo 相同，但可通过 ctx 取消
+	GetVideoInfoContext(ctx context.Context, url string) (*VideoInfo, error)
 	Download(url, outputDir, resolution string) (*DownloadResult, error)
+	// DownloadContext 与 Download 相同，但 ctx 取消时会中止下载（包括结束 yt-dlp 子进程）并清理未完成的文件
+	DownloadContext(ctx context.Context, url, outputDir, resolution string) (*DownloadResult, error)
 	IsDownloaded(videoID string) bool
 	MarkDownloaded(videoID string) error
 }
@@ -51,6 +102,14 @@ type DownloadProgress struct {
 	Progress float64
 	Speed    string
 	ETA      string
+	// Downloaded 已下载字节数
+	Downloaded int64
+	// Total 总字节数，未知时为 0
+	Total int64
+	// BytesPerSecond 下载速度（字节/秒）
+	BytesPerSecond float64
+	// Remaining 预计剩余时间，未知时为 0
+	Remaining time.Duration
 }
 
 type ProgressReader struct {
@@ -62,7 +121,7 @@ type ProgressReader struct {
 
 func (pr *ProgressReader) Read(p []byte) (n int, err error) {
 	n, err = pr.Reader.Read(p)
-	if err == nil {
+	if n > 0 {
 		pr.Current += int64(n)
 		if pr.OnProgress != nil {
 			pr.OnProgress(pr.Current, pr.Total)
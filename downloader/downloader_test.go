@@ -1,7 +1,15 @@
 package downloader
 
 import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
 	"testing"
+
+	"github.com/kkdai/youtube/v2"
+
+	"batch_download_videos/config"
 )
 
 func TestYouTubeDownloader_Name(t *testing.T) {
@@ -43,3 +51,265 @@ func TestMultiPlatformDownloader_SupportedPlatforms(t *testing.T) {
 		}
 	}
 }
+
+func testYouTubeVideo() *youtube.Video {
+	return &youtube.Video{
+		ID:    "test",
+		Title: "Test Video",
+		Formats: youtube.FormatList{
+			{ItagNo: 18, MimeType: `video/mp4; codecs="avc1.42001E, mp4a.40.2"`, Height: 360, Bitrate: 500000, AudioChannels: 2},
+			{ItagNo: 22, MimeType: `video/mp4; codecs="avc1.64001F, mp4a.40.2"`, Height: 720, Bitrate: 1500000, AudioChannels: 2},
+			{ItagNo: 137, MimeType: `video/mp4; codecs="avc1.640028"`, Height: 1080, Bitrate: 4000000},
+			{ItagNo: 248, MimeType: `video/webm; codecs="vp9"`, Height: 1080, Bitrate: 3000000},
+			{ItagNo: 271, MimeType: `video/webm; codecs="vp9"`, Height: 1440, Bitrate: 9000000},
+			{ItagNo: 140, MimeType: `audio/mp4; codecs="mp4a.40.2"`, Bitrate: 130000, AudioChannels: 2},
+			{ItagNo: 251, MimeType: `audio/webm; codecs="opus"`, Bitrate: 160000, AudioChannels: 2},
+		},
+	}
+}
+
+func TestYouTubeDownloader_SelectFormats(t *testing.T) {
+	ffmpeg := filepath.Join(t.TempDir(), "ffmpeg")
+	if err := os.WriteFile(ffmpeg, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatalf("Failed to write fake ffmpeg: %v", err)
+	}
+	t.Setenv("PATH", "")
+
+	tests := []struct {
+		name       string
+		ffmpegPath string
+		resolution string
+		wantVideo  int
+		wantAudio  int
+	}{
+		{"adaptive 1080p", ffmpeg, "1080", 137, 140},
+		{"adaptive 1440p", ffmpeg, "1440", 271, 251},
+		{"muxed when close enough", ffmpeg, "720", 22, 0},
+		{"muxed without ffmpeg", filepath.Join(t.TempDir(), "missing"), "1080", 22, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.DefaultConfig()
+			cfg.FfmpegPath = tt.ffmpegPath
+			ytd := &YouTubeDownloader{config: cfg}
+
+			videoFormat, audioFormat := ytd.selectFormats(testYouTubeVideo(), tt.resolution)
+			if videoFormat == nil || videoFormat.ItagNo != tt.wantVideo {
+				t.Errorf("video format = %v, want itag %d", videoFormat, tt.wantVideo)
+			}
+			gotAudio := 0
+			if audioFormat != nil {
+				gotAudio = audioFormat.ItagNo
+			}
+			if gotAudio != tt.wantAudio {
+				t.Errorf("audio format itag = %d, want %d", gotAudio, tt.wantAudio)
+			}
+		})
+	}
+}
+
+func TestYouTubeDownloader_FormatPreference(t *testing.T) {
+	t.Setenv("PATH", "")
+
+	tests := []struct {
+		name       string
+		codecs     []string
+		containers []string
+		maxBitrate int
+		wantVideo  int
+		wantExt    string
+	}{
+		{"bitrate wins without preference", nil, nil, 0, 137, ".mp4"},
+		{"preferred codec", []string{"vp9"}, nil, 0, 248, ".webm"},
+		{"preferred container", nil, []string{"webm"}, 0, 248, ".webm"},
+		{"max bitrate", nil, nil, 3500, 248, ".webm"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.DefaultConfig()
+			cfg.PreferredCodecs = tt.codecs
+			cfg.PreferredContainers = tt.containers
+			cfg.MaxBitrate = tt.maxBitrate
+			ytd := &YouTubeDownloader{config: cfg}
+
+			video := testYouTubeVideo()
+			videoFormat := ytd.selectVideoFormat(video, "1080")
+			if videoFormat == nil || videoFormat.ItagNo != tt.wantVideo {
+				t.Fatalf("video format = %v, want itag %d", videoFormat, tt.wantVideo)
+			}
+
+			audioFormat := ytd.selectAudioFormat(video, mimeContainer(videoFormat.MimeType))
+			if ext := formatExtension(videoFormat, audioFormat); ext != tt.wantExt {
+				t.Errorf("formatExtension() = %q, want %q", ext, tt.wantExt)
+			}
+		})
+	}
+}
+
+func TestMimeCodec(t *testing.T) {
+	tests := []struct {
+		mimeType string
+		want     string
+	}{
+		{`video/mp4; codecs="avc1.640028"`, "avc1.640028"},
+		{`video/mp4; codecs="vp09.00.40.08"`, "vp9.00.40.08"},
+		{`video/mp4; codecs="avc1.42001E, mp4a.40.2"`, "avc1.42001E"},
+		{`audio/webm; codecs="opus"`, "opus"},
+		{`video/mp4`, ""},
+	}
+
+	for _, tt := range tests {
+		if got := mimeCodec(tt.mimeType); got != tt.want {
+			t.Errorf("mimeCodec(%q) = %q, want %q", tt.mimeType, got, tt.want)
+		}
+	}
+}
+
+func TestSmartDownloaderSelectDownloader(t *testing.T) {
+	ytd := &YouTubeDownloader{}
+	mpd := &MultiPlatformDownloader{}
+	sd := NewSmartDownloader(ytd, mpd)
+
+	tests := []struct {
+		url  string
+		want Downloader
+	}{
+		{"https://www.youtube.com/watch?v=dQw4w9WgXcQ", ytd},
+		{"https://www.youtube.com/watch?v=dQw4w9WgXcQ&list=PL123", ytd},
+		{"https://youtube.com/shorts/dQw4w9WgXcQ", ytd},
+		{"https://www.youtube.com/playlist?list=PL123", mpd},
+		{"https://www.youtube.com/@someone", mpd},
+		{"https://www.youtube.com/live/dQw4w9WgXcQ", mpd},
+		{"https://www.bilibili.com/video/BV1xx411c7mD", mpd},
+		{"https://example.com/?next=youtube.com/watch?v=dQw4w9WgXcQ", mpd},
+	}
+	for _, tt := range tests {
+		if got := sd.selectDownloader(tt.url); got != tt.want {
+			t.Errorf("selectDownloader(%q) = %T, want %T", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestSmartDownloaderRoutingRules(t *testing.T) {
+	ytd := &YouTubeDownloader{}
+	mpd := &MultiPlatformDownloader{}
+	rules := []config.RoutingRule{
+		{Platform: "youtube", Kinds: []string{"live"}, Downloaders: []string{"multi"}},
+		{Pattern: `^https://www\.youtube\.com/watch`, Downloaders: []string{"youtube", "multi"}},
+		{Platform: "YouTube", Downloaders: []string{"youtube"}},
+	}
+	sd, err := NewSmartDownloaderWithRules(ytd, mpd, rules)
+	if err != nil {
+		t.Fatalf("NewSmartDownloaderWithRules() error = %v", err)
+	}
+
+	tests := []struct {
+		url  string
+		want []string
+	}{
+		{"https://www.youtube.com/live/dQw4w9WgXcQ", []string{"multi"}},
+		{"https://www.youtube.com/watch?v=dQw4w9WgXcQ", []string{"youtube", "multi"}},
+		{"https://youtu.be/dQw4w9WgXcQ", []string{"youtube"}},
+		{"https://vimeo.com/123456", []string{"multi"}},
+	}
+	for _, tt := range tests {
+		got := sd.route(tt.url)
+		if len(got) != len(tt.want) {
+			t.Errorf("route(%q) = %v, want %v", tt.url, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("route(%q) = %v, want %v", tt.url, got, tt.want)
+				break
+			}
+		}
+	}
+
+	invalid := [][]config.RoutingRule{
+		{{Platform: "youtube", Downloaders: []string{"unknown"}}},
+		{{Platform: "youtube"}},
+		{{Pattern: "(", Downloaders: []string{"multi"}}},
+	}
+	for _, rules := range invalid {
+		if _, err := NewSmartDownloaderWithRules(ytd, mpd, rules); err == nil {
+			t.Errorf("NewSmartDownloaderWithRules(%+v) error = nil, want error", rules)
+		}
+	}
+}
+
+// stubDownloader 返回固定结果的下载器，用于测试回退链
+type stubDownloader struct {
+	Downloader
+	result *DownloadResult
+	err    error
+	calls  int
+}
+
+func (sd *stubDownloader) DownloadContext(ctx context.Context, url, outputDir, resolution string) (*DownloadResult, error) {
+	sd.calls++
+	if sd.result == nil {
+		return nil, sd.err
+	}
+	result := *sd.result
+	return &result, sd.err
+}
+
+func TestSmartDownloaderFallback(t *testing.T) {
+	const url = "https://www.youtube.com/watch?v=dQw4w9WgXcQ"
+	newSmart := func(first, second *stubDownloader) *SmartDownloader {
+		sd, err := NewSmartDownloaderWithRules(&YouTubeDownloader{}, &MultiPlatformDownloader{}, config.DefaultRoutingRules())
+		if err != nil {
+			t.Fatalf("NewSmartDownloaderWithRules() error = %v", err)
+		}
+		sd.downloaders = map[string]Downloader{"youtube": first, "multi": second}
+		return sd
+	}
+
+	// 第一个下载器失败时使用第二个，结果记录实际完成下载的下载器
+	first := &stubDownloader{result: &DownloadResult{Error: errors.New("HTTP 403")}}
+	second := &stubDownloader{result: &DownloadResult{Success: true}}
+	result, err := newSmart(first, second).DownloadContext(context.Background(), url, "", "")
+	if err != nil || !result.Success || result.Downloader != "multi" {
+		t.Fatalf("DownloadContext() = %+v, %v, want success by multi", result, err)
+	}
+	if first.calls != 1 || second.calls != 1 {
+		t.Errorf("calls = %d, %d, want 1, 1", first.calls, second.calls)
+	}
+
+	// 第一个下载器成功或跳过时不再尝试后面的下载器
+	for _, res := range []*DownloadResult{{Success: true}, alreadyDownloaded("dQw4w9WgXcQ", "")} {
+		first = &stubDownloader{result: res}
+		second = &stubDownloader{result: &DownloadResult{Success: true}}
+		result, _ = newSmart(first, second).DownloadContext(context.Background(), url, "", "")
+		if result.Downloader != "youtube" || second.calls != 0 {
+			t.Errorf("DownloadContext() downloader = %q, fallback calls = %d, want youtube, 0", result.Downloader, second.calls)
+		}
+	}
+
+	// 失败的结果不记录下载器
+	first = &stubDownloader{result: &DownloadResult{Error: errors.New("HTTP 403")}}
+	second = &stubDownloader{result: &DownloadResult{Error: errors.New("HTTP 404")}}
+	if result, _ := newSmart(first, second).DownloadContext(context.Background(), url, "", ""); result.Downloader != "" {
+		t.Errorf("DownloadContext() failed result downloader = %q, want empty", result.Downloader)
+	}
+
+	// 全部失败时返回最后一个下载器的错误
+	first = &stubDownloader{err: errors.New("first")}
+	second = &stubDownloader{err: errors.New("second")}
+	if _, err := newSmart(first, second).DownloadContext(context.Background(), url, "", ""); err == nil || err.Error() != "second" {
+		t.Errorf("DownloadContext() error = %v, want second", err)
+	}
+
+	// 取消后不再尝试后面的下载器
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	first = &stubDownloader{err: context.Canceled}
+	second = &stubDownloader{result: &DownloadResult{Success: true}}
+	newSmart(first, second).DownloadContext(ctx, url, "", "")
+	if second.calls != 0 {
+		t.Errorf("fallback called after cancel")
+	}
+}
@@ -0,0 +1,267 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os/exec"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/kkdai/youtube/v2"
+)
+
+// 下载失败的错误类别，下载器返回的错误通过 errors.Is 匹配其中之一，
+// 重试策略和下载报告按类别区分处理
+var (
+	// ErrAlreadyDownloaded 视频已在索引中，调度器把它计为跳过
+	ErrAlreadyDownloaded = errors.New("视频已下载")
+	// ErrGeoBlocked 视频在当前地区不可用
+	ErrGeoBlocked = errors.New("视频在当前地区不可用")
+	// ErrLoginRequired 需要登录（年龄验证、会员视频等），通常需要配置Cookie文件
+	ErrLoginRequired = errors.New("需要登录")
+	// ErrUnavailable 视频为私享、已删除或不存在
+	ErrUnavailable = errors.New("视频不可用")
+	// ErrRateLimited 请求过于频繁，被服务器限流
+	ErrRateLimited = errors.New("请求过于频繁")
+	// ErrFormatUnavailable 没有符合要求的视频或音频格式
+	ErrFormatUnavailable = errors.New("没有可用的格式")
+	// ErrNetwork 网络错误，例如连接失败、超时或服务器错误
+	ErrNetwork = errors.New("网络错误")
+	// ErrToolMissing 缺少 yt-dlp、ffmpeg 等外部工具
+	ErrToolMissing = errors.New("缺少外部工具")
+)
+
+// errorClasses 按匹配顺序排列的错误类别及其名称，名称用于下载报告和失败记录
+var errorClasses = []struct {
+	class error
+	name  string
+}{
+	{ErrAlreadyDownloaded, "already_downloaded"},
+	{ErrGeoBlocked, "geo_blocked"},
+	{ErrLoginRequired, "login_required"},
+	{ErrUnavailable, "unavailable"},
+	{ErrRateLimited, "rate_limited"},
+	{ErrFormatUnavailable, "format_unavailable"},
+	{ErrNetwork, "network"},
+	{ErrToolMissing, "tool_missing"},
+}
+
+// DownloadError 带错误类别的下载错误，errors.Is 既能匹配类别也能匹配原始错误
+type DownloadError struct {
+	// Class 错误类别，无法识别时为 nil
+	Class error
+	Err   error
+	// Stderr yt-dlp 错误输出的摘要
+	Stderr string
+}
+
+func (e *DownloadError) Error() string {
+	if e.Stderr == "" {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("%v, 错误信息: %s", e.Err, e.Stderr)
+}
+
+func (e *DownloadError) Unwrap() []error {
+	if e.Class == nil {
+		return []error{e.Err}
+	}
+	return []error{e.Class, e.Err}
+}
+
+// StatusError HTTP 请求返回了非预期的状态码
+type StatusError struct {
+	StatusCode int
+	// RetryAfter HTTP 429 响应的 Retry-After 要求的等待时间，没有时为 0
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("请求失败，状态码: %d", e.StatusCode)
+}
+
+// Is 按状态码匹配错误类别
+func (e *StatusError) Is(target error) bool {
+	class := statusClass(e.StatusCode)
+	return class != nil && target == class
+}
+
+// statusClass 返回 HTTP 状态码对应的错误类别，403 等无法确定原因的状态码返回 nil
+func statusClass(code int) error {
+	switch {
+	case code == 401 || code == 407:
+		return ErrLoginRequired
+	case code == 404 || code == 410:
+		return ErrUnavailable
+	case code == 429:
+		return ErrRateLimited
+	case code == 451:
+		return ErrGeoBlocked
+	case code == 408 || code >= 500:
+		return ErrNetwork
+	}
+	return nil
+}
+
+// ErrorClass 返回错误所属的类别，无法识别时返回 nil
+func ErrorClass(err error) error {
+	if err == nil {
+		return nil
+	}
+	for _, c := range errorClasses {
+		if errors.Is(err, c.class) {
+			return c.class
+		}
+	}
+	return nil
+}
+
+// ErrorClassName 返回错误类别的名称，例如 rate_limited；
+// 下载被取消时为 canceled，无法识别时为 unknown，没有错误时为空
+func ErrorClassName(err error) string {
+	if err == nil {
+		return ""
+	}
+	class := ErrorClass(err)
+	for _, c := range errorClasses {
+		if c.class == class {
+			return c.name
+		}
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return "canceled"
+	}
+	return "unknown"
+}
+
+// classifyError 为 kkdai/youtube、HTTP 请求和外部命令返回的错误附加错误类别，
+// 已有类别或无法识别的错误原样返回
+func classifyError(err error) error {
+	if err == nil || ErrorClass(err) != nil {
+		return err
+	}
+	if class := errorClassOf(err); class != nil {
+		return &DownloadError{Class: class, Err: err}
+	}
+	return err
+}
+
+func errorClassOf(err error) error {
+	var playability *youtube.ErrPlayabiltyStatus
+	var statusCode youtube.ErrUnexpectedStatusCode
+	var playlistStatus youtube.ErrPlaylistStatus
+	var netErr net.Error
+	switch {
+	case errors.Is(err, youtube.ErrLoginRequired):
+		return ErrLoginRequired
+	case errors.Is(err, youtube.ErrVideoPrivate), errors.Is(err, youtube.ErrInvalidPlaylist):
+		return ErrUnavailable
+	case errors.As(err, &playability):
+		return playabilityClass(playability.Status, playability.Reason)
+	case errors.As(err, &statusCode):
+		return statusClass(int(statusCode))
+	case errors.As(err, &playlistStatus):
+		return ErrUnavailable
+	case errors.Is(err, exec.ErrNotFound):
+		return ErrToolMissing
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		// 取消和超时不属于任何类别，由调用方单独处理
+		return nil
+	case errors.As(err, &netErr), errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, syscall.ECONNRESET):
+		return ErrNetwork
+	}
+	return nil
+}
+
+// playabilityClass 按 YouTube 返回的播放状态和原因判断错误类别
+func playabilityClass(status, reason string) error {
+	reason = strings.ToLower(reason)
+	switch status {
+	case "LOGIN_REQUIRED", "AGE_CHECK_REQUIRED", "AGE_VERIFICATION_REQUIRED":
+		if strings.Contains(reason, "private") {
+			return ErrUnavailable
+		}
+		return ErrLoginRequired
+	case "UNPLAYABLE":
+		if strings.Contains(reason, "country") {
+			return ErrGeoBlocked
+		}
+		return ErrUnavailable
+	case "ERROR":
+		return ErrUnavailable
+	}
+	return nil
+}
+
+// ytDlpErrorPatterns yt-dlp 错误输出与错误类别的对应关系，按顺序匹配
+var ytDlpErrorPatterns = []struct {
+	pattern *regexp.Regexp
+	class   error
+}{
+	{regexp.MustCompile(`(?i)HTTP Error 429|Too Many Requests|rate.limit`), ErrRateLimited},
+	{regexp.MustCompile(`(?i)available in your country|geo.?restrict|blocked it in your country`), ErrGeoBlocked},
+	{regexp.MustCompile(`(?i)Private video|Video unavailable|has been removed|account .*terminated|does not exist|HTTP Error 404|HTTP Error 410`), ErrUnavailable},
+	{regexp.MustCompile(`(?i)Sign in to confirm|login required|members.only|use --cookies|HTTP Error 401`), ErrLoginRequired},
+	{regexp.MustCompile(`(?i)Requested format is not available|No video formats found`), ErrFormatUnavailable},
+	{regexp.MustCompile(`(?i)Unable to download webpage|timed out|Connection reset|Connection refused|name resolution|getaddrinfo|HTTP Error 5\d\d`), ErrNetwork},
+	{regexp.MustCompile(`(?i)ffmpeg not found|ffmpeg is not installed|ffprobe.*not found`), ErrToolMissing},
+}
+
+// classifyYtDlpOutput 按 yt-dlp 的错误输出判断错误类别，无法识别时返回 nil
+func classifyYtDlpOutput(output string) error {
+	for _, p := range ytDlpErrorPatterns {
+		if p.pattern.MatchString(output) {
+			return p.class
+		}
+	}
+	return nil
+}
+
+// maxStderrExcerpt 错误输出摘要的最大长度（字节）
+const maxStderrExcerpt = 500
+
+// stderrExcerpt 返回 yt-dlp 错误输出的摘要：优先取 ERROR 行，否则取最后几行，不超过 maxStderrExcerpt 字节
+func stderrExcerpt(stderr string) string {
+	var errorLines, lines []string
+	for _, line := range strings.Split(stderr, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		lines = append(lines, line)
+		if strings.HasPrefix(line, "ERROR:") {
+			errorLines = append(errorLines, line)
+		}
+	}
+	if len(errorLines) > 0 {
+		lines = errorLines
+	}
+	excerpt := strings.Join(lines[max(len(lines)-3, 0):], "\n")
+	if len(excerpt) > maxStderrExcerpt {
+		excerpt = strings.ToValidUTF8(excerpt[len(excerpt)-maxStderrExcerpt:], "")
+	}
+	return excerpt
+}
+
+// classifyYtDlpError 把 yt-dlp 命令失败的错误和错误输出组合为带类别的下载错误
+func classifyYtDlpError(err error, stderr string) error {
+	class := classifyYtDlpOutput(stderr)
+	if class == nil {
+		class = errorClassOf(err)
+	}
+	return &DownloadError{Class: class, Err: err, Stderr: stderrExcerpt(stderr)}
+}
+
+// StderrExcerpt 返回错误中记录的 yt-dlp 错误输出摘要，没有时为空
+func StderrExcerpt(err error) string {
+	var downloadErr *DownloadError
+	if errors.As(err, &downloadErr) {
+		return downloadErr.Stderr
+	}
+	return ""
+}
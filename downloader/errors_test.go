@@ -0,0 +1,129 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/kkdai/youtube/v2"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"login", youtube.ErrLoginRequired, ErrLoginRequired},
+		{"private", youtube.ErrVideoPrivate, ErrUnavailable},
+		{"playability login", &youtube.ErrPlayabiltyStatus{Status: "LOGIN_REQUIRED", Reason: "Sign in to confirm your age"}, ErrLoginRequired},
+		{"playability private", &youtube.ErrPlayabiltyStatus{Status: "LOGIN_REQUIRED", Reason: "This video is private"}, ErrUnavailable},
+		{"playability country", &youtube.ErrPlayabiltyStatus{Status: "UNPLAYABLE", Reason: "The uploader has not made this video available in your country"}, ErrGeoBlocked},
+		{"playability removed", &youtube.ErrPlayabiltyStatus{Status: "ERROR", Reason: "Video unavailable"}, ErrUnavailable},
+		{"playlist", youtube.ErrPlaylistStatus{Reason: "This playlist does not exist."}, ErrUnavailable},
+		{"status 429", youtube.ErrUnexpectedStatusCode(429), ErrRateLimited},
+		{"status 503", youtube.ErrUnexpectedStatusCode(503), ErrNetwork},
+		{"status 403", youtube.ErrUnexpectedStatusCode(403), nil},
+		{"tool", &exec.Error{Name: "yt-dlp", Err: exec.ErrNotFound}, ErrToolMissing},
+		{"canceled", context.Canceled, nil},
+		{"unknown", errors.New("boom"), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := fmt.Errorf("获取视频失败: %w", classifyError(tt.err))
+			if got := ErrorClass(err); got != tt.want {
+				t.Errorf("ErrorClass() = %v, want %v", got, tt.want)
+			}
+			if !errors.Is(err, tt.err) {
+				t.Errorf("errors.Is(err, original) = false, want true")
+			}
+		})
+	}
+}
+
+func TestStatusError(t *testing.T) {
+	tests := []struct {
+		code int
+		want error
+	}{
+		{401, ErrLoginRequired},
+		{404, ErrUnavailable},
+		{410, ErrUnavailable},
+		{429, ErrRateLimited},
+		{451, ErrGeoBlocked},
+		{500, ErrNetwork},
+		{403, nil},
+	}
+	for _, tt := range tests {
+		err := fmt.Errorf("下载失败: %w", &StatusError{StatusCode: tt.code})
+		if got := ErrorClass(err); got != tt.want {
+			t.Errorf("ErrorClass(status %d) = %v, want %v", tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestClassifyYtDlpOutput(t *testing.T) {
+	tests := []struct {
+		stderr string
+		want   error
+	}{
+		{"ERROR: [youtube] abc: Private video. Sign in if you've been granted access to this video", ErrUnavailable},
+		{"ERROR: [youtube] abc: Video unavailable. This video has been removed by the uploader", ErrUnavailable},
+		{"ERROR: [youtube] abc: The uploader has not made this video available in your country", ErrGeoBlocked},
+		{"ERROR: [youtube] abc: Sign in to confirm your age. This video may be inappropriate for some users.", ErrLoginRequired},
+		{"ERROR: [youtube] abc: Join this channel to get access to members-only content", ErrLoginRequired},
+		{"ERROR: unable to download video data: HTTP Error 429: Too Many Requests", ErrRateLimited},
+		{"ERROR: [youtube] abc: Requested format is not available. Use --list-formats", ErrFormatUnavailable},
+		{"ERROR: [generic] Unable to download webpage: <urlopen error timed out>", ErrNetwork},
+		{"ERROR: unable to download video data: HTTP Error 503: Service Unavailable", ErrNetwork},
+		{"ERROR: Postprocessing: ffprobe and ffmpeg not found. Please install or provide the path", ErrToolMissing},
+		{"ERROR: something unexpected", nil},
+	}
+	for _, tt := range tests {
+		if got := classifyYtDlpOutput(tt.stderr); got != tt.want {
+			t.Errorf("classifyYtDlpOutput(%q) = %v, want %v", tt.stderr, got, tt.want)
+		}
+	}
+}
+
+func TestClassifyYtDlpError(t *testing.T) {
+	exitErr := errors.New("exit status 1")
+	stderr := "[youtube] abc: Downloading webpage\nWARNING: [youtube] slow\nERROR: [youtube] abc: Private video\n"
+	err := fmt.Errorf("下载失败: %w", classifyYtDlpError(exitErr, stderr))
+	if !errors.Is(err, ErrUnavailable) || !errors.Is(err, exitErr) {
+		t.Errorf("classifyYtDlpError() = %v, want ErrUnavailable wrapping the exit error", err)
+	}
+	var downloadErr *DownloadError
+	if !errors.As(err, &downloadErr) || downloadErr.Stderr != "ERROR: [youtube] abc: Private video" {
+		t.Errorf("Stderr = %q, want only the ERROR line", downloadErr.Stderr)
+	}
+	if ErrorClassName(err) != "unavailable" {
+		t.Errorf("ErrorClassName() = %q, want unavailable", ErrorClassName(err))
+	}
+
+	long := "ERROR: " + strings.Repeat("界", 400)
+	if excerpt := stderrExcerpt(long); len(excerpt) > maxStderrExcerpt || !strings.HasSuffix(excerpt, "界") {
+		t.Errorf("stderrExcerpt() length = %d, want at most %d", len(excerpt), maxStderrExcerpt)
+	}
+}
+
+func TestErrorClassName(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{nil, ""},
+		{ErrAlreadyDownloaded, "already_downloaded"},
+		{fmt.Errorf("下载已取消: %w", context.Canceled), "canceled"},
+		{fmt.Errorf("音频模式需要ffmpeg: %w", ErrToolMissing), "tool_missing"},
+		{errors.New("boom"), "unknown"},
+	}
+	for _, tt := range tests {
+		if got := ErrorClassName(tt.err); got != tt.want {
+			t.Errorf("ErrorClassName(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// ffmpegPath 返回ffmpeg路径，优先使用配置文件中的路径
+func ffmpegPath(configured string) string {
+	if configured != "" {
+		if _, err := exec.LookPath(configured); err == nil {
+			return configured
+		}
+	}
+
+	// 尝试使用当前目录下的ffmpeg.exe
+	if _, err := os.Stat("./ffmpeg.exe"); err == nil {
+		return "./ffmpeg.exe"
+	}
+
+	// 如果配置的路径和当前目录都不存在，则尝试使用系统PATH中的ffmpeg
+	return "ffmpeg"
+}
+
+// ffmpegAvailable 检查ffmpeg是否可用
+func ffmpegAvailable(configured string) bool {
+	_, err := exec.LookPath(ffmpegPath(configured))
+	return err == nil
+}
+
+// transcodeAudio 使用ffmpeg从 inputPath 中提取音频并转码为 audioFormat（mp3/m4a/opus）
+// bitrate 为空时 mp3 使用 VBR 质量 2，其他格式使用编码器默认值
+func transcodeAudio(ctx context.Context, configuredFfmpeg, inputPath, outputPath, audioFormat, bitrate string) error {
+	args := []string{"-y", "-i", inputPath, "-vn"}
+	switch audioFormat {
+	case "mp3":
+		args = append(args, "-c:a", "libmp3lame")
+		if bitrate == "" {
+			args = append(args, "-q:a", "2")
+		}
+	case "m4a":
+		args = append(args, "-c:a", "aac")
+	case "opus":
+		args = append(args, "-c:a", "libopus")
+	default:
+		return fmt.Errorf("不支持的音频格式: %s", audioFormat)
+	}
+	if bitrate != "" {
+		args = append(args, "-b:a", bitrate)
+	}
+	args = append(args, outputPath)
+
+	cmd := exec.CommandContext(ctx, ffmpegPath(configuredFfmpeg), args...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		os.Remove(outputPath)
+		return fmt.Errorf("ffmpeg音频转码失败: %w\n%s", err, ffmpegErrorOutput(output))
+	}
+
+	log.Printf("音频转码完成: %s -> %s", inputPath, outputPath)
+	return nil
+}
+
+// ffmpegErrorOutput 截取ffmpeg输出末尾的错误信息
+func ffmpegErrorOutput(output []byte) string {
+	if len(output) > 500 {
+		output = output[len(output)-500:]
+	}
+	return strings.ToValidUTF8(string(output), "")
+}
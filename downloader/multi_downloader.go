@@ -1,9 +1,10 @@
 package downloader
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
@@ -20,6 +21,12 @@ import (
 	"batch_download_videos/utils"
 )
 
+// archiveFileName 频道/播放列表下载时 yt-dlp 下载存档的文件名，保存在平台输出目录中
+const archiveFileName = "downloaded_archive.txt"
+
+// ytDlpExitStopped yt-dlp 因下载数量限制或中断条件提前停止时的退出码
+const ytDlpExitStopped = 101
+
 type MultiPlatformDownloader struct {
 	config    *config.Config
 	indexer   *indexer.Indexer
@@ -53,6 +60,10 @@ func (mpd *MultiPlatformDownloader) SupportedPlatforms() []string {
 }
 
 func (mpd *MultiPlatformDownloader) GetVideoInfo(url string) (*VideoInfo, error) {
+	return mpd.GetVideoInfoContext(context.Background(), url)
+}
+
+func (mpd *MultiPlatformDownloader) GetVideoInfoContext(ctx context.Context, url string) (*VideoInfo, error) {
 	// 尝试使用当前目录下的yt-dlp.exe
 	ytDlpPath := "./yt-dlp.exe"
 	if _, err := os.Stat(ytDlpPath); os.IsNotExist(err) {
@@ -66,7 +77,7 @@ func (mpd *MultiPlatformDownloader) GetVideoInfo(url string) (*VideoInfo, error)
 	}
 
 	// 抖音和TikTok的特殊处理
-	if strings.Contains(url, "douyin.com") || strings.Contains(url, "tiktok.com") {
+	if platform := utils.GetWebsiteType(url); platform == "douyin" || platform == "tiktok" {
 		// 使用--no-check-certificate来避免证书问题
 		// 使用--user-agent来模拟浏览器
 		args = append(args, "--no-check-certificate")
@@ -83,7 +94,7 @@ func (mpd *MultiPlatformDownloader) GetVideoInfo(url string) (*VideoInfo, error)
 
 	args = append(args, url)
 
-	cmd := exec.Command(ytDlpPath, args...)
+	cmd := ytDlpCommand(ctx, ytDlpPath, args...)
 
 	// 捕获标准错误
 	var stderr strings.Builder
@@ -91,8 +102,11 @@ func (mpd *MultiPlatformDownloader) GetVideoInfo(url string) (*VideoInfo, error)
 
 	output, err := cmd.Output()
 	if err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("获取视频信息已取消: %w", ctx.Err())
+		}
 		log.Printf("yt-dlp错误输出: %s", stderr.String())
-		return nil, fmt.Errorf("获取视频信息失败: %w, 错误详情: %s", err, stderr.String())
+		return nil, fmt.Errorf("获取视频信息失败: %w", classifyYtDlpError(err, stderr.String()))
 	}
 
 	var info struct {
@@ -121,12 +135,22 @@ func (mpd *MultiPlatformDownloader) GetVideoInfo(url string) (*VideoInfo, error)
 }
 
 func (mpd *MultiPlatformDownloader) Download(url, outputDir, resolution string) (*DownloadResult, error) {
+	return mpd.DownloadContext(context.Background(), url, outputDir, resolution)
+}
+
+func (mpd *MultiPlatformDownloader) DownloadContext(ctx context.Context, url, outputDir, resolution string) (*DownloadResult, error) {
 	log.Printf("[多平台下载器] 开始处理下载请求: %s", url)
 
-	// 获取平台类型
-	platform := utils.GetWebsiteType(url)
-	// 获取平台特定的输出目录
+	opts := optionsFromContext(ctx)
+
+	// 按主机名和路径识别平台和内容类型
+	match := utils.MatchURL(url)
+	platform := match.Platform
+	// 获取平台特定的输出目录，音频模式使用平台的音频目录
 	platformOutputDir := mpd.config.GetPlatformOutputDir(platform)
+	if opts.AudioOnly {
+		platformOutputDir = mpd.config.GetPlatformAudioDir(platform)
+	}
 	log.Printf("[多平台下载器] 检测到平台: %s, 使用输出目录: %s", platform, platformOutputDir)
 
 	// 确保平台输出目录存在
@@ -137,27 +161,17 @@ func (mpd *MultiPlatformDownloader) Download(url, outputDir, resolution string)
 	log.Printf("[多平台下载器] 平台输出目录已准备就绪: %s", platformOutputDir)
 
 	// 首先检查是否是抖音视频
-	if strings.Contains(url, "douyin.com/video/") {
+	if platform == "douyin" && match.Kind == utils.KindVideo {
 		log.Printf("[调试] 检测到抖音视频URL，使用专门的抖音下载方法")
-		return mpd.downloadDouyinVideo(url, platformOutputDir)
+		// 用户主页中打开的视频（modal_id）也使用视频页面的规范URL
+		return mpd.downloadDouyinVideo(ctx, match.Canonical, platformOutputDir)
 	}
 
-	// 首先检查URL类型，判断是否为频道或播放列表
-	isPlaylist := strings.Contains(url, "list=")
-
-	// 改进的频道检测逻辑
-	// TikTok: 包含/@但不含/video/的是频道，包含/video/的是单个视频
-	// 抖音: 包含/user/但不含modal_id=的是频道，包含modal_id=的是单个视频
-	// YouTube: 包含/@、/channel/、/c/、/user/但不含/watch?v=的是频道，包含/watch?v=的是单个视频
-	isChannel := false
-	if strings.Contains(url, "tiktok.com") {
-		isChannel = strings.Contains(url, "/@") && !strings.Contains(url, "/video/")
-	} else if strings.Contains(url, "douyin.com") {
-		isChannel = strings.Contains(url, "/user/") && !strings.Contains(url, "modal_id=")
-	} else {
-		// 其他平台使用原有的检测逻辑
-		isChannel = (strings.Contains(url, "/@") || strings.Contains(url, "/channel/") || strings.Contains(url, "/c/") || strings.Contains(url, "/user/")) && !strings.Contains(url, "/watch?v=")
-	}
+	// 检查URL类型，判断是否为频道或播放列表
+	// TikTok 的 /@user、抖音的 /user/（不含 modal_id）、YouTube 的 /@、/channel/、/c/、/user/ 是频道，
+	// YouTube 只有 /playlist?list= 是播放列表，watch?v=X&list=Y 作为单个视频下载
+	isPlaylist := match.Kind == utils.KindPlaylist
+	isChannel := match.Kind == utils.KindChannel
 
 	log.Printf("[调试] URL类型: 播放列表=%t, 频道=%t", isPlaylist, isChannel)
 
@@ -172,9 +186,10 @@ func (mpd *MultiPlatformDownloader) Download(url, outputDir, resolution string)
 			ytDlpPath = "yt-dlp"
 		}
 
-		qualityFormat := utils.GetQualityFormat(resolution)
+		qualityFormat := mpd.formatSelector(platform, resolution, opts)
 		// 对于播放列表下载，使用更简单的输出模板，避免NA_NA_前缀
-		outputTemplate := filepath.Join(platformOutputDir, "%(title)s_%(id)s_%(timestamp)s.%(ext)s")
+		// 模板相对于 -P 指定的平台输出目录，.part、分片等中间文件写入 -P temp: 指定的临时目录
+		outputTemplate := "%(title)s_%(id)s_%(timestamp)s.%(ext)s"
 		// 如果配置文件中没有设置输出模板，则使用默认模板
 		if mpd.config.OutputTemplate != "" {
 			// 使用配置文件中的模板，但移除可能导致NA_NA_前缀的变量
@@ -182,28 +197,45 @@ func (mpd *MultiPlatformDownloader) Download(url, outputDir, resolution string)
 			// 替换模板变量，确保不会出现NA值
 			template = strings.ReplaceAll(template, "%(platform)s", platform)
 			template = strings.ReplaceAll(template, "%(content_type)s", "short")
-			outputTemplate = filepath.Join(platformOutputDir, template)
+			outputTemplate = template
 		}
 
-		// 改进的格式选择逻辑
-		// 对于TikTok和抖音，使用best格式，因为这些平台的视频格式可能不标准
-		if platform == "tiktok" || platform == "douyin" {
-			qualityFormat = "best"
-		} else {
-			// 其他平台使用best[height<=720]格式，直接下载已经合并好的视频
-			qualityFormat = "best[height<=720]"
+		// 每次下载使用单独的临时目录，结束或取消时只删除本次下载的中间文件，
+		// 不影响其他 worker 在同一平台目录中正在进行的下载
+		tempDir, err := os.MkdirTemp(platformOutputDir, ".yt-dlp-")
+		if err != nil {
+			return nil, fmt.Errorf("创建临时目录失败: %w", err)
+		}
+		defer os.RemoveAll(tempDir)
+
+		// yt-dlp 用下载存档跳过已下载的视频，先把索引中本平台的记录写入存档，
+		// 这样单个URL下载过的视频在频道/播放列表中也会被跳过
+		archivePath := filepath.Join(platformOutputDir, archiveFileName)
+		if exported, err := mpd.indexer.ExportArchive(archivePath, platform, opts.AudioOnly); err != nil {
+			log.Printf("[多平台下载器] 同步下载存档失败: %v", err)
+		} else if exported > 0 {
+			log.Printf("[多平台下载器] 已将 %d 条索引记录写入下载存档: %s", exported, archivePath)
 		}
 
 		// 根据URL类型设置不同的下载参数
 		args := []string{
 			"-f", qualityFormat,
+			"-P", platformOutputDir,
+			"-P", "temp:" + tempDir,
 			"-o", outputTemplate,
 			"--no-warnings",
-			"--ignore-errors",                                                                // 忽略错误，继续下载其他视频
-			"--continue",                                                                     // 支持断点续传
-			"--no-overwrites",                                                                // 不覆盖已存在的文件
-			"--download-archive", filepath.Join(platformOutputDir, "downloaded_archive.txt"), // 记录已下载的视频ID，避免重复下载
+			"--ignore-errors",                 // 忽略错误，继续下载其他视频
+			"--continue",                      // 支持断点续传
+			"--no-overwrites",                 // 不覆盖已存在的文件
+			"--download-archive", archivePath, // 记录已下载的视频ID，避免重复下载
+		}
+
+		args = append(args, mpd.mergeArgs()...)
+		args = append(args, mpd.audioArgs(opts)...)
+		if !opts.AudioOnly {
+			args = append(args, ytDlpSubtitleArgs(mpd.config, opts)...)
 		}
+		args = append(args, ytDlpThumbnailArgs(mpd.config)...)
 
 		// 对于播放列表下载，生成JSON文件（用于后续生成TXT元数据文件）
 		if mpd.config.GenerateMetaFile {
@@ -232,14 +264,10 @@ func (mpd *MultiPlatformDownloader) Download(url, outputDir, resolution string)
 			args = append(args, "--limit-rate", mpd.config.LimitRate)
 		}
 
-		// 对于频道下载，限制只下载最新的10个视频，避免程序卡住
-		// 对于播放列表下载，不限制数量，支持完整下载
-		if isChannel {
-			args = append(args, "--playlist-end", "10", "--max-downloads", "10")
-			log.Printf("[调试] 检测到频道URL，限制只下载最新的10个视频")
-		} else if isPlaylist {
-			log.Printf("[调试] 检测到播放列表URL，支持完整下载")
-		}
+		// 范围、数量、日期和顺序由URL选项和配置文件决定，频道默认只下载最新的 channel_max_items 个视频
+		collectionArgs := ytDlpCollectionArgs(mpd.config, opts, match.Kind)
+		args = append(args, collectionArgs...)
+		log.Printf("[调试] 频道/播放列表选择参数: %v", collectionArgs)
 
 		// 为抖音和TikTok添加特殊参数
 		if platform == "tiktok" || platform == "douyin" {
@@ -253,43 +281,75 @@ func (mpd *MultiPlatformDownloader) Download(url, outputDir, resolution string)
 			log.Printf("[调试] 使用Cookie文件: %s", mpd.config.CookieFile)
 		}
 
+		// 每个视频下载完成后输出视频ID和文件路径，用于记录每个视频的结果
+		args = append(args, ytDlpItemArgs()...)
+
+		// 需要上报进度时，让yt-dlp输出机器可读的进度行
+		if progressFromContext(ctx) != nil {
+			args = append(args, ytDlpProgressArgs()...)
+		}
+
 		args = append(args, url)
 
 		log.Printf("[调试] 执行yt-dlp命令: %s %s", ytDlpPath, strings.Join(args, " "))
 
 		// 直接执行yt-dlp命令，不使用GetVideoInfo
-		cmd := exec.Command(ytDlpPath, args...)
+		cmd := ytDlpCommand(ctx, ytDlpPath, args...)
 
-		// 直接输出命令的执行结果到控制台
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
+		// 进度行转换为进度事件，下载结果行和错误输出用于记录每个视频的结果，其余输出直接打印到控制台
+		items := newCollectionResults()
+		stdout := newYtDlpOutputWriter(ctx, "", func(line string) {
+			if !items.handleStdout(line) {
+				fmt.Fprintln(os.Stdout, line)
+			}
+		})
+		stderr := newYtDlpOutputWriter(context.Background(), "", func(line string) {
+			items.handleStderr(line)
+			fmt.Fprintln(os.Stderr, line)
+		})
+		cmd.Stdout = stdout
+		cmd.Stderr = stderr
 
 		log.Printf("[调试] 开始执行yt-dlp命令...")
 		log.Printf("[调试] 执行命令: %s %s", ytDlpPath, strings.Join(args, " "))
 		startTime := time.Now()
 
-		err := cmd.Run()
+		err = cmd.Run()
+		stdout.Flush()
+		stderr.Flush()
 
 		duration := time.Since(startTime)
 		log.Printf("[调试] yt-dlp命令执行完成，耗时: %v", duration)
 
-		// 检查错误
-		if err != nil {
-			// 检查错误是否是因为达到了最大下载数量而导致的
-			// 当yt-dlp因为--max-downloads参数而停止下载时，它会返回一个错误码
-			// 但是实际上，所有的视频都已经成功下载了
-			log.Printf("[调试] yt-dlp命令执行失败: %v", err)
+		// 每个下载成功的视频记录到索引中，下载存档中的其他视频再由 ImportArchive 补充
+		var results []*DownloadResult
+		for _, item := range items.list() {
+			result := item.result
+			results = append(results, result)
+			if !result.Success {
+				continue
+			}
+			indexKey := result.VideoID
+			if opts.AudioOnly {
+				indexKey = indexer.AudioKey(indexKey)
+			}
+			if err := mpd.indexer.AddRecord(newIndexRecord(indexKey, platform, item.sourceURL, result.Title, result.FilePath, mpd.Name())); err != nil {
+				log.Printf("[多平台下载器] 更新索引失败: %v", err)
+			}
+		}
 
-			// 对于频道或播放列表下载，我们认为即使返回了错误码，只要视频被下载了，就是成功的
-			// 因为yt-dlp在达到最大下载数量时会返回错误码
-			log.Printf("[调试] 频道/播放列表下载完成，即使yt-dlp返回了错误码")
-		} else {
-			log.Printf("[调试] yt-dlp命令执行成功")
+		// 把 yt-dlp 本次下载的视频加入索引，之后单独下载这些视频时会被跳过
+		if imported, err := mpd.indexer.ImportArchive(archivePath, opts.AudioOnly); err != nil {
+			log.Printf("[多平台下载器] 导入下载存档失败: %v", err)
+		} else if imported > 0 {
+			log.Printf("[多平台下载器] 已从下载存档导入 %d 条索引记录", imported)
 		}
 
-		// 对于频道或播放列表下载，我们总是认为是成功的
-		// 因为yt-dlp在达到最大下载数量时会返回错误码
-		// 但是实际上，所有的视频都已经成功下载了
+		// 下载被取消时，yt-dlp 进程已被结束，本次下载的临时目录在返回时删除
+		if ctx.Err() != nil {
+			log.Printf("[调试] 频道/播放列表下载已取消: %s", url)
+			return nil, fmt.Errorf("下载已取消: %w", ctx.Err())
+		}
 
 		// 处理Meta文件的生成
 		if mpd.config.GenerateMetaFile {
@@ -298,21 +358,45 @@ func (mpd *MultiPlatformDownloader) Download(url, outputDir, resolution string)
 			}
 		}
 
-		// 对于频道或播放列表，我们无法返回单个视频的结果
-		// 直接返回成功，因为yt-dlp已经处理了所有下载
-		return &DownloadResult{
-			Success:    true,
-			VideoID:    "",
-			Title:      "频道/播放列表下载",
-			FilePath:   platformOutputDir,
-			FileSize:   0,
-			Error:      nil,
-			RetryCount: 0,
-		}, nil
+		succeeded, skipped, failed, size := summarizeItems(results)
+		log.Printf("[多平台下载器] 频道/播放列表下载完成: 成功 %d 个，跳过 %d 个，失败 %d 个", succeeded, skipped, failed)
+		result := &DownloadResult{
+			Success:  true,
+			Title:    "频道/播放列表下载",
+			FilePath: platformOutputDir,
+			FileSize: size,
+			Items:    results,
+		}
+
+		// yt-dlp 因 --max-downloads、--break-on-existing 或 --break-match-filters 提前停止时退出码为 101，属于正常结束
+		var exitErr *exec.ExitError
+		switch {
+		case err == nil:
+			log.Printf("[调试] yt-dlp命令执行成功")
+		case errors.As(err, &exitErr) && exitErr.ExitCode() == ytDlpExitStopped:
+			log.Printf("[调试] yt-dlp达到下载数量限制或遇到已下载的视频，停止下载")
+		case failed == 0:
+			// 使用了 --ignore-errors，没有识别出失败的视频时，整个频道/播放列表作为失败
+			log.Printf("[调试] yt-dlp命令执行失败: %v", err)
+			result.Success = false
+			result.Error = fmt.Errorf("频道/播放列表下载失败: %w", classifyYtDlpError(err, items.stderr()))
+			return result, nil
+		}
+		if failed > 0 {
+			result.Success = false
+			result.Error = newCollectionError(results)
+		}
+		return result, nil
 	}
 
 	// 以下是原始的单个视频处理逻辑
-	info, err := mpd.GetVideoInfo(url)
+	// 先按URL检查索引，已下载的视频不再请求视频信息
+	if record, ok := mpd.indexer.LookupURL(url, opts.AudioOnly); ok {
+		log.Printf("[调试] 视频已下载: %s", url)
+		return alreadyDownloaded(record.ID, record.Title), nil
+	}
+
+	info, err := mpd.GetVideoInfoContext(ctx, url)
 	if err != nil {
 		log.Printf("[调试] 获取视频信息失败: %v", err)
 		return nil, err
@@ -320,7 +404,13 @@ func (mpd *MultiPlatformDownloader) Download(url, outputDir, resolution string)
 
 	uniqueID := mpd.getUniqueID(url, info)
 
-	if mpd.indexer.IsDownloaded(uniqueID) {
+	// 音频模式下载的文件与视频分别记录在索引中
+	indexKey := uniqueID
+	if opts.AudioOnly {
+		indexKey = indexer.AudioKey(uniqueID)
+	}
+
+	if mpd.indexer.IsDownloaded(indexKey) {
 		log.Printf("[调试] 视频已下载: %s", uniqueID)
 		return &DownloadResult{
 			Success:    false,
@@ -328,39 +418,45 @@ func (mpd *MultiPlatformDownloader) Download(url, outputDir, resolution string)
 			Title:      info.Title,
 			FilePath:   "",
 			FileSize:   0,
-			Error:      fmt.Errorf("视频已下载"),
+			Error:      ErrAlreadyDownloaded,
 			RetryCount: 0,
 		}, nil
 	}
 
 	log.Printf("开始下载: %s (ID: %s, 网站: %s, 分辨率: %s)", info.Title, uniqueID, platform, resolution)
 
-	qualityFormat := utils.GetQualityFormat(resolution)
-	// 生成文件名
+	qualityFormat := mpd.formatSelector(platform, resolution, opts)
+	// 生成文件名，扩展名由 yt-dlp 根据实际选择的格式填写
 	filename := mpd.generateFilename(info, ".mp4")
 	filePath := filepath.Join(platformOutputDir, filename)
+	// 先下载到只由平台和视频ID决定的目录和文件名，中断后下次运行时 --continue 能从 .part 继续，
+	// 下载完成后再移动到输出目录并重命名为按模板生成的文件名
+	stageBase := partialFileName(platform, uniqueID, "", "")
+	stageDir := filepath.Join(platformOutputDir, ".yt-dlp-"+stageBase)
+	outputTemplate := filepath.Join(stageDir, stageBase+".%(ext)s")
 
 	if err := utils.CleanupZeroByteFiles(filePath); err != nil {
 		log.Printf("清理0字节文件失败: %v", err)
 	}
 
-	// 改进的格式选择逻辑
-	// 对于TikTok和抖音，使用best格式，因为这些平台的视频格式可能不标准
-	if platform == "tiktok" || platform == "douyin" {
-		qualityFormat = "best"
-	} else {
-		// 其他平台使用best[height<=720]格式，直接下载已经合并好的视频
-		qualityFormat = "best[height<=720]"
-	}
-
 	args := []string{
 		"-f", qualityFormat,
-		"-o", filePath,
+		"-o", outputTemplate,
+		"--print", "after_move:filepath", // 输出最终文件路径
 		"--no-warnings",
 		"--continue",      // 支持断点续传
 		"--no-overwrites", // 不覆盖已存在的文件
 	}
 
+	args = append(args, mpd.mergeArgs()...)
+	args = append(args, mpd.audioArgs(opts)...)
+	subtitleArgs := []string(nil)
+	if !opts.AudioOnly {
+		subtitleArgs = ytDlpSubtitleArgs(mpd.config, opts)
+		args = append(args, subtitleArgs...)
+	}
+	args = append(args, ytDlpThumbnailArgs(mpd.config)...)
+
 	// 如果需要生成Meta文件，则添加--write-info-json参数
 	if mpd.config.GenerateMetaFile {
 		args = append(args, "--write-info-json")
@@ -393,6 +489,11 @@ func (mpd *MultiPlatformDownloader) Download(url, outputDir, resolution string)
 		log.Printf("使用Cookie文件: %s", mpd.config.CookieFile)
 	}
 
+	// 需要上报进度时，让yt-dlp输出机器可读的进度行
+	if progressFromContext(ctx) != nil {
+		args = append(args, ytDlpProgressArgs()...)
+	}
+
 	args = append(args, url)
 
 	// 尝试使用当前目录下的yt-dlp.exe
@@ -403,28 +504,62 @@ func (mpd *MultiPlatformDownloader) Download(url, outputDir, resolution string)
 	}
 
 	var lastErr error
-	for retry := 0; retry < mpd.config.MaxRetries; retry++ {
+	policy := NewRetryPolicy(mpd.config, "yt-dlp")
+	attempts := 0
+	for retry := 0; retry < policy.MaxAttempts; retry++ {
 		if retry > 0 {
-			delay := mpd.config.BaseRetryDelay * time.Duration(retry)
-			log.Printf("重试 %d/%d，等待 %v 后重试...", retry, mpd.config.MaxRetries, delay)
-			time.Sleep(delay)
+			// 按错误类别决定是否重试，视频不可用等永久性错误不再重试
+			delay, ok := policy.Next(lastErr, retry)
+			if !ok {
+				log.Printf("错误不可重试，放弃下载: %v", lastErr)
+				break
+			}
+			log.Printf("重试 %d/%d，等待 %v 后重试...", retry, policy.MaxAttempts, delay)
+			if err := utils.SleepContext(ctx, delay); err != nil {
+				return nil, fmt.Errorf("下载已取消: %w", err)
+			}
 		}
+		attempts++
 
 		log.Printf("[调试] 执行yt-dlp命令: %s %s", ytDlpPath, strings.Join(args, " "))
-		cmd := exec.Command(ytDlpPath, args...)
+		cmd := ytDlpCommand(ctx, ytDlpPath, args...)
 
-		// 捕获标准错误
+		// 捕获标准错误，标准输出中的进度行转换为进度事件
 		var stderr strings.Builder
 		cmd.Stderr = &stderr
+		// 非进度行是 --print 输出的最终文件路径
+		printedPath := ""
+		stdout := newYtDlpOutputWriter(ctx, info.Title, func(line string) {
+			printedPath = strings.TrimSpace(line)
+		})
+		cmd.Stdout = stdout
 
-		if err := cmd.Run(); err != nil {
-			lastErr = err
-			log.Printf("下载失败 (尝试 %d/%d): %v", retry+1, mpd.config.MaxRetries, err)
+		err := cmd.Run()
+		stdout.Flush()
+		if err != nil {
+			if ctx.Err() != nil {
+				// yt-dlp 进程已被结束，保留 .part 等临时文件，下次运行时继续下载
+				log.Printf("下载已取消: %s (ID: %s)", info.Title, uniqueID)
+				return nil, fmt.Errorf("下载已取消: %w", ctx.Err())
+			}
+			lastErr = classifyYtDlpError(err, stderr.String())
+			log.Printf("下载失败 (尝试 %d/%d): %v", retry+1, policy.MaxAttempts, err)
 			log.Printf("[调试] 错误输出: %s", stderr.String())
 			continue
 		}
 
-		mpd.indexer.MarkDownloaded(uniqueID)
+		stagedPath := filepath.Join(stageDir, stageBase+".mp4")
+		if printedPath != "" {
+			stagedPath = printedPath
+		}
+		filePath, err = moveStagedFiles(stageDir, stageBase, platformOutputDir, strings.TrimSuffix(filename, ".mp4"), stagedPath)
+		if err != nil {
+			return nil, fmt.Errorf("移动下载文件失败: %w", err)
+		}
+
+		if err := mpd.indexer.AddRecord(newIndexRecord(indexKey, platform, url, info.Title, filePath, mpd.Name())); err != nil {
+			log.Printf("写入下载索引失败: %v", err)
+		}
 
 		// 处理Meta文件的生成
 		if mpd.config.GenerateMetaFile {
@@ -433,6 +568,15 @@ func (mpd *MultiPlatformDownloader) Download(url, outputDir, resolution string)
 			}
 		}
 
+		var subtitlePaths []string
+		if len(subtitleArgs) > 0 {
+			subtitlePaths = findSubtitleFiles(filePath)
+		}
+		thumbnail := ""
+		if mpd.config.WriteThumbnail {
+			thumbnail = findThumbnailFile(filePath)
+		}
+
 		fileInfo, _ := os.Stat(filePath)
 		fileSize := int64(0)
 		if fileInfo != nil {
@@ -446,12 +590,74 @@ func (mpd *MultiPlatformDownloader) Download(url, outputDir, resolution string)
 			Title:      info.Title,
 			FilePath:   filePath,
 			FileSize:   fileSize,
+			Subtitles:  subtitlePaths,
+			Thumbnail:  thumbnail,
 			Error:      nil,
 			RetryCount: retry,
 		}, nil
 	}
 
-	return nil, fmt.Errorf("下载失败: %w (尝试 %d 次后放弃)", lastErr, mpd.config.MaxRetries)
+	return nil, fmt.Errorf("下载失败: %w", &RetryError{Attempts: attempts, Err: lastErr})
+}
+
+// formatSelector 返回 yt-dlp 的 -f 格式选择字符串，按配置的编码、容器和比特率偏好选择
+func (mpd *MultiPlatformDownloader) formatSelector(platform, resolution string, opts Options) string {
+	// 音频模式下载最佳音频，没有单独音频流的平台退回到完整视频，由 -x 提取音频
+	if opts.AudioOnly {
+		return "bestaudio/best"
+	}
+
+	// 对于TikTok和抖音，使用best格式，因为这些平台的视频格式可能不标准
+	if platform == "tiktok" || platform == "douyin" {
+		return "best"
+	}
+
+	return utils.GetQualityFormatWithPreference(resolution, utils.FormatPreference{
+		Codecs:     mpd.config.PreferredCodecs,
+		Containers: mpd.config.PreferredContainers,
+		MaxBitrate: mpd.config.MaxBitrate,
+		// 没有ffmpeg时无法合并音视频，直接下载已经合并好的视频
+		MuxedOnly: !ffmpegAvailable(mpd.config.FfmpegPath),
+	})
+}
+
+// audioArgs 返回 yt-dlp 音频模式的参数：用 -x 提取音频，并按配置转码
+// 提取音频需要ffmpeg，找不到时只下载音频格式而不提取
+func (mpd *MultiPlatformDownloader) audioArgs(opts Options) []string {
+	if !opts.AudioOnly {
+		return nil
+	}
+	if !ffmpegAvailable(mpd.config.FfmpegPath) {
+		log.Printf("未找到ffmpeg，音频模式将只下载音频格式，不提取或转码")
+		return nil
+	}
+
+	audioFormat, audioBitrate := audioSettings(mpd.config, opts)
+	if audioFormat == "" {
+		audioFormat = "best"
+	}
+	args := []string{"-x", "--audio-format", audioFormat}
+	if audioBitrate != "" {
+		args = append(args, "--audio-quality", audioBitrate)
+	}
+	return args
+}
+
+// mergeArgs 返回 yt-dlp 合并音视频相关的参数
+func (mpd *MultiPlatformDownloader) mergeArgs() []string {
+	if !ffmpegAvailable(mpd.config.FfmpegPath) {
+		return nil
+	}
+
+	var args []string
+	// 系统PATH中的ffmpeg由yt-dlp自行查找
+	if path := ffmpegPath(mpd.config.FfmpegPath); path != "ffmpeg" {
+		args = append(args, "--ffmpeg-location", path)
+	}
+	if len(mpd.config.PreferredContainers) > 0 {
+		args = append(args, "--merge-output-format", strings.Join(mpd.config.PreferredContainers, "/"))
+	}
+	return args
 }
 
 func (mpd *MultiPlatformDownloader) IsDownloaded(videoID string) bool {
@@ -459,12 +665,11 @@ func (mpd *MultiPlatformDownloader) IsDownloaded(videoID string) bool {
 }
 
 func (mpd *MultiPlatformDownloader) MarkDownloaded(videoID string) error {
-	mpd.indexer.MarkDownloaded(videoID)
-	return nil
+	return mpd.indexer.MarkDownloaded(videoID)
 }
 
 // downloadDouyinVideo 专门处理抖音视频的下载，不依赖 yt-dlp
-func (mpd *MultiPlatformDownloader) downloadDouyinVideo(url, outputDir string) (*DownloadResult, error) {
+func (mpd *MultiPlatformDownloader) downloadDouyinVideo(ctx context.Context, url, outputDir string) (*DownloadResult, error) {
 	log.Printf("[调试] 开始处理抖音视频下载: %s", url)
 
 	// 确保输出目录存在
@@ -473,17 +678,24 @@ func (mpd *MultiPlatformDownloader) downloadDouyinVideo(url, outputDir string) (
 	}
 
 	// 提取视频ID
-	videoID := ""
-	match := regexp.MustCompile(`douyin\.com/video/(\d+)`).FindStringSubmatch(url)
-	if len(match) > 1 {
-		videoID = match[1]
-		log.Printf("[调试] 提取到视频ID: %s", videoID)
-	} else {
+	videoID := utils.MatchURL(url).ID
+	if videoID == "" {
 		return nil, fmt.Errorf("无法提取视频ID")
 	}
+	log.Printf("[调试] 提取到视频ID: %s", videoID)
+
+	// 音频模式先下载视频再用ffmpeg提取音频，与视频分别记录在索引中
+	opts := optionsFromContext(ctx)
+	indexKey := videoID
+	if opts.AudioOnly {
+		indexKey = indexer.AudioKey(videoID)
+		if !ffmpegAvailable(mpd.config.FfmpegPath) {
+			return nil, fmt.Errorf("音频模式需要ffmpeg提取抖音视频的音频: %w", ErrToolMissing)
+		}
+	}
 
 	// 检查是否已经下载过
-	if mpd.indexer.IsDownloaded(videoID) {
+	if mpd.indexer.IsDownloaded(indexKey) {
 		log.Printf("[调试] 视频已下载: %s", videoID)
 		return &DownloadResult{
 			Success:    false,
@@ -491,7 +703,7 @@ func (mpd *MultiPlatformDownloader) downloadDouyinVideo(url, outputDir string) (
 			Title:      "",
 			FilePath:   "",
 			FileSize:   0,
-			Error:      fmt.Errorf("视频已下载"),
+			Error:      ErrAlreadyDownloaded,
 			RetryCount: 0,
 		}, nil
 	}
@@ -509,7 +721,7 @@ func (mpd *MultiPlatformDownloader) downloadDouyinVideo(url, outputDir string) (
 	}
 
 	// 构建请求
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("创建请求失败: %w", err)
 	}
@@ -539,26 +751,42 @@ func (mpd *MultiPlatformDownloader) downloadDouyinVideo(url, outputDir string) (
 		Timeout: 30 * time.Second,
 	}
 
+	// 先下载到只由视频ID决定的文件，中断后重试或下次运行时从已下载的部分继续，完成后再重命名
+	partialPath := filepath.Join(outputDir, partialFileName("douyin", videoID, "", ".mp4"))
+	filePath := filepath.Join(outputDir, fmt.Sprintf("douyin_%s_%d.mp4", videoID, time.Now().Unix()))
+
 	var lastErr error
-	for retry := 0; retry < mpd.config.MaxRetries; retry++ {
+	policy := NewRetryPolicy(mpd.config, "douyin")
+	attempts := 0
+	for retry := 0; retry < policy.MaxAttempts; retry++ {
 		if retry > 0 {
-			delay := mpd.config.BaseRetryDelay * time.Duration(retry)
-			log.Printf("[调试] 重试 %d/%d，等待 %v 后重试...", retry, mpd.config.MaxRetries, delay)
-			time.Sleep(delay)
+			delay, ok := policy.Next(lastErr, retry)
+			if !ok {
+				log.Printf("[调试] 错误不可重试，放弃下载: %v", lastErr)
+				break
+			}
+			log.Printf("[调试] 重试 %d/%d，等待 %v 后重试...", retry, policy.MaxAttempts, delay)
+			if err := utils.SleepContext(ctx, delay); err != nil {
+				return nil, fmt.Errorf("下载已取消: %w", err)
+			}
 		}
+		attempts++
 
 		log.Printf("[调试] 发送请求获取抖音视频页面...")
 		response, err := client.Do(req)
 		if err != nil {
-			lastErr = err
-			log.Printf("[调试] 请求失败 (尝试 %d/%d): %v", retry+1, mpd.config.MaxRetries, err)
+			if ctx.Err() != nil {
+				return nil, fmt.Errorf("下载已取消: %w", ctx.Err())
+			}
+			lastErr = classifyError(err)
+			log.Printf("[调试] 请求失败 (尝试 %d/%d): %v", retry+1, policy.MaxAttempts, err)
 			continue
 		}
 
 		defer response.Body.Close()
 
 		if response.StatusCode != http.StatusOK {
-			lastErr = fmt.Errorf("请求失败，状态码: %d", response.StatusCode)
+			lastErr = newStatusError(response)
 			log.Printf("[调试] 请求失败，状态码: %d", response.StatusCode)
 			continue
 		}
@@ -566,7 +794,7 @@ func (mpd *MultiPlatformDownloader) downloadDouyinVideo(url, outputDir string) (
 		// 读取响应内容
 		body, err := ioutil.ReadAll(response.Body)
 		if err != nil {
-			lastErr = err
+			lastErr = classifyError(err)
 			log.Printf("[调试] 读取响应失败: %v", err)
 			continue
 		}
@@ -588,21 +816,40 @@ func (mpd *MultiPlatformDownloader) downloadDouyinVideo(url, outputDir string) (
 
 		log.Printf("[调试] 找到视频URL: %s", videoURL)
 
-		// 生成文件名
-		filename := fmt.Sprintf("douyin_%s_%d.mp4", videoID, time.Now().Unix())
-		filePath := filepath.Join(outputDir, filename)
-
 		// 下载视频
-		log.Printf("[调试] 开始下载视频到: %s", filePath)
-		fileSize, err := mpd.downloadFile(videoURL, filePath)
+		log.Printf("[调试] 开始下载视频到: %s", partialPath)
+		fileSize, err := mpd.downloadFile(ctx, videoURL, partialPath, videoID)
 		if err != nil {
-			lastErr = err
+			if ctx.Err() != nil {
+				// 保留 .part 文件，下次运行时继续下载
+				return nil, fmt.Errorf("下载已取消: %w", ctx.Err())
+			}
+			lastErr = classifyError(err)
 			log.Printf("[调试] 下载视频失败: %v", err)
 			continue
 		}
+		if err := os.Rename(partialPath, filePath); err != nil {
+			return nil, fmt.Errorf("重命名下载文件失败: %w", err)
+		}
+
+		if opts.AudioOnly {
+			audioPath, err := mpd.extractAudio(ctx, filePath, opts)
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil, fmt.Errorf("下载已取消: %w", ctx.Err())
+				}
+				return nil, err
+			}
+			filePath = audioPath
+			if info, err := os.Stat(filePath); err == nil {
+				fileSize = info.Size()
+			}
+		}
 
 		// 标记为已下载
-		mpd.indexer.MarkDownloaded(videoID)
+		if err := mpd.indexer.AddRecord(newIndexRecord(indexKey, "douyin", url, fmt.Sprintf("抖音视频_%s", videoID), filePath, mpd.Name())); err != nil {
+			log.Printf("写入下载索引失败: %v", err)
+		}
 
 		log.Printf("[调试] 抖音视频下载成功: %s", filePath)
 		return &DownloadResult{
@@ -616,7 +863,25 @@ func (mpd *MultiPlatformDownloader) downloadDouyinVideo(url, outputDir string) (
 		}, nil
 	}
 
-	return nil, fmt.Errorf("下载抖音视频失败: %w (尝试 %d 次后放弃)", lastErr, mpd.config.MaxRetries)
+	return nil, fmt.Errorf("下载抖音视频失败: %w", &RetryError{Attempts: attempts, Err: lastErr})
+}
+
+// extractAudio 从下载的视频中提取音频，成功后删除视频文件，返回音频文件路径
+// 未配置音频格式时提取为 m4a
+func (mpd *MultiPlatformDownloader) extractAudio(ctx context.Context, videoPath string, opts Options) (string, error) {
+	audioFormat, audioBitrate := audioSettings(mpd.config, opts)
+	if audioFormat == "" {
+		audioFormat = "m4a"
+	}
+
+	audioPath := strings.TrimSuffix(videoPath, filepath.Ext(videoPath)) + "." + audioFormat
+	if err := transcodeAudio(ctx, mpd.config.FfmpegPath, videoPath, audioPath, audioFormat, audioBitrate); err != nil {
+		return "", err
+	}
+	if err := os.Remove(videoPath); err != nil {
+		log.Printf("[调试] 删除视频文件失败: %v", err)
+	}
+	return audioPath, nil
 }
 
 // parseCookieFile 解析Netscape格式的cookie文件
@@ -702,47 +967,29 @@ func (mpd *MultiPlatformDownloader) extractVideoURLFromResponse(body string) str
 	return ""
 }
 
-// downloadFile 下载文件
-func (mpd *MultiPlatformDownloader) downloadFile(url, filePath string) (int64, error) {
-	// 构建请求
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return 0, err
-	}
-
+// downloadFile 下载文件，支持分段并发下载和断点续传
+// 数据先写入 .part 临时文件，再次调用时通过 Range 请求从已下载的位置继续
+func (mpd *MultiPlatformDownloader) downloadFile(ctx context.Context, url, filePath, videoID string) (int64, error) {
 	// 添加请求头
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
-	req.Header.Set("Referer", "https://www.douyin.com/")
+	header := http.Header{}
+	header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
+	header.Set("Referer", "https://www.douyin.com/")
 
-	// 发送请求
+	// 每个分块单独请求，超时只作用于单个分块
 	client := &http.Client{
 		Timeout: 60 * time.Second,
 	}
 
-	response, err := client.Do(req)
-	if err != nil {
-		return 0, err
-	}
-
-	defer response.Body.Close()
-
-	if response.StatusCode != http.StatusOK {
-		return 0, fmt.Errorf("请求失败，状态码: %d", response.StatusCode)
-	}
-
-	// 创建文件
-	file, err := os.Create(filePath)
-	if err != nil {
-		return 0, err
-	}
-
-	defer file.Close()
-
-	// 复制内容
-	fileSize, err := io.Copy(file, response.Body)
+	// 下载内容，同时上报进度
+	tracker := newProgressTracker(ctx, videoID, fmt.Sprintf("抖音视频_%s", videoID))
+	sd := newSegmentedDownloader(client, header, mpd.config.DownloadSegments, 10*1024*1024)
+	fileSize, err := sd.Download(ctx, url, filePath, 0, func(current, total int64) {
+		tracker.Update(current, total)
+	})
 	if err != nil {
 		return 0, err
 	}
+	tracker.Finish(fileSize, fileSize)
 
 	return fileSize, nil
 }
@@ -865,7 +1112,7 @@ func (mpd *MultiPlatformDownloader) CheckYTDLP() error {
 
 	cmd := exec.Command(ytDlpPath, "--version")
 	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("yt-dlp未安装，请先安装并配置到PATH中或放在当前目录下（多平台下载依赖）")
+		return fmt.Errorf("yt-dlp未安装，请先安装并配置到PATH中或放在当前目录下（多平台下载依赖）: %w", ErrToolMissing)
 	}
 	return nil
 }
@@ -0,0 +1,299 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"batch_download_videos/config"
+)
+
+// Options 单个URL的下载选项，可在URL文件中跟在URL后面指定，也可由命令行参数设置默认值
+// 字段为空时使用配置文件中的值
+type Options struct {
+	// AudioOnly 只下载音频
+	AudioOnly bool `json:"audio_only,omitempty"`
+	// AudioFormat 音频转码的目标格式（mp3/m4a/opus），为空时保留原始格式
+	AudioFormat string `json:"audio_format,omitempty"`
+	// AudioBitrate 音频转码的比特率，例如 192k
+	AudioBitrate string `json:"audio_bitrate,omitempty"`
+	// SubtitleLangs 下载的字幕语言，为空时使用配置文件中的 subtitle_langs
+	SubtitleLangs []string `json:"subtitle_langs,omitempty"`
+	// NoSubtitles 不下载字幕（覆盖配置文件）
+	NoSubtitles bool `json:"no_subtitles,omitempty"`
+	// EmbedSubtitles 将字幕嵌入到视频文件中
+	EmbedSubtitles bool `json:"embed_subtitles,omitempty"`
+	// PlaylistStart、PlaylistEnd 播放列表和频道按原始顺序的下载范围，从 1 开始，包含两端，0 表示不限制
+	PlaylistStart int `json:"playlist_start,omitempty"`
+	PlaylistEnd   int `json:"playlist_end,omitempty"`
+	// MaxItems 播放列表和频道最多下载的视频数，0 表示不限制（频道默认为最新的 10 个）
+	MaxItems int `json:"max_items,omitempty"`
+	// Reverse 按相反的顺序选取播放列表和频道中的视频（频道为从最早的视频开始）
+	Reverse bool `json:"reverse,omitempty"`
+	// DateAfter、DateBefore 只下载在该日期当天或之后/之前上传的视频，格式为 YYYYMMDD
+	DateAfter  string `json:"date_after,omitempty"`
+	DateBefore string `json:"date_before,omitempty"`
+	// StopAtIndexed 遇到第一个已下载的视频时停止，不再检查后面（更早）的视频，用于增量同步频道
+	// 与 Reverse 同时使用时不生效，见 stopAtIndexed
+	StopAtIndexed bool `json:"stop_at_indexed,omitempty"`
+}
+
+// stopAtIndexed 判断是否在遇到第一个已下载的视频时停止
+// 反转顺序时从最早的视频开始，遇到的第一个已下载视频之后还有新视频，停止会使增量同步什么也不下载，因此忽略
+func (opts Options) stopAtIndexed() bool {
+	return opts.StopAtIndexed && !opts.Reverse
+}
+
+// DefaultOptions 返回配置文件中的播放列表和频道选项，作为URL文件中下载选项的默认值
+func DefaultOptions(cfg *config.Config) (Options, error) {
+	opts := Options{
+		PlaylistStart: cfg.PlaylistStart,
+		PlaylistEnd:   cfg.PlaylistEnd,
+		StopAtIndexed: cfg.StopAtIndexed,
+	}
+	if opts.PlaylistStart < 0 || opts.PlaylistEnd < 0 || (opts.PlaylistEnd > 0 && opts.PlaylistStart > opts.PlaylistEnd) {
+		return Options{}, fmt.Errorf("playlist_start/playlist_end 范围无效: %d-%d", cfg.PlaylistStart, cfg.PlaylistEnd)
+	}
+	if cfg.PlaylistOrder != "" {
+		reverse, err := parseOrder(cfg.PlaylistOrder)
+		if err != nil {
+			return Options{}, err
+		}
+		opts.Reverse = reverse
+	}
+
+	var err error
+	now := time.Now()
+	if cfg.DateAfter != "" {
+		if opts.DateAfter, err = parseDate(cfg.DateAfter, now); err != nil {
+			return Options{}, fmt.Errorf("date_after 无效: %w", err)
+		}
+	}
+	if cfg.DateBefore != "" {
+		if opts.DateBefore, err = parseDate(cfg.DateBefore, now); err != nil {
+			return Options{}, fmt.Errorf("date_before 无效: %w", err)
+		}
+	}
+	return opts, nil
+}
+
+// audioFormats 支持转码的音频格式
+var audioFormats = map[string]bool{
+	"mp3":  true,
+	"m4a":  true,
+	"opus": true,
+}
+
+// ParseOptions 解析URL后面的选项，在 base 的基础上覆盖
+// 支持的写法：
+//
+//	audio              只下载音频
+//	audio=mp3          只下载音频并转码为 mp3
+//	audio-bitrate=128k 音频转码比特率
+//	video              下载视频（覆盖命令行的音频模式）
+//	subs=en,zh-Hans    下载指定语言的字幕
+//	no-subs            不下载字幕
+//	embed-subs         将字幕嵌入到视频文件中
+//	limit=20           播放列表和频道最多下载 20 个视频
+//	range=5-20         只下载播放列表和频道中的第 5 到 20 个视频，也可以写 5- 或 -20
+//	order=reverse      按相反的顺序选取（order=default 恢复原始顺序），也可以写 order=oldest/newest
+//	after=20240101     只下载在该日期当天或之后上传的视频，也可以写 today-7days 这样的相对日期
+//	before=20241231    只下载在该日期当天或之前上传的视频
+//	stop-at-indexed    遇到第一个已下载的视频时停止（stop-at-indexed=false 关闭），order=reverse 时不生效
+func ParseOptions(base Options, args []string) (Options, error) {
+	opts := base
+	for _, arg := range args {
+		key, value, hasValue := strings.Cut(arg, "=")
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "audio":
+			opts.AudioOnly = true
+			if hasValue && value != "" {
+				format := strings.ToLower(value)
+				if !audioFormats[format] {
+					return base, fmt.Errorf("不支持的音频格式: %s (支持: mp3/m4a/opus)", value)
+				}
+				opts.AudioFormat = format
+			}
+		case "audio-bitrate":
+			if value == "" {
+				return base, fmt.Errorf("audio-bitrate 需要指定比特率")
+			}
+			opts.AudioBitrate = value
+		case "video":
+			opts.AudioOnly = false
+		case "subs":
+			langs := splitLangs(value)
+			if len(langs) == 0 {
+				return base, fmt.Errorf("subs 需要指定字幕语言，例如 subs=en,zh-Hans")
+			}
+			opts.SubtitleLangs = langs
+			opts.NoSubtitles = false
+		case "no-subs":
+			opts.SubtitleLangs = nil
+			opts.NoSubtitles = true
+			opts.EmbedSubtitles = false
+		case "embed-subs":
+			opts.EmbedSubtitles = true
+			opts.NoSubtitles = false
+		case "limit":
+			limit, err := strconv.Atoi(value)
+			if err != nil || limit <= 0 {
+				return base, fmt.Errorf("limit 需要指定正整数，例如 limit=20")
+			}
+			opts.MaxItems = limit
+		case "range":
+			start, end, err := parseRange(value)
+			if err != nil {
+				return base, err
+			}
+			opts.PlaylistStart, opts.PlaylistEnd = start, end
+		case "order":
+			reverse, err := parseOrder(value)
+			if err != nil {
+				return base, err
+			}
+			opts.Reverse = reverse
+		case "after", "before":
+			date, err := parseDate(value, time.Now())
+			if err != nil {
+				return base, fmt.Errorf("%s 无效: %w", key, err)
+			}
+			if key == "after" {
+				opts.DateAfter = date
+			} else {
+				opts.DateBefore = date
+			}
+		case "stop-at-indexed":
+			stop := true
+			if hasValue {
+				var err error
+				if stop, err = strconv.ParseBool(value); err != nil {
+					return base, fmt.Errorf("stop-at-indexed 只能是 true 或 false: %s", value)
+				}
+			}
+			opts.StopAtIndexed = stop
+		default:
+			return base, fmt.Errorf("未知的选项: %s", arg)
+		}
+	}
+	return opts, nil
+}
+
+// parseOrder 解析播放列表和频道的顺序，返回是否反转原始顺序
+// 频道的原始顺序为从新到旧，newest 与 default 相同，oldest 与 reverse 相同
+func parseOrder(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "default", "newest":
+		return false, nil
+	case "reverse", "oldest":
+		return true, nil
+	default:
+		return false, fmt.Errorf("不支持的顺序: %s (支持: default/reverse/newest/oldest)", value)
+	}
+}
+
+// relativeDatePattern 相对日期，例如 today-7days、now-2weeks
+var relativeDatePattern = regexp.MustCompile(`^(?:today|now)(?:-(\d+)(day|week|month|year)s?)?$`)
+
+// parseDate 解析 YYYYMMDD 格式的日期或相对于 now 的日期（today、today-7days、now-1month），返回 YYYYMMDD
+func parseDate(value string, now time.Time) (string, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if date, err := time.Parse("20060102", value); err == nil {
+		return date.Format("20060102"), nil
+	}
+
+	match := relativeDatePattern.FindStringSubmatch(value)
+	if match == nil {
+		return "", fmt.Errorf("日期格式无效: %s (例如 20240101、today-7days)", value)
+	}
+	if match[1] != "" {
+		n, _ := strconv.Atoi(match[1])
+		switch match[2] {
+		case "day":
+			now = now.AddDate(0, 0, -n)
+		case "week":
+			now = now.AddDate(0, 0, -7*n)
+		case "month":
+			now = now.AddDate(0, -n, 0)
+		case "year":
+			now = now.AddDate(-n, 0, 0)
+		}
+	}
+	return now.Format("20060102"), nil
+}
+
+// parseRange 解析 "5-20"、"5-"、"-20" 或 "5" 形式的范围，缺省的一端返回 0
+func parseRange(value string) (start, end int, err error) {
+	invalid := fmt.Errorf("range 格式无效: %s (例如 range=5-20、range=5-、range=-20)", value)
+	first, last, hasDash := strings.Cut(value, "-")
+	if !hasDash {
+		last = first
+	}
+	if first == "" && last == "" {
+		return 0, 0, invalid
+	}
+	if first != "" {
+		if start, err = strconv.Atoi(first); err != nil || start <= 0 {
+			return 0, 0, invalid
+		}
+	}
+	if last != "" {
+		if end, err = strconv.Atoi(last); err != nil || end <= 0 {
+			return 0, 0, invalid
+		}
+	}
+	if end > 0 && start > end {
+		return 0, 0, invalid
+	}
+	return start, end, nil
+}
+
+// splitLangs 解析逗号分隔的语言列表，忽略空项
+func splitLangs(value string) []string {
+	var langs []string
+	for _, lang := range strings.Split(value, ",") {
+		if lang = strings.TrimSpace(lang); lang != "" {
+			langs = append(langs, lang)
+		}
+	}
+	return langs
+}
+
+// ValidateAudioFormat 检查音频格式是否支持，空字符串表示保留原始格式
+func ValidateAudioFormat(format string) error {
+	if format != "" && !audioFormats[strings.ToLower(format)] {
+		return fmt.Errorf("不支持的音频格式: %s (支持: mp3/m4a/opus)", format)
+	}
+	return nil
+}
+
+type optionsKey struct{}
+
+// WithOptions 返回携带下载选项的 ctx，传给 DownloadContext 后下载器会按选项下载
+func WithOptions(ctx context.Context, opts Options) context.Context {
+	return context.WithValue(ctx, optionsKey{}, opts)
+}
+
+// optionsFromContext 取出 ctx 中的下载选项，没有时返回零值
+func optionsFromContext(ctx context.Context) Options {
+	opts, _ := ctx.Value(optionsKey{}).(Options)
+	return opts
+}
+
+// audioSettings 返回音频转码的格式和比特率，选项中未指定时使用配置文件中的值
+func audioSettings(cfg *config.Config, opts Options) (format, bitrate string) {
+	format, bitrate = cfg.AudioFormat, cfg.AudioBitrate
+	if opts.AudioFormat != "" {
+		format = opts.AudioFormat
+	}
+	if opts.AudioBitrate != "" {
+		bitrate = opts.AudioBitrate
+	}
+	return strings.ToLower(format), bitrate
+}
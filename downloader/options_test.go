@@ -0,0 +1,95 @@
+package downloader
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"batch_download_videos/config"
+)
+
+func TestParseOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		base    Options
+		args    []string
+		want    Options
+		wantErr bool
+	}{
+		{"no options", Options{}, nil, Options{}, false},
+		{"audio", Options{}, []string{"audio"}, Options{AudioOnly: true}, false},
+		{"audio format", Options{}, []string{"audio=MP3", "audio-bitrate=128k"}, Options{AudioOnly: true, AudioFormat: "mp3", AudioBitrate: "128k"}, false},
+		{"video overrides default", Options{AudioOnly: true}, []string{"video"}, Options{}, false},
+		{"subtitles", Options{}, []string{"subs=en, zh-Hans", "embed-subs"}, Options{SubtitleLangs: []string{"en", "zh-Hans"}, EmbedSubtitles: true}, false},
+		{"no subtitles", Options{EmbedSubtitles: true}, []string{"no-subs"}, Options{NoSubtitles: true}, false},
+		{"missing subtitle langs", Options{}, []string{"subs="}, Options{}, true},
+		{"unsupported format", Options{}, []string{"audio=wav"}, Options{}, true},
+		{"missing bitrate", Options{}, []string{"audio-bitrate="}, Options{}, true},
+		{"playlist selection", Options{}, []string{"limit=20", "range=5-30", "order=reverse"}, Options{MaxItems: 20, PlaylistStart: 5, PlaylistEnd: 30, Reverse: true}, false},
+		{"open range", Options{Reverse: true}, []string{"range=-8", "order=default"}, Options{PlaylistEnd: 8}, false},
+		{"invalid limit", Options{}, []string{"limit=0"}, Options{}, true},
+		{"invalid range", Options{}, []string{"range=9-3"}, Options{}, true},
+		{"invalid order", Options{}, []string{"order=random"}, Options{}, true},
+		{"incremental sync", Options{}, []string{"order=oldest", "after=20240101", "before=20241231", "stop-at-indexed"}, Options{Reverse: true, DateAfter: "20240101", DateBefore: "20241231", StopAtIndexed: true}, false},
+		{"disable stop at indexed", Options{StopAtIndexed: true}, []string{"stop-at-indexed=false", "order=newest"}, Options{}, false},
+		{"invalid date", Options{}, []string{"after=2024-01-01"}, Options{}, true},
+		{"unknown option", Options{}, []string{"foo"}, Options{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseOptions(tt.base, tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseOptions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseOptions() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	now := time.Date(2024, 3, 15, 10, 0, 0, 0, time.Local)
+	tests := map[string]string{
+		"20240101":     "20240101",
+		"today":        "20240315",
+		"today-7days":  "20240308",
+		"now-2weeks":   "20240301",
+		"today-1month": "20240215",
+		"today-1year":  "20230315",
+		"TODAY-1DAY":   "20240314",
+	}
+	for in, want := range tests {
+		if got, err := parseDate(in, now); err != nil || got != want {
+			t.Errorf("parseDate(%q) = %q, %v, want %q", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "2024-01-01", "20241301", "yesterday", "today+1day"} {
+		if _, err := parseDate(in, now); err == nil {
+			t.Errorf("parseDate(%q) error = nil, want error", in)
+		}
+	}
+}
+
+func TestDefaultOptions(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.PlaylistStart = 2
+	cfg.PlaylistOrder = "oldest"
+	cfg.DateAfter = "20240101"
+	cfg.StopAtIndexed = true
+
+	opts, err := DefaultOptions(cfg)
+	if err != nil {
+		t.Fatalf("DefaultOptions() error = %v", err)
+	}
+	want := Options{PlaylistStart: 2, Reverse: true, DateAfter: "20240101", StopAtIndexed: true}
+	if !reflect.DeepEqual(opts, want) {
+		t.Errorf("DefaultOptions() = %+v, want %+v", opts, want)
+	}
+
+	cfg.PlaylistOrder = "random"
+	if _, err := DefaultOptions(cfg); err == nil {
+		t.Errorf("DefaultOptions() with invalid order error = nil, want error")
+	}
+}
@@ -0,0 +1,216 @@
+package downloader
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"batch_download_videos/config"
+	"batch_download_videos/utils"
+)
+
+// PlaylistItem 播放列表或频道中的一个视频
+type PlaylistItem struct {
+	ID    string
+	Title string
+	URL   string
+	// UploadDate 上传日期，格式为 YYYYMMDD，列表中没有时为空
+	UploadDate string
+}
+
+// Expander 能把播放列表和频道展开为单个视频的下载器
+// 调度器把展开得到的每个视频作为单独的任务下载，分别检查索引、重试和记录结果
+type Expander interface {
+	// ExpandContext 返回 url 中按 ctx 携带的下载选项（范围、数量、顺序）选取的视频；
+	// url 不是该下载器能展开的播放列表或频道时 ok 为 false
+	ExpandContext(ctx context.Context, url string) (items []PlaylistItem, ok bool, err error)
+}
+
+// ChannelLister 列出频道中的视频，按从新到旧的顺序返回
+type ChannelLister interface {
+	// ListChannel 返回频道最新的 max 个视频，max 为 0 时返回全部
+	ListChannel(ctx context.Context, channelURL string, max int) ([]PlaylistItem, error)
+}
+
+// itemFilter 判断是否选取视频；stop 为 true 时不再检查后面的视频
+type itemFilter func(item PlaylistItem) (keep, stop bool, err error)
+
+// collectionOptions 没有指定数量和范围时，使用配置文件中播放列表或频道的默认数量
+func collectionOptions(cfg *config.Config, opts Options, kind utils.ContentKind) Options {
+	if opts.MaxItems == 0 && opts.PlaylistEnd == 0 {
+		if kind == utils.KindChannel {
+			opts.MaxItems = cfg.ChannelMaxItems
+		} else {
+			opts.MaxItems = cfg.PlaylistMaxItems
+		}
+	}
+	return opts
+}
+
+// selectItems 按选项选取视频：先按原始顺序取 [PlaylistStart, PlaylistEnd] 范围，
+// 需要时反转顺序，再依次用 filter 筛选，最多取 MaxItems 个
+func selectItems(items []PlaylistItem, opts Options, filter itemFilter) ([]PlaylistItem, error) {
+	start, end := 0, len(items)
+	if opts.PlaylistStart > 1 {
+		start = min(opts.PlaylistStart-1, len(items))
+	}
+	if opts.PlaylistEnd > 0 {
+		end = min(opts.PlaylistEnd, len(items))
+	}
+	if start >= end {
+		return nil, nil
+	}
+
+	candidates := slices.Clone(items[start:end])
+	if opts.Reverse {
+		slices.Reverse(candidates)
+	}
+
+	var selected []PlaylistItem
+	for _, item := range candidates {
+		if opts.MaxItems > 0 && len(selected) >= opts.MaxItems {
+			break
+		}
+		if filter != nil {
+			keep, stop, err := filter(item)
+			if err != nil {
+				return selected, err
+			}
+			if stop {
+				break
+			}
+			if !keep {
+				continue
+			}
+		}
+		selected = append(selected, item)
+	}
+	return selected, nil
+}
+
+// listBound 返回按选项选取视频时需要从列表开头读取的视频数，0 表示需要完整的列表
+// 反转顺序或按日期跳过视频时，无法预先确定需要读取的数量
+func listBound(opts Options) int {
+	if opts.Reverse || opts.MaxItems == 0 || opts.DateAfter != "" || opts.DateBefore != "" {
+		return opts.PlaylistEnd
+	}
+	bound := max(opts.PlaylistStart, 1) + opts.MaxItems - 1
+	if opts.PlaylistEnd > 0 {
+		bound = min(bound, opts.PlaylistEnd)
+	}
+	return bound
+}
+
+// ytDlpCollectionArgs 返回 yt-dlp 下载播放列表和频道时的范围、数量、日期和顺序参数
+func ytDlpCollectionArgs(cfg *config.Config, opts Options, kind utils.ContentKind) []string {
+	opts = collectionOptions(cfg, opts, kind)
+
+	var args []string
+	if opts.PlaylistStart > 1 {
+		args = append(args, "--playlist-start", strconv.Itoa(opts.PlaylistStart))
+	}
+	if bound := listBound(opts); bound > 0 {
+		args = append(args, "--playlist-end", strconv.Itoa(bound))
+	}
+	if opts.MaxItems > 0 {
+		args = append(args, "--max-downloads", strconv.Itoa(opts.MaxItems))
+	}
+	if opts.Reverse {
+		args = append(args, "--playlist-reverse")
+	}
+	if opts.DateAfter != "" {
+		args = append(args, "--dateafter", opts.DateAfter)
+		// 频道从新到旧排列，遇到第一个早于 DateAfter 的视频后，后面的视频都更早
+		if kind == utils.KindChannel && !opts.Reverse {
+			args = append(args, "--break-match-filters", "upload_date>="+opts.DateAfter)
+		}
+	}
+	if opts.DateBefore != "" {
+		args = append(args, "--datebefore", opts.DateBefore)
+	}
+	if opts.stopAtIndexed() {
+		// 下载存档已包含索引中的记录，遇到存档中的视频即停止
+		args = append(args, "--break-on-existing")
+	}
+	return args
+}
+
+// YtDlpChannelLister 使用 yt-dlp 的 --flat-playlist 列出频道中的视频，只读取列表，不下载
+type YtDlpChannelLister struct {
+	// Path yt-dlp 可执行文件
+	Path       string
+	Proxy      string
+	CookieFile string
+}
+
+// NewYtDlpChannelLister 创建使用配置文件中的代理和Cookie的频道列表读取器
+func NewYtDlpChannelLister(cfg *config.Config) *YtDlpChannelLister {
+	// 优先使用当前目录下的yt-dlp.exe，不存在时使用系统PATH中的yt-dlp
+	ytDlpPath := "./yt-dlp.exe"
+	if _, err := os.Stat(ytDlpPath); os.IsNotExist(err) {
+		ytDlpPath = "yt-dlp"
+	}
+	return &YtDlpChannelLister{Path: ytDlpPath, Proxy: cfg.Proxy, CookieFile: cfg.CookieFile}
+}
+
+// ListChannel 返回频道最新的 max 个视频，max 为 0 时返回全部
+func (l *YtDlpChannelLister) ListChannel(ctx context.Context, channelURL string, max int) ([]PlaylistItem, error) {
+	args := []string{
+		"--flat-playlist",
+		"--no-warnings",
+		"--print", "%(id)s\t%(upload_date)s\t%(url)s\t%(title)s",
+	}
+	if max > 0 {
+		args = append(args, "--playlist-end", strconv.Itoa(max))
+	}
+	if l.Proxy != "" {
+		args = append(args, "--proxy", l.Proxy)
+	}
+	if l.CookieFile != "" {
+		if _, err := os.Stat(l.CookieFile); err == nil {
+			args = append(args, "--cookies", l.CookieFile)
+		}
+	}
+	args = append(args, channelURL)
+
+	var stdout, stderr bytes.Buffer
+	cmd := ytDlpCommand(ctx, l.Path, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("读取频道视频列表已取消: %w", ctx.Err())
+		}
+		return nil, fmt.Errorf("读取频道视频列表失败: %w, 错误信息: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return parseFlatPlaylist(stdout.Bytes()), nil
+}
+
+// parseFlatPlaylist 解析 yt-dlp --print "%(id)s\t%(upload_date)s\t%(url)s\t%(title)s" 的输出，yt-dlp 用 NA 表示缺少的字段
+func parseFlatPlaylist(output []byte) []PlaylistItem {
+	var items []PlaylistItem
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.SplitN(strings.TrimSpace(scanner.Text()), "\t", 4)
+		if len(fields) < 3 || fields[0] == "" || fields[0] == "NA" {
+			continue
+		}
+		item := PlaylistItem{ID: fields[0]}
+		if fields[1] != "NA" {
+			item.UploadDate = fields[1]
+		}
+		if fields[2] != "NA" {
+			item.URL = fields[2]
+		}
+		if len(fields) == 4 && fields[3] != "NA" {
+			item.Title = fields[3]
+		}
+		items = append(items, item)
+	}
+	return items
+}
@@ -0,0 +1,248 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"batch_download_videos/config"
+	"batch_download_videos/indexer"
+	"batch_download_videos/utils"
+)
+
+func playlistItems(ids ...string) []PlaylistItem {
+	items := make([]PlaylistItem, len(ids))
+	for i, id := range ids {
+		items[i] = PlaylistItem{ID: id}
+	}
+	return items
+}
+
+func itemIDs(items []PlaylistItem) []string {
+	ids := []string{}
+	for _, item := range items {
+		ids = append(ids, item.ID)
+	}
+	return ids
+}
+
+func TestSelectItems(t *testing.T) {
+	items := playlistItems("1", "2", "3", "4", "5", "6")
+
+	tests := []struct {
+		name  string
+		opts  Options
+		want  []string
+		bound int
+	}{
+		{"all", Options{}, []string{"1", "2", "3", "4", "5", "6"}, 0},
+		{"limit", Options{MaxItems: 2}, []string{"1", "2"}, 2},
+		{"range", Options{PlaylistStart: 2, PlaylistEnd: 4}, []string{"2", "3", "4"}, 4},
+		{"range and limit", Options{PlaylistStart: 3, MaxItems: 2}, []string{"3", "4"}, 4},
+		{"reverse", Options{Reverse: true, MaxItems: 2}, []string{"6", "5"}, 0},
+		{"reverse range", Options{Reverse: true, PlaylistEnd: 3}, []string{"3", "2", "1"}, 3},
+		{"range past end", Options{PlaylistStart: 8}, []string{}, 0},
+		{"date window", Options{MaxItems: 2, DateAfter: "20240101"}, []string{"1", "2"}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selected, err := selectItems(items, tt.opts, nil)
+			if err != nil {
+				t.Fatalf("selectItems() error = %v", err)
+			}
+			if got := itemIDs(selected); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("selectItems() = %v, want %v", got, tt.want)
+			}
+			if got := listBound(tt.opts); got != tt.bound {
+				t.Errorf("listBound() = %d, want %d", got, tt.bound)
+			}
+		})
+	}
+}
+
+func TestSelectItemsFilter(t *testing.T) {
+	items := playlistItems("1", "2", "3", "4", "5", "6")
+
+	// 跳过 2，遇到 5 时停止，filter 跳过的视频不计入数量
+	filter := func(item PlaylistItem) (bool, bool, error) {
+		return item.ID != "2", item.ID == "5", nil
+	}
+	selected, err := selectItems(items, Options{}, filter)
+	if err != nil {
+		t.Fatalf("selectItems() error = %v", err)
+	}
+	if got := itemIDs(selected); !reflect.DeepEqual(got, []string{"1", "3", "4"}) {
+		t.Errorf("selectItems() = %v, want [1 3 4]", got)
+	}
+
+	selected, _ = selectItems(items, Options{MaxItems: 2}, filter)
+	if got := itemIDs(selected); !reflect.DeepEqual(got, []string{"1", "3"}) {
+		t.Errorf("selectItems() with limit = %v, want [1 3]", got)
+	}
+}
+
+func TestYtDlpCollectionArgs(t *testing.T) {
+	cfg := config.DefaultConfig()
+	tests := []struct {
+		name string
+		opts Options
+		kind utils.ContentKind
+		want []string
+	}{
+		{"channel default", Options{}, utils.KindChannel, []string{"--playlist-end", "10", "--max-downloads", "10"}},
+		{"playlist default", Options{}, utils.KindPlaylist, nil},
+		{"range", Options{PlaylistStart: 5, PlaylistEnd: 20}, utils.KindPlaylist, []string{"--playlist-start", "5", "--playlist-end", "20"}},
+		{"oldest first", Options{Reverse: true, MaxItems: 3}, utils.KindChannel, []string{"--max-downloads", "3", "--playlist-reverse"}},
+		{"incremental", Options{MaxItems: 50, DateAfter: "20240101", StopAtIndexed: true}, utils.KindChannel,
+			[]string{"--max-downloads", "50", "--dateafter", "20240101", "--break-match-filters", "upload_date>=20240101", "--break-on-existing"}},
+		{"date before", Options{DateBefore: "20231231"}, utils.KindPlaylist, []string{"--datebefore", "20231231"}},
+		{"oldest first ignores stop at indexed", Options{Reverse: true, MaxItems: 3, StopAtIndexed: true}, utils.KindChannel,
+			[]string{"--max-downloads", "3", "--playlist-reverse"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ytDlpCollectionArgs(cfg, tt.opts, tt.kind); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ytDlpCollectionArgs() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseFlatPlaylist(t *testing.T) {
+	output := []byte("abc123\t20240102\thttps://www.youtube.com/watch?v=abc123\tFirst\tvideo\nNA\tNA\tNA\tNA\n\ndef456\tNA\tNA\tNA\n")
+	want := []PlaylistItem{
+		{ID: "abc123", UploadDate: "20240102", URL: "https://www.youtube.com/watch?v=abc123", Title: "First\tvideo"},
+		{ID: "def456"},
+	}
+	if got := parseFlatPlaylist(output); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseFlatPlaylist() = %+v, want %+v", got, want)
+	}
+}
+
+func TestChannelVideosURL(t *testing.T) {
+	tests := map[string]string{
+		"https://www.youtube.com/@someone":             "https://www.youtube.com/@someone/videos",
+		"https://www.youtube.com/@someone/shorts":      "https://www.youtube.com/@someone/shorts",
+		"https://www.youtube.com/channel/UC123":        "https://www.youtube.com/channel/UC123/videos",
+		"https://www.youtube.com/channel/UC123/videos": "https://www.youtube.com/channel/UC123/videos",
+	}
+	for in, want := range tests {
+		if got := channelVideosURL(in); got != want {
+			t.Errorf("channelVideosURL(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+// stubChannelLister 返回固定视频列表的频道列表读取器
+type stubChannelLister struct {
+	items []PlaylistItem
+	err   error
+	url   string
+	max   int
+	calls int
+}
+
+func (l *stubChannelLister) ListChannel(ctx context.Context, channelURL string, max int) ([]PlaylistItem, error) {
+	l.url, l.max = channelURL, max
+	l.calls++
+	return l.items, l.err
+}
+
+func TestYouTubeDownloaderExpandChannel(t *testing.T) {
+	ids := make([]string, 15)
+	lister := &stubChannelLister{}
+	for i := range ids {
+		ids[i] = string(rune('a'+i)) + "0000000000"
+		// 从新到旧，每个视频早一天
+		lister.items = append(lister.items, PlaylistItem{ID: ids[i], UploadDate: fmt.Sprintf("202401%02d", 20-i)})
+	}
+	cfg := config.DefaultConfig()
+	ytd := &YouTubeDownloader{config: cfg}
+	ytd.SetChannelLister(lister)
+
+	// 没有指定数量时只展开最新的 channel_max_items 个视频，URL 为规范的视频URL
+	items, ok, err := ytd.ExpandContext(context.Background(), "https://www.youtube.com/@someone")
+	if err != nil || !ok {
+		t.Fatalf("ExpandContext() = %v, %v", ok, err)
+	}
+	if len(items) != cfg.ChannelMaxItems || items[0].URL != "https://www.youtube.com/watch?v="+ids[0] {
+		t.Errorf("ExpandContext() = %+v, want newest %d videos", items, cfg.ChannelMaxItems)
+	}
+	if lister.url != "https://www.youtube.com/@someone/videos" || lister.max != cfg.ChannelMaxItems {
+		t.Errorf("ListChannel(%q, %d), want videos tab with max %d", lister.url, lister.max, cfg.ChannelMaxItems)
+	}
+
+	ctx := WithOptions(context.Background(), Options{Reverse: true, MaxItems: 3})
+	items, _, _ = ytd.ExpandContext(ctx, "https://www.youtube.com/@someone")
+	if got := itemIDs(items); !reflect.DeepEqual(got, []string{ids[14], ids[13], ids[12]}) {
+		t.Errorf("ExpandContext() reverse = %v, want oldest 3 videos", got)
+	}
+
+	// 日期窗口：20240117 到 20240119
+	ctx = WithOptions(context.Background(), Options{MaxItems: 100, DateAfter: "20240117", DateBefore: "20240119"})
+	items, _, _ = ytd.ExpandContext(ctx, "https://www.youtube.com/@someone")
+	if got := itemIDs(items); !reflect.DeepEqual(got, []string{ids[1], ids[2], ids[3]}) {
+		t.Errorf("ExpandContext() date window = %v, want %v", got, ids[1:4])
+	}
+
+	// 遇到第一个已下载的视频时停止
+	idx := indexer.NewIndexer(t.TempDir())
+	if err := idx.MarkDownloaded(ids[2]); err != nil {
+		t.Fatalf("MarkDownloaded() error = %v", err)
+	}
+	ytd.indexer = idx
+	ctx = WithOptions(context.Background(), Options{StopAtIndexed: true})
+	items, _, _ = ytd.ExpandContext(ctx, "https://www.youtube.com/@someone")
+	if got := itemIDs(items); !reflect.DeepEqual(got, []string{ids[0], ids[1]}) {
+		t.Errorf("ExpandContext() stop at indexed = %v, want %v", got, ids[:2])
+	}
+
+	// 从最早的视频开始时不在已下载的视频处停止
+	ctx = WithOptions(context.Background(), Options{Reverse: true, MaxItems: 100, StopAtIndexed: true})
+	items, _, _ = ytd.ExpandContext(ctx, "https://www.youtube.com/@someone")
+	if len(items) != len(ids) || items[0].ID != ids[14] {
+		t.Errorf("ExpandContext() reverse with stop at indexed = %v, want all %d videos oldest first", itemIDs(items), len(ids))
+	}
+
+	// 单个视频和其他平台不展开
+	for _, url := range []string{"https://www.youtube.com/watch?v=dQw4w9WgXcQ", "https://www.tiktok.com/@someone"} {
+		if _, ok, _ := ytd.ExpandContext(context.Background(), url); ok {
+			t.Errorf("ExpandContext(%q) ok = true, want false", url)
+		}
+	}
+}
+
+func TestSmartDownloaderExpandFollowsRoutes(t *testing.T) {
+	const channel = "https://www.youtube.com/@someone"
+	newSmart := func(lister *stubChannelLister, rules []config.RoutingRule) *SmartDownloader {
+		ytd := &YouTubeDownloader{config: config.DefaultConfig()}
+		ytd.SetChannelLister(lister)
+		sd, err := NewSmartDownloaderWithRules(ytd, &MultiPlatformDownloader{}, rules)
+		if err != nil {
+			t.Fatalf("NewSmartDownloaderWithRules() error = %v", err)
+		}
+		return sd
+	}
+
+	// 路由到 youtube 时由 YouTube 专用下载器展开
+	expandRules := []config.RoutingRule{{Platform: "youtube", Kinds: []string{"channel"}, Downloaders: []string{"youtube", "multi"}}}
+	lister := &stubChannelLister{items: []PlaylistItem{{ID: "a0000000000"}, {ID: "b0000000000"}}}
+	items, ok, err := newSmart(lister, expandRules).ExpandContext(context.Background(), channel)
+	if !ok || err != nil || len(items) != 2 {
+		t.Errorf("ExpandContext() = %v, %v, %v, want 2 items", items, ok, err)
+	}
+
+	// 默认规则把频道路由到 multi，不展开，由 yt-dlp 整体下载
+	lister = &stubChannelLister{items: []PlaylistItem{{ID: "a0000000000"}}}
+	if _, ok, err := newSmart(lister, config.DefaultRoutingRules()).ExpandContext(context.Background(), channel); ok || err != nil || lister.calls != 0 {
+		t.Errorf("ExpandContext() = %v, %v, lister calls = %d, want not expanded", ok, err, lister.calls)
+	}
+
+	// 展开失败时不返回错误，由下载器链下载
+	lister = &stubChannelLister{err: errors.New("yt-dlp not found")}
+	if _, ok, err := newSmart(lister, expandRules).ExpandContext(context.Background(), channel); ok || err != nil || lister.calls != 1 {
+		t.Errorf("ExpandContext() = %v, %v, lister calls = %d, want fallback to download", ok, err, lister.calls)
+	}
+}
@@ -0,0 +1,230 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"batch_download_videos/utils"
+)
+
+// ProgressFunc 接收下载进度事件的回调函数
+type ProgressFunc func(progress DownloadProgress)
+
+type progressKey struct{}
+
+// WithProgress 返回携带进度回调的 ctx，传给 DownloadContext 后下载器会通过 fn 报告进度
+func WithProgress(ctx context.Context, fn ProgressFunc) context.Context {
+	return context.WithValue(ctx, progressKey{}, fn)
+}
+
+// progressFromContext 取出 ctx 中的进度回调，没有时返回 nil
+func progressFromContext(ctx context.Context) ProgressFunc {
+	fn, _ := ctx.Value(progressKey{}).(ProgressFunc)
+	return fn
+}
+
+// newDownloadProgress 根据字节数、速度和剩余时间构造进度事件
+func newDownloadProgress(videoID, title string, downloaded, total int64, bytesPerSecond float64, remaining time.Duration) DownloadProgress {
+	progress := DownloadProgress{
+		VideoID:        videoID,
+		Title:          title,
+		Downloaded:     downloaded,
+		Total:          total,
+		BytesPerSecond: bytesPerSecond,
+		Remaining:      remaining,
+	}
+	if total > 0 {
+		progress.Progress = math.Min(float64(downloaded)/float64(total)*100, 100)
+	}
+	if bytesPerSecond > 0 {
+		progress.Speed = utils.FormatFileSize(int64(bytesPerSecond)) + "/s"
+	}
+	if remaining > 0 {
+		progress.ETA = remaining.Round(time.Second).String()
+	}
+	return progress
+}
+
+// progressTracker 根据字节计数计算速度和剩余时间，并按间隔节流上报进度
+type progressTracker struct {
+	fn       ProgressFunc
+	videoID  string
+	title    string
+	start    time.Time
+	lastEmit time.Time
+	interval time.Duration
+	mutex    sync.Mutex
+}
+
+// newProgressTracker 创建进度跟踪器，ctx 中没有进度回调时返回 nil（nil 跟踪器的方法均为空操作）
+func newProgressTracker(ctx context.Context, videoID, title string) *progressTracker {
+	fn := progressFromContext(ctx)
+	if fn == nil {
+		return nil
+	}
+	return &progressTracker{
+		fn:       fn,
+		videoID:  videoID,
+		title:    title,
+		start:    time.Now(),
+		interval: 500 * time.Millisecond,
+	}
+}
+
+// Update 上报进度，距上次上报不足 interval 时忽略
+func (pt *progressTracker) Update(downloaded, total int64) {
+	pt.emit(downloaded, total, false)
+}
+
+// Finish 无条件上报最终进度
+func (pt *progressTracker) Finish(downloaded, total int64) {
+	pt.emit(downloaded, total, true)
+}
+
+func (pt *progressTracker) emit(downloaded, total int64, force bool) {
+	if pt == nil {
+		return
+	}
+	pt.mutex.Lock()
+	now := time.Now()
+	if !force && now.Sub(pt.lastEmit) < pt.interval {
+		pt.mutex.Unlock()
+		return
+	}
+	pt.lastEmit = now
+
+	var speed float64
+	if elapsed := now.Sub(pt.start).Seconds(); elapsed > 0 {
+		speed = float64(downloaded) / elapsed
+	}
+	var remaining time.Duration
+	if speed > 0 && total > downloaded {
+		remaining = time.Duration(float64(total-downloaded) / speed * float64(time.Second))
+	}
+	pt.mutex.Unlock()
+
+	pt.fn(newDownloadProgress(pt.videoID, pt.title, downloaded, total, speed, remaining))
+}
+
+// ytDlpProgressPrefix yt-dlp 进度行的前缀，用于从普通输出中区分进度信息
+const ytDlpProgressPrefix = "[progress]"
+
+// ytDlpProgressArgs 返回让 yt-dlp 逐行输出机器可读进度的参数
+// 每行格式: [progress]|视频ID|已下载字节|总字节|估计总字节|速度|剩余秒数，缺失的值为 NA
+func ytDlpProgressArgs() []string {
+	return []string{
+		"--progress", // 使用 --print 时 yt-dlp 进入静默模式，需要显式开启进度输出
+		"--newline",
+		"--progress-template",
+		"download:" + ytDlpProgressPrefix + "|%(info.id)s|%(progress.downloaded_bytes)s|%(progress.total_bytes)s|%(progress.total_bytes_estimate)s|%(progress.speed)s|%(progress.eta)s",
+	}
+}
+
+// parseYtDlpProgress 解析一行 yt-dlp 进度输出，不是进度行时返回 false
+func parseYtDlpProgress(line string) (DownloadProgress, bool) {
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, ytDlpProgressPrefix) {
+		return DownloadProgress{}, false
+	}
+
+	fields := strings.Split(line, "|")
+	if len(fields) != 7 {
+		return DownloadProgress{}, false
+	}
+
+	number := func(s string) float64 {
+		v, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil || v < 0 {
+			return 0
+		}
+		return v
+	}
+
+	videoID := fields[1]
+	downloaded := int64(number(fields[2]))
+	total := int64(number(fields[3]))
+	if total == 0 {
+		total = int64(number(fields[4]))
+	}
+	speed := number(fields[5])
+	remaining := time.Duration(number(fields[6]) * float64(time.Second))
+
+	return newDownloadProgress(videoID, "", downloaded, total, speed, remaining), true
+}
+
+// ytDlpOutputWriter 逐行处理 yt-dlp 的标准输出：进度行转换为进度事件，其他行原样转发给 passthrough
+type ytDlpOutputWriter struct {
+	fn          ProgressFunc
+	title       string
+	passthrough func(line string)
+	buffer      bytes.Buffer
+	lastEmit    time.Time
+}
+
+// newYtDlpOutputWriter 创建 yt-dlp 输出处理器，passthrough 为 nil 时丢弃非进度行
+func newYtDlpOutputWriter(ctx context.Context, title string, passthrough func(line string)) *ytDlpOutputWriter {
+	return &ytDlpOutputWriter{
+		fn:          progressFromContext(ctx),
+		title:       title,
+		passthrough: passthrough,
+	}
+}
+
+func (w *ytDlpOutputWriter) Write(p []byte) (int, error) {
+	w.buffer.Write(p)
+	for {
+		data := w.buffer.Bytes()
+		i := bytes.IndexAny(data, "\r\n")
+		if i < 0 {
+			break
+		}
+		line := string(data[:i])
+		w.buffer.Next(i + 1)
+		w.handleLine(line)
+	}
+	return len(p), nil
+}
+
+// Flush 处理缓冲区中剩余的不完整行
+func (w *ytDlpOutputWriter) Flush() {
+	if w.buffer.Len() > 0 {
+		line := w.buffer.String()
+		w.buffer.Reset()
+		w.handleLine(line)
+	}
+}
+
+func (w *ytDlpOutputWriter) handleLine(line string) {
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+
+	progress, ok := parseYtDlpProgress(line)
+	if !ok {
+		if w.passthrough != nil {
+			w.passthrough(line)
+		}
+		return
+	}
+
+	if w.fn == nil {
+		return
+	}
+	// yt-dlp 输出进度非常频繁，节流上报；下载完成的进度总是上报
+	now := time.Now()
+	finished := progress.Total > 0 && progress.Downloaded >= progress.Total
+	if !finished && now.Sub(w.lastEmit) < 500*time.Millisecond {
+		return
+	}
+	w.lastEmit = now
+
+	if progress.Title == "" {
+		progress.Title = w.title
+	}
+	w.fn(progress)
+}
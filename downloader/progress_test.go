@@ -0,0 +1,70 @@
+package downloader
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestParseYtDlpProgress(t *testing.T) {
+	progress, ok := parseYtDlpProgress("[progress]|abc123|5242880|10485760|NA|1048576.5|5")
+	if !ok {
+		t.Fatal("parseYtDlpProgress() should recognize progress line")
+	}
+
+	if progress.VideoID != "abc123" {
+		t.Errorf("VideoID = %q, want %q", progress.VideoID, "abc123")
+	}
+	if progress.Downloaded != 5242880 || progress.Total != 10485760 {
+		t.Errorf("Downloaded/Total = %d/%d, want 5242880/10485760", progress.Downloaded, progress.Total)
+	}
+	if progress.Progress != 50 {
+		t.Errorf("Progress = %.2f, want 50", progress.Progress)
+	}
+	if progress.Remaining != 5*time.Second || progress.ETA != "5s" {
+		t.Errorf("Remaining/ETA = %v/%q, want 5s", progress.Remaining, progress.ETA)
+	}
+	if progress.Speed != "1.0 MB/s" {
+		t.Errorf("Speed = %q, want %q", progress.Speed, "1.0 MB/s")
+	}
+
+	// 总大小未知时使用估计值
+	progress, ok = parseYtDlpProgress("[progress]|abc123|100|NA|400.0|NA|NA")
+	if !ok || progress.Total != 400 || progress.Progress != 25 {
+		t.Errorf("parseYtDlpProgress() with estimate = %+v, want total 400 and 25%%", progress)
+	}
+
+	if _, ok := parseYtDlpProgress("[download] Destination: video.mp4"); ok {
+		t.Error("parseYtDlpProgress() should ignore non-progress lines")
+	}
+}
+
+func TestYtDlpOutputWriter(t *testing.T) {
+	var events []DownloadProgress
+	ctx := WithProgress(context.Background(), func(progress DownloadProgress) {
+		events = append(events, progress)
+	})
+
+	var passthrough []string
+	writer := newYtDlpOutputWriter(ctx, "测试视频", func(line string) {
+		passthrough = append(passthrough, line)
+	})
+
+	writer.Write([]byte("[download] Destination: video.mp4\n[progress]|id1|10|100|NA|10|9\n[progr"))
+	writer.Write([]byte("ess]|id1|100|100|NA|10|0\n"))
+	writer.Flush()
+
+	if len(passthrough) != 1 || passthrough[0] != "[download] Destination: video.mp4" {
+		t.Errorf("passthrough = %v, want the destination line only", passthrough)
+	}
+
+	if len(events) != 2 {
+		t.Fatalf("events = %d, want 2", len(events))
+	}
+	if events[0].Title != "测试视频" {
+		t.Errorf("Title = %q, want %q", events[0].Title, "测试视频")
+	}
+	if events[1].Progress != 100 {
+		t.Errorf("final Progress = %.2f, want 100", events[1].Progress)
+	}
+}
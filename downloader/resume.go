@@ -0,0 +1,279 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"batch_download_videos/utils"
+)
+
+// partSuffix 未完成下载的临时文件后缀
+const partSuffix = ".part"
+
+// partialFileName 返回下载过程中使用的文件名，只由平台、视频ID和格式决定，不包含时间戳等每次运行都不同的内容，
+// 下载中断后下次运行能找到同一个 .part 文件继续，下载完成后再重命名为按输出模板生成的文件名
+func partialFileName(platform, videoID, format, ext string) string {
+	name := platform + "_" + videoID
+	if format != "" {
+		name += "_" + format
+	}
+	return utils.SanitizeFilename(name) + ext
+}
+
+// moveStagedFiles 把 stageDir 中下载完成的文件（视频、字幕、缩略图、info.json 等，文件名都以 stageBase 开头）
+// 移动到 outputDir，文件名开头的 stageBase 替换为 outputBase，然后删除 stageDir，返回 path 移动后的路径
+func moveStagedFiles(stageDir, stageBase, outputDir, outputBase, path string) (string, error) {
+	entries, err := os.ReadDir(stageDir)
+	if err != nil {
+		return "", fmt.Errorf("读取目录失败: %w", err)
+	}
+
+	movedPath := ""
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, stageBase) || isPartialFile(name) {
+			continue
+		}
+		target := filepath.Join(outputDir, outputBase+strings.TrimPrefix(name, stageBase))
+		if err := os.Rename(filepath.Join(stageDir, name), target); err != nil {
+			return "", fmt.Errorf("移动文件失败: %w", err)
+		}
+		if name == filepath.Base(path) {
+			movedPath = target
+		}
+	}
+	if movedPath == "" {
+		return "", fmt.Errorf("未找到下载的文件: %s", path)
+	}
+
+	if err := os.RemoveAll(stageDir); err != nil {
+		log.Printf("删除临时目录失败: %v", err)
+	}
+	return movedPath, nil
+}
+
+// errRangeNotSupported 服务器忽略 Range 请求头、返回了完整内容
+var errRangeNotSupported = errors.New("服务器不支持 Range 请求")
+
+// contentRangePattern 匹配 Content-Range 响应头，例如 "bytes 100-199/1000" 或 "bytes */1000"
+var contentRangePattern = regexp.MustCompile(`^bytes (?:(\d+)-(\d+)|\*)/(\d+|\*)$`)
+
+// rangeDownloader 通过 HTTP Range 请求下载文件，支持断点续传
+// 数据先写入 filePath+".part"，再次下载同一文件时从 .part 的末尾继续，
+// 校验大小与服务器声明的长度一致后才重命名为最终文件
+type rangeDownloader struct {
+	client *http.Client
+	header http.Header
+	// chunkSize 每个 Range 请求的最大字节数，0 表示一次请求剩余的全部内容
+	chunkSize int64
+	// requireRange 为 true 时服务器忽略 Range 返回 200 视为错误（errRangeNotSupported），用于分段下载
+	requireRange bool
+}
+
+// newRangeDownloader 创建断点续传下载器，client 为 nil 时使用 http.DefaultClient
+func newRangeDownloader(client *http.Client, header http.Header, chunkSize int64) *rangeDownloader {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if header == nil {
+		header = http.Header{}
+	}
+	return &rangeDownloader{
+		client:    client,
+		header:    header,
+		chunkSize: chunkSize,
+	}
+}
+
+// Download 下载 url 到 filePath，返回最终文件大小
+// onProgress 在写入数据时被调用，current 包含续传前已存在的字节数；total 未知时为 -1
+func (rd *rangeDownloader) Download(ctx context.Context, url, filePath string, onProgress func(current, total int64)) (int64, error) {
+	partPath := filePath + partSuffix
+
+	offset := int64(0)
+	if info, err := os.Stat(partPath); err == nil {
+		offset = info.Size()
+		if offset > 0 {
+			log.Printf("发现未完成的下载，从 %d 字节处继续: %s", offset, partPath)
+		}
+	}
+
+	file, err := os.OpenFile(partPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return 0, fmt.Errorf("创建临时文件失败: %w", err)
+	}
+	defer file.Close()
+
+	total := int64(-1)
+	for total < 0 || offset < total {
+		start := offset
+		end := int64(-1)
+		if rd.chunkSize > 0 {
+			end = start + rd.chunkSize - 1
+			if total > 0 && end >= total {
+				end = total - 1
+			}
+		}
+
+		written, size, restarted, err := rd.fetchRange(ctx, url, file, start, end, func(current int64) {
+			if onProgress != nil {
+				onProgress(current, total)
+			}
+		})
+		if restarted {
+			offset = 0
+		}
+		offset += written
+		if size >= 0 {
+			total = size
+		}
+		if err != nil {
+			return offset, err
+		}
+
+		// 服务器未返回总大小时，分块请求读满一块说明可能还有数据，否则以流结束为准
+		if total < 0 {
+			if end >= 0 && !restarted && written == end-start+1 {
+				continue
+			}
+			total = offset
+		}
+		// 服务器返回了空的响应体时不再重复请求同一范围
+		if written == 0 && offset < total {
+			return offset, fmt.Errorf("服务器未返回数据: %w", io.ErrUnexpectedEOF)
+		}
+		if onProgress != nil {
+			onProgress(offset, total)
+		}
+	}
+
+	if err := file.Sync(); err != nil {
+		return offset, fmt.Errorf("写入文件失败: %w", err)
+	}
+	file.Close()
+
+	// 校验已下载的大小与服务器声明的长度一致
+	info, err := os.Stat(partPath)
+	if err != nil {
+		return offset, fmt.Errorf("读取临时文件失败: %w", err)
+	}
+	if info.Size() != total {
+		return info.Size(), fmt.Errorf("文件大小不匹配: 已下载 %d 字节, 应为 %d 字节", info.Size(), total)
+	}
+
+	if err := os.Rename(partPath, filePath); err != nil {
+		return total, fmt.Errorf("重命名临时文件失败: %w", err)
+	}
+
+	return total, nil
+}
+
+// fetchRange 请求 [start, end] 范围的数据并追加写入 file，end 为 -1 表示到文件末尾
+// 返回本次写入的字节数、服务器声明的总大小（未知时为 -1），以及是否因服务器不支持 Range 而从头重写了文件
+func (rd *rangeDownloader) fetchRange(ctx context.Context, url string, file *os.File, start, end int64, onProgress func(current int64)) (int64, int64, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, -1, false, fmt.Errorf("创建请求失败: %w", err)
+	}
+	for key, values := range rd.header {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+	if end >= 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+	} else if start > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", start))
+	}
+
+	resp, err := rd.client.Do(req)
+	if err != nil {
+		return 0, -1, false, err
+	}
+	defer resp.Body.Close()
+
+	total := int64(-1)
+	restarted := false
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		rangeStart, size, ok := parseContentRange(resp.Header.Get("Content-Range"))
+		if !ok || rangeStart != start {
+			return 0, -1, false, fmt.Errorf("服务器返回的范围无效: %s", resp.Header.Get("Content-Range"))
+		}
+		total = size
+	case http.StatusOK:
+		if rd.requireRange && req.Header.Get("Range") != "" {
+			return 0, -1, false, errRangeNotSupported
+		}
+		// 服务器忽略了 Range，返回完整内容，需要从头写入
+		if start > 0 {
+			log.Printf("服务器不支持断点续传，从头开始下载")
+			if err := file.Truncate(0); err != nil {
+				return 0, -1, false, fmt.Errorf("清空临时文件失败: %w", err)
+			}
+			restarted = true
+			start = 0
+		}
+		total = resp.ContentLength
+	case http.StatusRequestedRangeNotSatisfiable:
+		// 请求的起点超出文件大小：文件已经完整下载，或临时文件已损坏
+		_, size, ok := parseContentRange(resp.Header.Get("Content-Range"))
+		if ok && size == start {
+			return 0, size, false, nil
+		}
+		if err := file.Truncate(0); err != nil {
+			return 0, -1, false, fmt.Errorf("清空临时文件失败: %w", err)
+		}
+		return 0, -1, true, fmt.Errorf("临时文件与服务器文件不一致，已清空，请重试")
+	default:
+		return 0, -1, false, newStatusError(resp)
+	}
+
+	reader := &ProgressReader{
+		Reader: resp.Body,
+		Total:  total,
+		OnProgress: func(current, _ int64) {
+			if onProgress != nil {
+				onProgress(start + current)
+			}
+		},
+	}
+	written, err := io.Copy(file, reader)
+	if err != nil {
+		return written, total, restarted, fmt.Errorf("下载失败: %w", err)
+	}
+
+	// 校验本次响应的长度
+	if resp.ContentLength >= 0 && written != resp.ContentLength {
+		return written, total, restarted, fmt.Errorf("下载不完整: 收到 %d 字节, 应为 %d 字节: %w", written, resp.ContentLength, io.ErrUnexpectedEOF)
+	}
+
+	return written, total, restarted, nil
+}
+
+// parseContentRange 解析 Content-Range 响应头，返回范围起点和总大小（未知时为 -1）
+func parseContentRange(value string) (int64, int64, bool) {
+	match := contentRangePattern.FindStringSubmatch(value)
+	if match == nil {
+		return 0, -1, false
+	}
+
+	start := int64(0)
+	if match[1] != "" {
+		start, _ = strconv.ParseInt(match[1], 10, 64)
+	}
+	total := int64(-1)
+	if match[3] != "*" {
+		total, _ = strconv.ParseInt(match[3], 10, 64)
+	}
+	return start, total, true
+}
@@ -0,0 +1,219 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func testContent(size int) []byte {
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	return data
+}
+
+func TestRangeDownloaderResume(t *testing.T) {
+	content := testContent(1000)
+
+	var mutex sync.Mutex
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		ranges = append(ranges, r.Header.Get("Range"))
+		mutex.Unlock()
+		http.ServeContent(w, r, "video.mp4", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	filePath := filepath.Join(t.TempDir(), "video.mp4")
+	if err := os.WriteFile(filePath+partSuffix, content[:300], 0644); err != nil {
+		t.Fatalf("Failed to write part file: %v", err)
+	}
+
+	var lastCurrent, lastTotal int64
+	rd := newRangeDownloader(server.Client(), nil, 256)
+	size, err := rd.Download(context.Background(), server.URL, filePath, func(current, total int64) {
+		lastCurrent, lastTotal = current, total
+	})
+	if err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+	if size != int64(len(content)) {
+		t.Errorf("Download() size = %d, want %d", size, len(content))
+	}
+	if lastCurrent != size || lastTotal != size {
+		t.Errorf("last progress = %d/%d, want %d/%d", lastCurrent, lastTotal, size, size)
+	}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("Failed to read downloaded file: %v", err)
+	}
+	if !bytes.Equal(data, content) {
+		t.Error("downloaded content does not match")
+	}
+	if _, err := os.Stat(filePath + partSuffix); !os.IsNotExist(err) {
+		t.Error("part file should be renamed after download")
+	}
+
+	if len(ranges) == 0 || ranges[0] != "bytes=300-555" {
+		t.Errorf("first Range = %v, want bytes=300-555", ranges)
+	}
+}
+
+func TestRangeDownloaderServerIgnoresRange(t *testing.T) {
+	content := testContent(500)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(content)
+	}))
+	defer server.Close()
+
+	filePath := filepath.Join(t.TempDir(), "video.mp4")
+	if err := os.WriteFile(filePath+partSuffix, []byte("stale data"), 0644); err != nil {
+		t.Fatalf("Failed to write part file: %v", err)
+	}
+
+	rd := newRangeDownloader(server.Client(), nil, 0)
+	if _, err := rd.Download(context.Background(), server.URL, filePath, nil); err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("Failed to read downloaded file: %v", err)
+	}
+	if !bytes.Equal(data, content) {
+		t.Error("downloaded content should restart from the beginning")
+	}
+}
+
+func TestRangeDownloaderIncompleteResponse(t *testing.T) {
+	content := testContent(500)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "1000")
+		w.Write(content)
+	}))
+	defer server.Close()
+
+	filePath := filepath.Join(t.TempDir(), "video.mp4")
+	rd := newRangeDownloader(server.Client(), nil, 0)
+	_, err := rd.Download(context.Background(), server.URL, filePath, nil)
+	if err == nil {
+		t.Fatal("Download() should fail when the response is shorter than Content-Length")
+	}
+
+	if _, err := os.Stat(filePath); !os.IsNotExist(err) {
+		t.Error("incomplete download should not be renamed to the final file")
+	}
+	info, err := os.Stat(filePath + partSuffix)
+	if err != nil {
+		t.Fatalf("part file should be kept for resuming: %v", err)
+	}
+	if info.Size() != int64(len(content)) {
+		t.Errorf("part file size = %d, want %d", info.Size(), len(content))
+	}
+}
+
+func TestRangeDownloaderEmptyPartialResponse(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Range", "bytes 0-255/1000")
+		w.WriteHeader(http.StatusPartialContent)
+	}))
+	defer server.Close()
+
+	rd := newRangeDownloader(server.Client(), nil, 256)
+	_, err := rd.Download(context.Background(), server.URL, filepath.Join(t.TempDir(), "video.mp4"), nil)
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Download() error = %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+	if requests != 1 {
+		t.Errorf("server requested %d times, want 1", requests)
+	}
+}
+
+func TestParseContentRange(t *testing.T) {
+	tests := []struct {
+		value string
+		start int64
+		total int64
+		ok    bool
+	}{
+		{"bytes 100-199/1000", 100, 1000, true},
+		{"bytes 0-99/*", 0, -1, true},
+		{"bytes */1000", 0, 1000, true},
+		{"items 0-1/2", 0, -1, false},
+		{"", 0, -1, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(strings.ReplaceAll(tt.value, "/", "_"), func(t *testing.T) {
+			start, total, ok := parseContentRange(tt.value)
+			if start != tt.start || total != tt.total || ok != tt.ok {
+				t.Errorf("parseContentRange(%q) = %d, %d, %v, want %d, %d, %v",
+					tt.value, start, total, ok, tt.start, tt.total, tt.ok)
+			}
+		})
+	}
+}
+
+func TestPartialFileName(t *testing.T) {
+	tests := []struct {
+		platform, videoID, format, ext string
+		want                           string
+	}{
+		{"youtube", "abc123", "f137+140", ".mp4", "youtube_abc123_f137+140.mp4"},
+		{"douyin", "7001", "", ".mp4", "douyin_7001.mp4"},
+		{"generic", "https://example.com/v/1", "", "", "generic_https___example.com_v_1"},
+	}
+	for _, tt := range tests {
+		if got := partialFileName(tt.platform, tt.videoID, tt.format, tt.ext); got != tt.want {
+			t.Errorf("partialFileName(%q, %q, %q, %q) = %q, want %q", tt.platform, tt.videoID, tt.format, tt.ext, got, tt.want)
+		}
+	}
+}
+
+func TestMoveStagedFiles(t *testing.T) {
+	outputDir := t.TempDir()
+	stageDir := filepath.Join(outputDir, ".yt-dlp-bilibili_BV1")
+	if err := os.MkdirAll(stageDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"bilibili_BV1.mkv", "bilibili_BV1.zh.srt", "bilibili_BV1.f30080.mp4.part"} {
+		if err := os.WriteFile(filepath.Join(stageDir, name), []byte("data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := moveStagedFiles(stageDir, "bilibili_BV1", outputDir, "标题_BV1_20260102_030405", filepath.Join(stageDir, "bilibili_BV1.mkv"))
+	if err != nil {
+		t.Fatalf("moveStagedFiles() error = %v", err)
+	}
+	if want := filepath.Join(outputDir, "标题_BV1_20260102_030405.mkv"); got != want {
+		t.Errorf("moveStagedFiles() = %q, want %q", got, want)
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, "标题_BV1_20260102_030405.zh.srt")); err != nil {
+		t.Errorf("subtitle was not moved: %v", err)
+	}
+	if _, err := os.Stat(stageDir); !os.IsNotExist(err) {
+		t.Errorf("stage dir should have been removed, stat error = %v", err)
+	}
+
+	if _, err := moveStagedFiles(filepath.Join(outputDir, "missing"), "x", outputDir, "y", "x.mp4"); err == nil {
+		t.Error("moveStagedFiles() with missing dir error = nil")
+	}
+}
@@ -0,0 +1,170 @@
+package downloader
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"batch_download_videos/config"
+)
+
+// defaultMaxRetryAfter 没有配置 max_retry_after 时，Retry-After 的上限
+const defaultMaxRetryAfter = 5 * time.Minute
+
+// defaultRetryOn 没有配置 retry_on 时重试的错误类别，视频不可用、需要登录等永久性错误不再重试
+var defaultRetryOn = []string{"rate_limited", "network", "unknown"}
+
+// RetryPolicy 按错误类别决定下载失败后是否重试，以及重试前等待多久
+type RetryPolicy struct {
+	// MaxAttempts 最多尝试次数（包括第一次）
+	MaxAttempts int
+	// Backoff 退避曲线：exponential、linear 或 constant
+	Backoff   string
+	BaseDelay time.Duration
+	// MaxDelay 等待时间上限，0 表示不限制
+	MaxDelay time.Duration
+	// Jitter 随机抖动比例
+	Jitter float64
+	// MaxRetryAfter HTTP 429 响应要求的等待时间超过此值时不再重试
+	MaxRetryAfter time.Duration
+	// RetryOn 需要重试的错误类别名称（ErrorClassName）
+	RetryOn []string
+}
+
+// NewRetryPolicy 按配置文件创建 name（youtube、yt-dlp、douyin 或 task）的重试策略，
+// 没有配置该路径时使用 DefaultRetryPolicies 中的默认策略
+// 配置在加载时已经校验，无效的时间按未配置处理
+func NewRetryPolicy(cfg *config.Config, name string) *RetryPolicy {
+	policy, ok := cfg.RetryPolicies[name]
+	if !ok {
+		policy = config.DefaultRetryPolicies()[name]
+	}
+
+	p := &RetryPolicy{
+		MaxAttempts:   policy.MaxAttempts,
+		Backoff:       policy.Backoff,
+		BaseDelay:     cfg.BaseRetryDelay,
+		Jitter:        policy.Jitter,
+		MaxRetryAfter: defaultMaxRetryAfter,
+		RetryOn:       policy.RetryOn,
+	}
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = max(cfg.MaxRetries, 1)
+	}
+	if p.Backoff == "" {
+		p.Backoff = "exponential"
+	}
+	if delay, err := time.ParseDuration(policy.BaseDelay); err == nil {
+		p.BaseDelay = delay
+	}
+	if delay, err := time.ParseDuration(policy.MaxDelay); err == nil {
+		p.MaxDelay = delay
+	}
+	if delay, err := time.ParseDuration(policy.MaxRetryAfter); err == nil {
+		p.MaxRetryAfter = delay
+	}
+	if len(p.RetryOn) == 0 {
+		p.RetryOn = defaultRetryOn
+	}
+	return p
+}
+
+// Retryable 判断错误是否属于需要重试的类别，下载被取消时不重试
+func (p *RetryPolicy) Retryable(err error) bool {
+	name := ErrorClassName(err)
+	return name != "" && name != "canceled" && slices.Contains(p.RetryOn, name)
+}
+
+// Next 返回已尝试 attempts 次、最后一次的错误为 err 时，下一次重试前的等待时间；
+// 次数用完、错误不可重试或 Retry-After 超过上限时 ok 为 false
+func (p *RetryPolicy) Next(err error, attempts int) (delay time.Duration, ok bool) {
+	if attempts >= p.MaxAttempts || !p.Retryable(err) {
+		return 0, false
+	}
+
+	// 服务器通过 Retry-After 指定了等待时间时按它等待，不加抖动
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.RetryAfter > 0 {
+		if statusErr.RetryAfter > p.MaxRetryAfter {
+			return 0, false
+		}
+		return statusErr.RetryAfter, true
+	}
+	return p.backoff(attempts), true
+}
+
+// backoff 按退避曲线计算第 retry 次重试前的等待时间
+func (p *RetryPolicy) backoff(retry int) time.Duration {
+	var delay time.Duration
+	switch p.Backoff {
+	case "constant":
+		delay = p.BaseDelay
+	case "linear":
+		delay = p.BaseDelay * time.Duration(retry)
+	default:
+		// 指数退避：基础延迟 * (2^(重试次数-1))
+		delay = p.BaseDelay * time.Duration(math.Pow(2, float64(retry-1)))
+	}
+
+	// 随机抖动，避免多个请求同时重试导致的网络拥塞
+	if p.Jitter > 0 {
+		delay += time.Duration(float64(delay) * p.Jitter * (2*rand.Float64() - 1))
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	return max(delay, 0)
+}
+
+// RetryError 放弃下载时返回的错误，记录实际尝试的次数
+type RetryError struct {
+	Attempts int
+	Err      error
+}
+
+func (e *RetryError) Error() string {
+	return fmt.Sprintf("%v (尝试 %d 次后放弃)", e.Err, e.Attempts)
+}
+
+func (e *RetryError) Unwrap() error {
+	return e.Err
+}
+
+// Attempts 返回错误中记录的尝试次数，没有记录时为 1
+func Attempts(err error) int {
+	var retryErr *RetryError
+	if errors.As(err, &retryErr) {
+		return retryErr.Attempts
+	}
+	return 1
+}
+
+// parseRetryAfter 解析 Retry-After 响应头，支持秒数和 HTTP 日期两种格式，无法解析时返回 0
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return max(time.Duration(seconds)*time.Second, 0)
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(date.Sub(now), 0)
+	}
+	return 0
+}
+
+// newStatusError 根据响应生成 StatusError，HTTP 429 响应带有 Retry-After 时记录等待时间
+func newStatusError(resp *http.Response) *StatusError {
+	err := &StatusError{StatusCode: resp.StatusCode}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		err.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+	}
+	return err
+}
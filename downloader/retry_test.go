@@ -0,0 +1,151 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"batch_download_videos/config"
+)
+
+func TestNewRetryPolicy(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.MaxRetries = 4
+	cfg.BaseRetryDelay = time.Second
+	cfg.RetryPolicies["douyin"] = config.RetryPolicy{MaxAttempts: 2, Backoff: "constant", BaseDelay: "5s", RetryOn: []string{"network"}}
+	delete(cfg.RetryPolicies, "yt-dlp")
+
+	youtube := NewRetryPolicy(cfg, "youtube")
+	if youtube.MaxAttempts != 4 || youtube.Backoff != "exponential" || youtube.BaseDelay != time.Second || youtube.MaxDelay != 30*time.Second || youtube.Jitter != 0.2 {
+		t.Errorf("youtube policy = %+v, want exponential backoff from base_retry_delay capped at 30s", youtube)
+	}
+	if ytDlp := NewRetryPolicy(cfg, "yt-dlp"); ytDlp.Backoff != "linear" {
+		t.Errorf("yt-dlp policy = %+v, want default linear backoff", ytDlp)
+	}
+	douyin := NewRetryPolicy(cfg, "douyin")
+	if douyin.MaxAttempts != 2 || douyin.Backoff != "constant" || douyin.BaseDelay != 5*time.Second || douyin.MaxRetryAfter != defaultMaxRetryAfter {
+		t.Errorf("douyin policy = %+v, want configured constant policy", douyin)
+	}
+	if task := NewRetryPolicy(cfg, "task"); task.MaxAttempts != 1 {
+		t.Errorf("task policy MaxAttempts = %d, want 1", task.MaxAttempts)
+	}
+}
+
+func TestRetryPolicyNext(t *testing.T) {
+	policy := &RetryPolicy{
+		MaxAttempts:   3,
+		Backoff:       "exponential",
+		BaseDelay:     time.Second,
+		MaxDelay:      3 * time.Second,
+		MaxRetryAfter: time.Minute,
+		RetryOn:       defaultRetryOn,
+	}
+	network := fmt.Errorf("下载失败: %w", &StatusError{StatusCode: 503})
+
+	tests := []struct {
+		name      string
+		err       error
+		attempts  int
+		wantDelay time.Duration
+		wantOK    bool
+	}{
+		{"first retry", network, 1, time.Second, true},
+		{"second retry", network, 2, 2 * time.Second, true},
+		{"attempts exhausted", network, 3, 0, false},
+		{"unknown error", fmt.Errorf("boom"), 1, time.Second, true},
+		{"removed video", fmt.Errorf("获取视频失败: %w", ErrUnavailable), 1, 0, false},
+		{"login required", &DownloadError{Class: ErrLoginRequired, Err: fmt.Errorf("exit status 1")}, 1, 0, false},
+		{"canceled", fmt.Errorf("下载已取消: %w", context.Canceled), 1, 0, false},
+		{"retry after", &StatusError{StatusCode: 429, RetryAfter: 20 * time.Second}, 1, 20 * time.Second, true},
+		{"retry after too long", &StatusError{StatusCode: 429, RetryAfter: time.Hour}, 1, 0, false},
+		{"rate limited without retry after", &StatusError{StatusCode: 429}, 2, 2 * time.Second, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delay, ok := policy.Next(tt.err, tt.attempts)
+			if delay != tt.wantDelay || ok != tt.wantOK {
+				t.Errorf("Next() = %v, %t, want %v, %t", delay, ok, tt.wantDelay, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	tests := []struct {
+		backoff string
+		want    []time.Duration
+	}{
+		{"exponential", []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second}},
+		{"linear", []time.Duration{time.Second, 2 * time.Second, 3 * time.Second, 4 * time.Second}},
+		{"constant", []time.Duration{time.Second, time.Second, time.Second, time.Second}},
+	}
+	for _, tt := range tests {
+		policy := &RetryPolicy{Backoff: tt.backoff, BaseDelay: time.Second, MaxDelay: 5 * time.Second}
+		for i, want := range tt.want {
+			if got := policy.backoff(i + 1); got != want {
+				t.Errorf("%s backoff(%d) = %v, want %v", tt.backoff, i+1, got, want)
+			}
+		}
+	}
+
+	jittered := &RetryPolicy{Backoff: "constant", BaseDelay: 10 * time.Second, Jitter: 0.2}
+	for i := 0; i < 20; i++ {
+		if delay := jittered.backoff(1); delay < 8*time.Second || delay > 12*time.Second {
+			t.Fatalf("backoff with jitter = %v, want within 8s-12s", delay)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"120", 2 * time.Minute},
+		{now.Add(30 * time.Second).Format(http.TimeFormat), 30 * time.Second},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0},
+		{"", 0},
+		{"soon", 0},
+	}
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.value, now); got != tt.want {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+
+	resp := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{"Retry-After": []string{"7"}}}
+	if err := newStatusError(resp); err.RetryAfter != 7*time.Second {
+		t.Errorf("newStatusError().RetryAfter = %v, want 7s", err.RetryAfter)
+	}
+}
+
+func TestAttempts(t *testing.T) {
+	err := fmt.Errorf("下载失败: %w", &RetryError{Attempts: 3, Err: ErrNetwork})
+	if got := Attempts(err); got != 3 {
+		t.Errorf("Attempts() = %d, want 3", got)
+	}
+	if got := err.Error(); got != "下载失败: 网络错误 (尝试 3 次后放弃)" {
+		t.Errorf("Error() = %q", got)
+	}
+	if got := Attempts(fmt.Errorf("boom")); got != 1 {
+		t.Errorf("Attempts() without RetryError = %d, want 1", got)
+	}
+}
+
+func TestRetryErrorClassesMatchErrorClassNames(t *testing.T) {
+	for _, name := range config.RetryErrorClasses {
+		if name == "unknown" {
+			continue
+		}
+		found := false
+		for _, c := range errorClasses {
+			found = found || c.name == name
+		}
+		if !found {
+			t.Errorf("config.RetryErrorClasses contains %q, which is not an error class name", name)
+		}
+	}
+}
@@ -0,0 +1,274 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// minSegmentSize 每个分段的最小字节数，文件太小时减少分段数
+const minSegmentSize = 1024 * 1024
+
+// segmentedDownloader 将已知大小的文件拆分为多个 Range 分段并发下载，完成后按顺序合并
+// 每个分段写入独立的临时文件，重试时各分段从已下载的位置继续
+type segmentedDownloader struct {
+	client *http.Client
+	header http.Header
+	// segments 并发下载的分段数，小于等于 1 时退化为单连接断点续传
+	segments int
+	// chunkSize 分段内每个 Range 请求的最大字节数，0 表示一次请求整个分段
+	chunkSize int64
+}
+
+// newSegmentedDownloader 创建分段下载器，client 为 nil 时使用 http.DefaultClient
+func newSegmentedDownloader(client *http.Client, header http.Header, segments int, chunkSize int64) *segmentedDownloader {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if header == nil {
+		header = http.Header{}
+	}
+	return &segmentedDownloader{
+		client:    client,
+		header:    header,
+		segments:  segments,
+		chunkSize: chunkSize,
+	}
+}
+
+// segmentPath 返回第 index 个分段的临时文件路径，文件名包含分段总数，避免分段数变化后误用旧数据
+func segmentPath(filePath string, index, count int) string {
+	return fmt.Sprintf("%s.seg%dof%d%s", filePath, index, count, partSuffix)
+}
+
+// Download 下载 url 到 filePath，返回最终文件大小
+// total 为已知的文件大小，小于等于 0 时先探测；服务器不支持 Range 或文件太小时使用单连接下载
+// onProgress 汇总所有分段的进度，调用是串行的
+func (sd *segmentedDownloader) Download(ctx context.Context, url, filePath string, total int64, onProgress func(current, total int64)) (int64, error) {
+	single := newRangeDownloader(sd.client, sd.header, sd.chunkSize)
+
+	if sd.segments <= 1 {
+		return single.Download(ctx, url, filePath, onProgress)
+	}
+
+	if total <= 0 {
+		size, err := sd.probe(ctx, url)
+		if err != nil {
+			if ctx.Err() != nil {
+				return 0, err
+			}
+			log.Printf("探测文件大小失败，使用单连接下载: %v", err)
+			return single.Download(ctx, url, filePath, onProgress)
+		}
+		total = size
+	}
+
+	count := sd.segments
+	if maxCount := int(total / minSegmentSize); count > maxCount {
+		count = maxCount
+	}
+	if count <= 1 {
+		return single.Download(ctx, url, filePath, onProgress)
+	}
+
+	size, err := sd.downloadSegments(ctx, url, filePath, total, count, onProgress)
+	if errors.Is(err, errRangeNotSupported) {
+		log.Printf("服务器不支持分段下载，使用单连接下载")
+		removeSegments(filePath, count)
+		return single.Download(ctx, url, filePath, onProgress)
+	}
+	return size, err
+}
+
+// downloadSegments 并发下载 count 个分段并合并
+func (sd *segmentedDownloader) downloadSegments(ctx context.Context, url, filePath string, total int64, count int, onProgress func(current, total int64)) (int64, error) {
+	log.Printf("分段下载: %s (%d 个分段, 总大小 %d 字节)", filePath, count, total)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var progressMutex sync.Mutex
+	current := int64(0)
+	add := func(n int64) {
+		progressMutex.Lock()
+		defer progressMutex.Unlock()
+		current += n
+		if onProgress != nil {
+			onProgress(current, total)
+		}
+	}
+
+	segmentSize := total / int64(count)
+	errs := make([]error, count)
+	var wg sync.WaitGroup
+	for i := 0; i < count; i++ {
+		start := int64(i) * segmentSize
+		end := start + segmentSize - 1
+		if i == count-1 {
+			end = total - 1
+		}
+
+		wg.Add(1)
+		go func(index int, start, end int64) {
+			defer wg.Done()
+			errs[index] = sd.downloadSegment(ctx, url, segmentPath(filePath, index, count), start, end, total, add)
+			if errs[index] != nil {
+				// 一个分段失败时停止其他分段，已下载的部分保留到下次重试
+				cancel()
+			}
+		}(i, start, end)
+	}
+	wg.Wait()
+
+	for index, err := range errs {
+		if err != nil && !errors.Is(err, context.Canceled) {
+			return current, fmt.Errorf("分段 %d 下载失败: %w", index, err)
+		}
+	}
+	for _, err := range errs {
+		if err != nil {
+			return current, err
+		}
+	}
+
+	return sd.merge(filePath, total, count)
+}
+
+// downloadSegment 下载 [start, end] 范围到分段文件，分段文件已有的数据不会重复下载
+func (sd *segmentedDownloader) downloadSegment(ctx context.Context, url, path string, start, end, total int64, add func(n int64)) error {
+	length := end - start + 1
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("创建临时文件失败: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("读取临时文件失败: %w", err)
+	}
+	done := info.Size()
+	if done > length {
+		// 分段文件比分段还大，说明数据不可信，重新下载
+		if err := file.Truncate(0); err != nil {
+			return fmt.Errorf("清空临时文件失败: %w", err)
+		}
+		done = 0
+	}
+	add(done)
+
+	rd := newRangeDownloader(sd.client, sd.header, 0)
+	rd.requireRange = true
+
+	for done < length {
+		chunkStart := start + done
+		chunkEnd := end
+		if sd.chunkSize > 0 && chunkEnd-chunkStart+1 > sd.chunkSize {
+			chunkEnd = chunkStart + sd.chunkSize - 1
+		}
+
+		reported := chunkStart
+		written, size, _, err := rd.fetchRange(ctx, url, file, chunkStart, chunkEnd, func(position int64) {
+			add(position - reported)
+			reported = position
+		})
+		// 进度回调在最后一次读取后可能没有覆盖全部写入的字节
+		add(chunkStart + written - reported)
+		done += written
+		if err != nil {
+			return err
+		}
+		if size >= 0 && size != total {
+			return fmt.Errorf("文件大小已变化: %d 字节, 应为 %d 字节", size, total)
+		}
+		if written == 0 {
+			return fmt.Errorf("服务器未返回数据: %w", io.ErrUnexpectedEOF)
+		}
+	}
+
+	return nil
+}
+
+// merge 按顺序合并分段文件，校验总大小后重命名为最终文件
+func (sd *segmentedDownloader) merge(filePath string, total int64, count int) (int64, error) {
+	partPath := filePath + partSuffix
+	out, err := os.Create(partPath)
+	if err != nil {
+		return 0, fmt.Errorf("创建临时文件失败: %w", err)
+	}
+
+	size := int64(0)
+	for i := 0; i < count; i++ {
+		in, err := os.Open(segmentPath(filePath, i, count))
+		if err != nil {
+			out.Close()
+			return size, fmt.Errorf("读取分段失败: %w", err)
+		}
+		n, err := io.Copy(out, in)
+		in.Close()
+		size += n
+		if err != nil {
+			out.Close()
+			return size, fmt.Errorf("合并分段失败: %w", err)
+		}
+	}
+
+	if err := out.Close(); err != nil {
+		return size, fmt.Errorf("写入文件失败: %w", err)
+	}
+	if size != total {
+		os.Remove(partPath)
+		return size, fmt.Errorf("文件大小不匹配: 已下载 %d 字节, 应为 %d 字节", size, total)
+	}
+	if err := os.Rename(partPath, filePath); err != nil {
+		return size, fmt.Errorf("重命名临时文件失败: %w", err)
+	}
+
+	removeSegments(filePath, count)
+	return size, nil
+}
+
+// probe 请求第一个字节，从 Content-Range 中获取文件总大小
+func (sd *segmentedDownloader) probe(ctx context.Context, url string) (int64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, fmt.Errorf("创建请求失败: %w", err)
+	}
+	for key, values := range sd.header {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+	req.Header.Set("Range", "bytes=0-0")
+
+	resp, err := sd.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusPartialContent {
+		return 0, fmt.Errorf("%w: 状态码 %d", errRangeNotSupported, resp.StatusCode)
+	}
+	_, total, ok := parseContentRange(resp.Header.Get("Content-Range"))
+	if !ok || total <= 0 {
+		return 0, fmt.Errorf("无法获取文件大小: %s", resp.Header.Get("Content-Range"))
+	}
+	return total, nil
+}
+
+// removeSegments 删除 filePath 的所有分段临时文件
+func removeSegments(filePath string, count int) {
+	for i := 0; i < count; i++ {
+		path := segmentPath(filePath, i, count)
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			log.Printf("删除分段临时文件失败: %v", err)
+		}
+	}
+}
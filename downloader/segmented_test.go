@@ -0,0 +1,93 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSegmentedDownloader(t *testing.T) {
+	content := testContent(5*minSegmentSize + 123)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "video.mp4", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name  string
+		total int64
+	}{
+		{"known size", int64(len(content))},
+		{"probe size", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filePath := filepath.Join(t.TempDir(), "video.mp4")
+
+			// 第二个分段已下载了一部分，应从该位置继续
+			segmentSize := int64(len(content)) / 4
+			if err := os.WriteFile(segmentPath(filePath, 1, 4), content[segmentSize:segmentSize+1000], 0644); err != nil {
+				t.Fatalf("Failed to write segment file: %v", err)
+			}
+
+			var lastCurrent, lastTotal int64
+			sd := newSegmentedDownloader(server.Client(), nil, 4, 512*1024)
+			size, err := sd.Download(context.Background(), server.URL, filePath, tt.total, func(current, total int64) {
+				lastCurrent, lastTotal = current, total
+			})
+			if err != nil {
+				t.Fatalf("Download() error = %v", err)
+			}
+			if size != int64(len(content)) {
+				t.Errorf("Download() size = %d, want %d", size, len(content))
+			}
+			if lastCurrent != size || lastTotal != size {
+				t.Errorf("last progress = %d/%d, want %d/%d", lastCurrent, lastTotal, size, size)
+			}
+
+			data, err := os.ReadFile(filePath)
+			if err != nil {
+				t.Fatalf("Failed to read downloaded file: %v", err)
+			}
+			if !bytes.Equal(data, content) {
+				t.Error("downloaded content does not match")
+			}
+
+			for i := 0; i < 4; i++ {
+				if _, err := os.Stat(segmentPath(filePath, i, 4)); !os.IsNotExist(err) {
+					t.Errorf("segment %d should be removed after merge", i)
+				}
+			}
+		})
+	}
+}
+
+func TestSegmentedDownloaderFallback(t *testing.T) {
+	content := testContent(3 * minSegmentSize)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(content)
+	}))
+	defer server.Close()
+
+	filePath := filepath.Join(t.TempDir(), "video.mp4")
+	sd := newSegmentedDownloader(server.Client(), nil, 4, 0)
+	if _, err := sd.Download(context.Background(), server.URL, filePath, int64(len(content)), nil); err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("Failed to read downloaded file: %v", err)
+	}
+	if !bytes.Equal(data, content) {
+		t.Error("downloaded content does not match")
+	}
+}
@@ -1,19 +1,94 @@
 package downloader
 
 import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"slices"
 	"strings"
+
+	"batch_download_videos/config"
+	"batch_download_videos/utils"
 )
 
+// SmartDownloader 按路由规则为每个URL选择下载器链，前一个下载器失败时自动使用下一个
 type SmartDownloader struct {
 	youtubeDownloader *YouTubeDownloader
 	multiDownloader   *MultiPlatformDownloader
+	// downloaders 路由规则中可以使用的下载器，键为规则中的名称
+	downloaders map[string]Downloader
+	rules       []routingRule
+}
+
+// routingRule 编译后的路由规则
+type routingRule struct {
+	platform    string
+	kinds       []utils.ContentKind
+	pattern     *regexp.Regexp
+	downloaders []string
+}
+
+// matches 判断URL是否匹配规则
+func (rule routingRule) matches(urlStr string, match utils.URLMatch) bool {
+	if rule.platform != "" && !strings.EqualFold(rule.platform, match.Platform) {
+		return false
+	}
+	if len(rule.kinds) > 0 && !slices.Contains(rule.kinds, match.Kind) {
+		return false
+	}
+	if rule.pattern != nil && !rule.pattern.MatchString(urlStr) {
+		return false
+	}
+	return true
 }
 
+// NewSmartDownloader 创建使用默认路由规则的智能下载器
 func NewSmartDownloader(ytDownloader *YouTubeDownloader, multiDownloader *MultiPlatformDownloader) *SmartDownloader {
-	return &SmartDownloader{
+	sd, err := NewSmartDownloaderWithRules(ytDownloader, multiDownloader, config.DefaultRoutingRules())
+	if err != nil {
+		panic(err)
+	}
+	return sd
+}
+
+// NewSmartDownloaderWithRules 创建使用指定路由规则的智能下载器，规则按顺序匹配，第一个匹配的规则生效；
+// 没有匹配的规则时使用多平台下载器
+func NewSmartDownloaderWithRules(ytDownloader *YouTubeDownloader, multiDownloader *MultiPlatformDownloader, rules []config.RoutingRule) (*SmartDownloader, error) {
+	sd := &SmartDownloader{
 		youtubeDownloader: ytDownloader,
 		multiDownloader:   multiDownloader,
+		downloaders: map[string]Downloader{
+			"youtube": ytDownloader,
+			"multi":   multiDownloader,
+		},
 	}
+
+	for i, rule := range rules {
+		compiled := routingRule{platform: rule.Platform}
+		for _, kind := range rule.Kinds {
+			compiled.kinds = append(compiled.kinds, utils.ContentKind(strings.ToLower(kind)))
+		}
+		if rule.Pattern != "" {
+			pattern, err := regexp.Compile(rule.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("路由规则 %d 的正则表达式无效: %w", i+1, err)
+			}
+			compiled.pattern = pattern
+		}
+		if len(rule.Downloaders) == 0 {
+			return nil, fmt.Errorf("路由规则 %d 没有指定下载器", i+1)
+		}
+		for _, name := range rule.Downloaders {
+			name = strings.ToLower(name)
+			if _, ok := sd.downloaders[name]; !ok {
+				return nil, fmt.Errorf("路由规则 %d 的下载器无效: %s (支持: youtube/multi)", i+1, name)
+			}
+			compiled.downloaders = append(compiled.downloaders, name)
+		}
+		sd.rules = append(sd.rules, compiled)
+	}
+	return sd, nil
 }
 
 func (sd *SmartDownloader) Name() string {
@@ -25,13 +100,55 @@ func (sd *SmartDownloader) SupportedPlatforms() []string {
 }
 
 func (sd *SmartDownloader) GetVideoInfo(urlStr string) (*VideoInfo, error) {
+	return sd.GetVideoInfoContext(context.Background(), urlStr)
+}
+
+func (sd *SmartDownloader) GetVideoInfoContext(ctx context.Context, urlStr string) (*VideoInfo, error) {
 	dl := sd.selectDownloader(urlStr)
-	return dl.GetVideoInfo(urlStr)
+	return dl.GetVideoInfoContext(ctx, urlStr)
 }
 
 func (sd *SmartDownloader) Download(urlStr, outputDir, resolution string) (*DownloadResult, error) {
-	dl := sd.selectDownloader(urlStr)
-	return dl.Download(urlStr, outputDir, resolution)
+	return sd.DownloadContext(context.Background(), urlStr, outputDir, resolution)
+}
+
+// DownloadContext 依次尝试路由到的下载器，直到下载成功、视频已下载或下载被取消
+// 成功或视频已下载时 DownloadResult.Downloader 记录实际完成下载的下载器，失败时为空
+func (sd *SmartDownloader) DownloadContext(ctx context.Context, urlStr, outputDir, resolution string) (*DownloadResult, error) {
+	chain := sd.route(urlStr)
+
+	var result *DownloadResult
+	var err error
+	for i, name := range chain {
+		result, err = sd.downloaders[name].DownloadContext(ctx, urlStr, outputDir, resolution)
+		done := err == nil && (result == nil || result.Success || isSkipped(result))
+		if done && result != nil {
+			result.Downloader = name
+		}
+		if ctx.Err() != nil || done {
+			return result, err
+		}
+
+		if i+1 < len(chain) {
+			cause := err
+			if cause == nil {
+				cause = result.Error
+			}
+			log.Printf("[智能下载器] %s 下载失败，改用 %s: %v", name, chain[i+1], cause)
+		}
+	}
+	return result, err
+}
+
+// route 返回URL的下载器链
+func (sd *SmartDownloader) route(urlStr string) []string {
+	match := utils.MatchURL(urlStr)
+	for _, rule := range sd.rules {
+		if rule.matches(urlStr, match) {
+			return rule.downloaders
+		}
+	}
+	return []string{"multi"}
 }
 
 func (sd *SmartDownloader) IsDownloaded(videoID string) bool {
@@ -51,23 +168,24 @@ func (sd *SmartDownloader) CheckYTDLP() error {
 	return sd.multiDownloader.CheckYTDLP()
 }
 
+// selectDownloader 返回URL的下载器链中的第一个下载器
 func (sd *SmartDownloader) selectDownloader(urlStr string) Downloader {
-	// 检查是否为 YouTube URL
-	if strings.Contains(urlStr, "youtube.com") || strings.Contains(urlStr, "youtu.be") {
-		// 检查是否为播放列表：包含 list 参数
-		if strings.Contains(urlStr, "list=") {
-			return sd.multiDownloader
-		}
+	return sd.downloaders[sd.route(urlStr)[0]]
+}
 
-		// 检查是否为频道
-		if strings.Contains(urlStr, "/channel/") || strings.Contains(urlStr, "/c/") || strings.Contains(urlStr, "/user/") {
-			return sd.multiDownloader
+// ExpandContext 路由到的第一个下载器是 YouTube 专用下载器时，用它展开 YouTube 播放列表和频道，其他URL不展开；
+// 展开失败时 ok 为 false，由 DownloadContext 按下载器链下载整个播放列表/频道；下载被取消时返回 ctx 的错误，调度器不再下载
+func (sd *SmartDownloader) ExpandContext(ctx context.Context, urlStr string) ([]PlaylistItem, bool, error) {
+	if sd.youtubeDownloader == nil || sd.route(urlStr)[0] != "youtube" {
+		return nil, false, nil
+	}
+	items, ok, err := sd.youtubeDownloader.ExpandContext(ctx, urlStr)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, false, err
 		}
-
-		// 单个视频：使用 YouTube 专用下载器
-		return sd.youtubeDownloader
+		log.Printf("[智能下载器] 展开播放列表/频道失败，改用下载器链下载: %v", err)
+		return nil, false, nil
 	}
-
-	// 非 YouTube URL：使用多平台下载器
-	return sd.multiDownloader
+	return items, ok, nil
 }
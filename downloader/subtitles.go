@@ -0,0 +1,324 @@
+package downloader
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/kkdai/youtube/v2"
+
+	"batch_download_videos/config"
+)
+
+// subtitleFile 已下载的字幕文件
+type subtitleFile struct {
+	Path string
+	Lang string
+}
+
+// subtitleSettings 返回字幕语言、字幕格式和是否嵌入，选项中未指定时使用配置文件中的值
+// 语言列表为空表示不下载字幕
+func subtitleSettings(cfg *config.Config, opts Options) (langs []string, format string, embed bool) {
+	if opts.NoSubtitles {
+		return nil, "", false
+	}
+
+	langs = cfg.SubtitleLangs
+	if len(opts.SubtitleLangs) > 0 {
+		langs = opts.SubtitleLangs
+	}
+
+	format = strings.ToLower(cfg.SubtitleFormat)
+	if format != "vtt" {
+		format = "srt"
+	}
+	return langs, format, cfg.EmbedSubtitles || opts.EmbedSubtitles
+}
+
+// matchSubtitleLang 判断字幕轨道的语言代码是否匹配配置的语言
+// "all" 匹配所有语言，"en" 同时匹配 "en-US"、"en-GB" 等地区变体
+func matchSubtitleLang(want, code string) bool {
+	want = strings.ToLower(want)
+	code = strings.ToLower(code)
+	if want == "all" || want == code {
+		return true
+	}
+	return strings.HasPrefix(code, want+"-")
+}
+
+// selectCaptionTracks 按配置的语言顺序选择字幕轨道，每种语言优先使用人工字幕
+// auto 为 true 时，没有人工字幕的语言使用自动生成的字幕
+func selectCaptionTracks(tracks []youtube.CaptionTrack, langs []string, auto bool) []youtube.CaptionTrack {
+	var selected []youtube.CaptionTrack
+	seen := make(map[string]bool)
+
+	add := func(track youtube.CaptionTrack) {
+		if seen[track.LanguageCode] {
+			return
+		}
+		seen[track.LanguageCode] = true
+		selected = append(selected, track)
+	}
+
+	for _, lang := range langs {
+		found := false
+		for _, track := range tracks {
+			if track.Kind != "asr" && matchSubtitleLang(lang, track.LanguageCode) {
+				add(track)
+				found = true
+			}
+		}
+		if found || !auto {
+			continue
+		}
+		for _, track := range tracks {
+			if track.Kind == "asr" && matchSubtitleLang(lang, track.LanguageCode) {
+				add(track)
+			}
+		}
+	}
+
+	return selected
+}
+
+// subtitlePath 返回字幕文件路径，与视频文件同名，例如 video.en.srt
+func subtitlePath(videoPath, lang, format string) string {
+	return strings.TrimSuffix(videoPath, filepath.Ext(videoPath)) + "." + lang + "." + format
+}
+
+// findSubtitleFiles 查找视频文件旁边的字幕文件（video.<lang>.srt/vtt），用于获取 yt-dlp 写入的字幕
+func findSubtitleFiles(videoPath string) []string {
+	dir := filepath.Dir(videoPath)
+	prefix := strings.TrimSuffix(filepath.Base(videoPath), filepath.Ext(videoPath)) + "."
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	var paths []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		if ext := strings.ToLower(filepath.Ext(name)); ext == ".srt" || ext == ".vtt" {
+			paths = append(paths, filepath.Join(dir, name))
+		}
+	}
+	return paths
+}
+
+// downloadSubtitles 下载视频的字幕轨道，保存到视频文件旁边
+// 单个字幕下载失败只记录日志，返回成功下载的字幕文件
+func (ytd *YouTubeDownloader) downloadSubtitles(ctx context.Context, video *youtube.Video, videoPath string, langs []string, format string) []subtitleFile {
+	tracks := selectCaptionTracks(video.CaptionTracks, langs, ytd.config.AutoSubtitles)
+	if len(tracks) == 0 {
+		log.Printf("没有找到匹配的字幕: %s (语言: %s)", video.ID, strings.Join(langs, ","))
+		return nil
+	}
+
+	client := ytd.client.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	var files []subtitleFile
+	for _, track := range tracks {
+		path := subtitlePath(videoPath, track.LanguageCode, format)
+		if err := fetchCaptionTrack(ctx, client, track, path, format); err != nil {
+			log.Printf("下载字幕失败 (%s): %v", track.LanguageCode, err)
+			continue
+		}
+		log.Printf("字幕下载完成: %s", path)
+		files = append(files, subtitleFile{Path: path, Lang: track.LanguageCode})
+	}
+	return files
+}
+
+// fetchCaptionTrack 以 WebVTT 格式下载字幕轨道，format 为 srt 时转换后保存
+func fetchCaptionTrack(ctx context.Context, client *http.Client, track youtube.CaptionTrack, path, format string) error {
+	trackURL, err := url.Parse(track.BaseURL)
+	if err != nil {
+		return fmt.Errorf("解析字幕地址失败: %w", err)
+	}
+	query := trackURL.Query()
+	query.Set("fmt", "vtt")
+	trackURL.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, trackURL.String(), nil)
+	if err != nil {
+		return fmt.Errorf("创建请求失败: %w", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP状态码错误: %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("读取字幕失败: %w", err)
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return fmt.Errorf("字幕内容为空")
+	}
+
+	if format == "srt" {
+		data = vttToSRT(data)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("保存字幕失败: %w", err)
+	}
+	return nil
+}
+
+// vttTimingPattern 匹配 WebVTT 的时间轴行，小时部分可以省略
+var vttTimingPattern = regexp.MustCompile(`^(?:(\d+):)?(\d{2}):(\d{2})\.(\d{3})\s+-->\s+(?:(\d+):)?(\d{2}):(\d{2})\.(\d{3})`)
+
+// vttTagPattern 匹配 WebVTT 的内联标签，例如 <c>、<00:00:01.000>
+var vttTagPattern = regexp.MustCompile(`<[^>]*>`)
+
+// vttToSRT 将 WebVTT 字幕转换为 SRT 格式，丢弃头部、样式和内联标签
+func vttToSRT(data []byte) []byte {
+	var out bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	index := 0
+	var text []string
+	timing := ""
+	flush := func() {
+		if timing != "" && len(text) > 0 {
+			index++
+			fmt.Fprintf(&out, "%d\n%s\n%s\n\n", index, timing, strings.Join(text, "\n"))
+		}
+		timing = ""
+		text = nil
+	}
+
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if m := vttTimingPattern.FindStringSubmatch(line); m != nil {
+			flush()
+			timing = srtTimestamp(m[1], m[2], m[3], m[4]) + " --> " + srtTimestamp(m[5], m[6], m[7], m[8])
+			continue
+		}
+		if timing == "" {
+			// 时间轴之前的内容是头部、NOTE、STYLE 或 cue 标识
+			continue
+		}
+		if strings.TrimSpace(line) == "" {
+			flush()
+			continue
+		}
+		if cleaned := strings.TrimSpace(vttTagPattern.ReplaceAllString(line, "")); cleaned != "" {
+			text = append(text, cleaned)
+		}
+	}
+	flush()
+
+	return out.Bytes()
+}
+
+// srtTimestamp 生成 SRT 格式的时间戳 HH:MM:SS,mmm
+func srtTimestamp(hours, minutes, seconds, millis string) string {
+	h, _ := strconv.Atoi(hours)
+	return fmt.Sprintf("%02d:%s:%s,%s", h, minutes, seconds, millis)
+}
+
+// subtitleCodec 返回嵌入到指定容器时使用的字幕编码
+func subtitleCodec(ext string) string {
+	switch strings.ToLower(strings.TrimPrefix(ext, ".")) {
+	case "webm":
+		return "webvtt"
+	case "mkv":
+		return "srt"
+	default:
+		return "mov_text"
+	}
+}
+
+// embedSubtitles 使用ffmpeg将字幕嵌入到视频文件中，音视频流不重新编码
+func embedSubtitles(ctx context.Context, configuredFfmpeg, videoPath string, subtitles []subtitleFile) error {
+	ext := filepath.Ext(videoPath)
+	tmpPath := strings.TrimSuffix(videoPath, ext) + ".subs" + ext
+
+	args := []string{"-y", "-i", videoPath}
+	for _, sub := range subtitles {
+		args = append(args, "-i", sub.Path)
+	}
+	args = append(args, "-map", "0:v?", "-map", "0:a?")
+	for i := range subtitles {
+		args = append(args, "-map", strconv.Itoa(i+1))
+	}
+	args = append(args, "-c", "copy", "-c:s", subtitleCodec(ext))
+	for i, sub := range subtitles {
+		args = append(args, fmt.Sprintf("-metadata:s:s:%d", i), "language="+sub.Lang)
+	}
+	args = append(args, tmpPath)
+
+	cmd := exec.CommandContext(ctx, ffmpegPath(configuredFfmpeg), args...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("ffmpeg嵌入字幕失败: %w\n%s", err, ffmpegErrorOutput(output))
+	}
+	if err := os.Rename(tmpPath, videoPath); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("重命名文件失败: %w", err)
+	}
+
+	log.Printf("字幕嵌入完成: %s (%d 条字幕)", videoPath, len(subtitles))
+	return nil
+}
+
+// ytDlpSubtitleArgs 返回 yt-dlp 的字幕参数，语言列表为空时返回 nil
+func ytDlpSubtitleArgs(cfg *config.Config, opts Options) []string {
+	langs, format, embed := subtitleSettings(cfg, opts)
+	if len(langs) == 0 {
+		return nil
+	}
+
+	args := []string{"--write-subs"}
+	if cfg.AutoSubtitles {
+		args = append(args, "--write-auto-subs")
+	}
+	args = append(args, "--sub-langs", ytDlpSubtitleLangs(langs), "--sub-format", format+"/best")
+
+	if ffmpegAvailable(cfg.FfmpegPath) {
+		args = append(args, "--convert-subs", format)
+		if embed {
+			args = append(args, "--embed-subs")
+		}
+	} else if embed {
+		log.Printf("未找到ffmpeg，字幕将不会嵌入到视频中")
+	}
+	return args
+}
+
+// ytDlpSubtitleLangs 将语言列表转换为 yt-dlp 的 --sub-langs 参数，"en" 同时匹配 "en-US" 等地区变体
+func ytDlpSubtitleLangs(langs []string) string {
+	patterns := make([]string, 0, len(langs))
+	for _, lang := range langs {
+		if strings.EqualFold(lang, "all") {
+			patterns = append(patterns, "all")
+			continue
+		}
+		patterns = append(patterns, regexp.QuoteMeta(lang)+"(-.*)?")
+	}
+	return strings.Join(patterns, ",")
+}
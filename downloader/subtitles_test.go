@@ -0,0 +1,69 @@
+package downloader
+
+import (
+	"testing"
+
+	"github.com/kkdai/youtube/v2"
+)
+
+func TestSelectCaptionTracks(t *testing.T) {
+	tracks := []youtube.CaptionTrack{
+		{LanguageCode: "en", Kind: "asr"},
+		{LanguageCode: "en-US"},
+		{LanguageCode: "zh-Hans", Kind: "asr"},
+		{LanguageCode: "ja"},
+	}
+
+	tests := []struct {
+		name  string
+		langs []string
+		auto  bool
+		want  []string
+	}{
+		{"manual preferred", []string{"en"}, true, []string{"en-US"}},
+		{"auto fallback", []string{"zh"}, true, []string{"zh-Hans"}},
+		{"no auto", []string{"zh", "ja"}, false, []string{"ja"}},
+		{"all", []string{"all"}, false, []string{"en-US", "ja"}},
+		{"no match", []string{"fr"}, true, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := selectCaptionTracks(tracks, tt.langs, tt.auto)
+			if len(got) != len(tt.want) {
+				t.Fatalf("selectCaptionTracks() returned %d tracks, want %d", len(got), len(tt.want))
+			}
+			for i, track := range got {
+				if track.LanguageCode != tt.want[i] {
+					t.Errorf("track %d = %q, want %q", i, track.LanguageCode, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestVttToSRT(t *testing.T) {
+	vtt := "WEBVTT\nKind: captions\nLanguage: en\n\n" +
+		"00:00:01.000 --> 00:00:03.500 align:start position:0%\n" +
+		"Hello <c>world</c>\n\n" +
+		"cue-2\n" +
+		"01:02.250 --> 01:04.000\n" +
+		"Second line\n" +
+		"continues\n"
+
+	want := "1\n00:00:01,000 --> 00:00:03,500\nHello world\n\n" +
+		"2\n00:01:02,250 --> 00:01:04,000\nSecond line\ncontinues\n\n"
+
+	if got := string(vttToSRT([]byte(vtt))); got != want {
+		t.Errorf("vttToSRT() =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestYtDlpSubtitleLangs(t *testing.T) {
+	if got := ytDlpSubtitleLangs([]string{"en", "zh-Hans"}); got != "en(-.*)?,zh-Hans(-.*)?" {
+		t.Errorf("ytDlpSubtitleLangs() = %q", got)
+	}
+	if got := ytDlpSubtitleLangs([]string{"all"}); got != "all" {
+		t.Errorf("ytDlpSubtitleLangs() = %q, want %q", got, "all")
+	}
+}
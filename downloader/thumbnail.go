@@ -0,0 +1,221 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/kkdai/youtube/v2"
+
+	"batch_download_videos/config"
+)
+
+// bestThumbnail 返回分辨率最高的缩略图，没有缩略图时返回 nil
+func bestThumbnail(thumbnails youtube.Thumbnails) *youtube.Thumbnail {
+	var best *youtube.Thumbnail
+	for i := range thumbnails {
+		thumbnail := &thumbnails[i]
+		if thumbnail.URL == "" {
+			continue
+		}
+		if best == nil || thumbnail.Width*thumbnail.Height > best.Width*best.Height {
+			best = thumbnail
+		}
+	}
+	return best
+}
+
+// thumbnailExtension 根据缩略图地址判断扩展名，只区分 webp 和 jpg
+func thumbnailExtension(thumbnailURL string) string {
+	if u, err := url.Parse(thumbnailURL); err == nil {
+		if strings.EqualFold(path.Ext(u.Path), ".webp") {
+			return ".webp"
+		}
+	}
+	return ".jpg"
+}
+
+// thumbnailPath 返回缩略图文件路径，与视频文件同名，例如 video.jpg
+func thumbnailPath(videoPath, ext string) string {
+	return strings.TrimSuffix(videoPath, filepath.Ext(videoPath)) + ext
+}
+
+// downloadThumbnail 下载视频分辨率最高的缩略图，保存到视频文件旁边，返回缩略图路径
+func (ytd *YouTubeDownloader) downloadThumbnail(ctx context.Context, video *youtube.Video, videoPath string) (string, error) {
+	thumbnail := bestThumbnail(video.Thumbnails)
+	if thumbnail == nil {
+		return "", fmt.Errorf("视频没有缩略图")
+	}
+
+	client := ytd.client.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	outputPath := thumbnailPath(videoPath, thumbnailExtension(thumbnail.URL))
+	if err := fetchThumbnail(ctx, client, thumbnail.URL, outputPath); err != nil {
+		return "", err
+	}
+
+	log.Printf("缩略图下载完成: %s (%dx%d)", outputPath, thumbnail.Width, thumbnail.Height)
+	return outputPath, nil
+}
+
+// processThumbnail 下载缩略图并按配置嵌入为封面，只嵌入不保存时嵌入后删除缩略图文件
+// 失败只记录日志，返回保留下来的缩略图路径
+func (ytd *YouTubeDownloader) processThumbnail(ctx context.Context, video *youtube.Video, mediaPath string) string {
+	thumbnail, err := ytd.downloadThumbnail(ctx, video, mediaPath)
+	if err != nil {
+		log.Printf("下载缩略图失败: %v", err)
+		return ""
+	}
+
+	if ytd.config.EmbedThumbnail {
+		if !ffmpegAvailable(ytd.config.FfmpegPath) {
+			log.Printf("未找到ffmpeg，缩略图将不会嵌入到视频中")
+		} else if err := embedThumbnail(ctx, ytd.config.FfmpegPath, mediaPath, thumbnail); err != nil {
+			log.Printf("嵌入封面失败: %v", err)
+		}
+	}
+
+	if !ytd.config.WriteThumbnail {
+		if err := os.Remove(thumbnail); err != nil {
+			log.Printf("删除缩略图失败: %v", err)
+		}
+		return ""
+	}
+	return thumbnail
+}
+
+// fetchThumbnail 下载缩略图到 outputPath，先写入临时文件，完成后重命名
+func fetchThumbnail(ctx context.Context, client *http.Client, thumbnailURL, outputPath string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, thumbnailURL, nil)
+	if err != nil {
+		return fmt.Errorf("创建请求失败: %w", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP状态码错误: %d", resp.StatusCode)
+	}
+
+	partPath := outputPath + partSuffix
+	file, err := os.Create(partPath)
+	if err != nil {
+		return fmt.Errorf("创建文件失败: %w", err)
+	}
+	if _, err := io.Copy(file, resp.Body); err != nil {
+		file.Close()
+		os.Remove(partPath)
+		return fmt.Errorf("保存缩略图失败: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(partPath)
+		return fmt.Errorf("保存缩略图失败: %w", err)
+	}
+	if err := os.Rename(partPath, outputPath); err != nil {
+		os.Remove(partPath)
+		return fmt.Errorf("重命名临时文件失败: %w", err)
+	}
+	return nil
+}
+
+// coverArtVideoStreams 返回支持嵌入封面的容器中原有的视频流数量，不支持的容器返回 -1
+// 封面作为最后一个视频流写入，需要知道它的序号
+func coverArtVideoStreams(ext string) int {
+	switch strings.ToLower(strings.TrimPrefix(ext, ".")) {
+	case "mp4", "m4v", "mov":
+		return 1
+	case "m4a", "mp3":
+		return 0
+	default:
+		return -1
+	}
+}
+
+// embedThumbnail 使用ffmpeg将缩略图作为封面嵌入到 mp4/m4a/mp3 文件中，音视频流不重新编码
+// 缩略图统一转换为 jpeg，mp4 容器不支持 webp 封面
+func embedThumbnail(ctx context.Context, configuredFfmpeg, mediaPath, coverPath string) error {
+	ext := filepath.Ext(mediaPath)
+	index := coverArtVideoStreams(ext)
+	if index < 0 {
+		return fmt.Errorf("不支持在 %s 文件中嵌入封面", ext)
+	}
+	tmpPath := strings.TrimSuffix(mediaPath, ext) + ".cover" + ext
+
+	args := []string{
+		"-y",
+		"-i", mediaPath,
+		"-i", coverPath,
+		"-map", "0",
+		"-map", "1:v:0",
+		"-c", "copy",
+		fmt.Sprintf("-c:v:%d", index), "mjpeg",
+		fmt.Sprintf("-disposition:v:%d", index), "attached_pic",
+	}
+	if strings.EqualFold(ext, ".mp3") {
+		args = append(args, "-id3v2_version", "3")
+	}
+	args = append(args, tmpPath)
+
+	cmd := exec.CommandContext(ctx, ffmpegPath(configuredFfmpeg), args...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("ffmpeg嵌入封面失败: %w\n%s", err, ffmpegErrorOutput(output))
+	}
+	if err := os.Rename(tmpPath, mediaPath); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("重命名文件失败: %w", err)
+	}
+
+	log.Printf("封面嵌入完成: %s", mediaPath)
+	return nil
+}
+
+// ytDlpThumbnailArgs 返回 yt-dlp 的缩略图参数，未启用缩略图时返回 nil
+func ytDlpThumbnailArgs(cfg *config.Config) []string {
+	if !cfg.WriteThumbnail && !cfg.EmbedThumbnail {
+		return nil
+	}
+
+	var args []string
+	if cfg.WriteThumbnail {
+		args = append(args, "--write-thumbnail")
+	}
+	if !ffmpegAvailable(cfg.FfmpegPath) {
+		if cfg.EmbedThumbnail {
+			log.Printf("未找到ffmpeg，缩略图将不会嵌入到视频中")
+		}
+		return args
+	}
+
+	// 统一转换为 jpg，webp 封面很多播放器和媒体库无法识别
+	args = append(args, "--convert-thumbnails", "jpg")
+	if cfg.EmbedThumbnail {
+		args = append(args, "--embed-thumbnail")
+	}
+	return args
+}
+
+// findThumbnailFile 查找视频文件旁边的缩略图文件，用于获取 yt-dlp 写入的缩略图
+func findThumbnailFile(videoPath string) string {
+	for _, ext := range []string{".jpg", ".webp", ".png"} {
+		path := thumbnailPath(videoPath, ext)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
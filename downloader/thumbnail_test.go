@@ -0,0 +1,36 @@
+package downloader
+
+import (
+	"testing"
+
+	"github.com/kkdai/youtube/v2"
+)
+
+func TestBestThumbnail(t *testing.T) {
+	thumbnails := youtube.Thumbnails{
+		{URL: "https://i.ytimg.com/vi/test/default.jpg", Width: 120, Height: 90},
+		{URL: "https://i.ytimg.com/vi_webp/test/maxresdefault.webp", Width: 1280, Height: 720},
+		{URL: "https://i.ytimg.com/vi/test/hqdefault.jpg", Width: 480, Height: 360},
+	}
+
+	best := bestThumbnail(thumbnails)
+	if best == nil || best.Width != 1280 {
+		t.Fatalf("bestThumbnail() = %v, want 1280x720", best)
+	}
+	if ext := thumbnailExtension(best.URL); ext != ".webp" {
+		t.Errorf("thumbnailExtension() = %q, want %q", ext, ".webp")
+	}
+	if ext := thumbnailExtension("https://i.ytimg.com/vi/test/hqdefault.jpg?sqp=abc"); ext != ".jpg" {
+		t.Errorf("thumbnailExtension() = %q, want %q", ext, ".jpg")
+	}
+
+	if bestThumbnail(nil) != nil {
+		t.Error("bestThumbnail(nil) should return nil")
+	}
+}
+
+func TestThumbnailPath(t *testing.T) {
+	if got := thumbnailPath("output/youtube/video.mp4", ".jpg"); got != "output/youtube/video.jpg" {
+		t.Errorf("thumbnailPath() = %q", got)
+	}
+}
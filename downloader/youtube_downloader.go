@@ -3,9 +3,7 @@ package downloader
 import (
 	"context"
 	"fmt"
-	"io"
 	"log"
-	"math"
 	"math/rand"
 	"net/http"
 	"net/url"
@@ -30,6 +28,8 @@ type YouTubeDownloader struct {
 	config    *config.Config
 	indexer   *indexer.Indexer
 	outputDir string
+	// channelLister 展开频道时列出频道中的视频
+	channelLister ChannelLister
 }
 
 func NewYouTubeDownloader(cfg *config.Config, idx *indexer.Indexer) *YouTubeDownloader {
@@ -60,13 +60,19 @@ func NewYouTubeDownloader(cfg *config.Config, idx *indexer.Indexer) *YouTubeDown
 	}
 
 	return &YouTubeDownloader{
-		client:    &client,
-		config:    cfg,
-		indexer:   idx,
-		outputDir: cfg.GetOutputDir(""),
+		client:        &client,
+		config:        cfg,
+		indexer:       idx,
+		outputDir:     cfg.GetOutputDir(""),
+		channelLister: NewYtDlpChannelLister(cfg),
 	}
 }
 
+// SetChannelLister 替换展开频道时使用的视频列表读取器，默认使用 yt-dlp
+func (ytd *YouTubeDownloader) SetChannelLister(lister ChannelLister) {
+	ytd.channelLister = lister
+}
+
 func (ytd *YouTubeDownloader) Name() string {
 	return "YouTube专用下载器"
 }
@@ -76,7 +82,11 @@ func (ytd *YouTubeDownloader) SupportedPlatforms() []string {
 }
 
 func (ytd *YouTubeDownloader) GetVideoInfo(url string) (*VideoInfo, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	return ytd.GetVideoInfoContext(context.Background(), url)
+}
+
+func (ytd *YouTubeDownloader) GetVideoInfoContext(ctx context.Context, url string) (*VideoInfo, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
 
 	videoID, err := youtube.ExtractVideoID(url)
@@ -86,7 +96,7 @@ func (ytd *YouTubeDownloader) GetVideoInfo(url string) (*VideoInfo, error) {
 
 	video, err := ytd.client.GetVideoContext(ctx, videoID)
 	if err != nil {
-		return nil, fmt.Errorf("获取视频失败: %w", err)
+		return nil, fmt.Errorf("获取视频失败: %w", classifyError(err))
 	}
 
 	return &VideoInfo{
@@ -102,11 +112,26 @@ func (ytd *YouTubeDownloader) GetVideoInfo(url string) (*VideoInfo, error) {
 }
 
 func (ytd *YouTubeDownloader) Download(url, outputDir, resolution string) (*DownloadResult, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), ytd.config.TimeoutPerVideo)
-	defer cancel()
+	return ytd.DownloadContext(context.Background(), url, outputDir, resolution)
+}
+
+func (ytd *YouTubeDownloader) DownloadContext(ctx context.Context, url, outputDir, resolution string) (*DownloadResult, error) {
+	if ytd.config.TimeoutPerVideo > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, ytd.config.TimeoutPerVideo)
+		defer cancel()
+	}
 
 	log.Printf("[YouTube下载器] 开始处理下载请求: %s", url)
 
+	opts := optionsFromContext(ctx)
+
+	// 先按URL检查索引，已下载的视频不再请求视频信息
+	if record, ok := ytd.indexer.LookupURL(url, opts.AudioOnly); ok {
+		log.Printf("[YouTube下载器] 视频已下载，跳过: %s", url)
+		return alreadyDownloaded(record.ID, record.Title), nil
+	}
+
 	videoID, err := youtube.ExtractVideoID(url)
 	if err != nil {
 		log.Printf("[YouTube下载器] 提取视频ID失败: %v", err)
@@ -117,11 +142,19 @@ func (ytd *YouTubeDownloader) Download(url, outputDir, resolution string) (*Down
 	video, err := ytd.client.GetVideoContext(ctx, videoID)
 	if err != nil {
 		log.Printf("[YouTube下载器] 获取视频信息失败: %v", err)
-		return nil, fmt.Errorf("获取视频失败: %w", err)
+		return nil, fmt.Errorf("获取视频失败: %w", classifyError(err))
 	}
 	log.Printf("[YouTube下载器] 获取到视频信息: 标题='%s', 作者='%s', 时长=%d秒", video.Title, video.Author, int(video.Duration.Seconds()))
 
-	if ytd.indexer.IsDownloaded(video.ID) {
+	audioFormatName, audioBitrate := audioSettings(ytd.config, opts)
+
+	// 音频模式下载的文件与视频分别记录在索引中
+	indexKey := video.ID
+	if opts.AudioOnly {
+		indexKey = indexer.AudioKey(video.ID)
+	}
+
+	if ytd.indexer.IsDownloaded(indexKey) {
 		log.Printf("[YouTube下载器] 视频已下载，跳过: %s", video.Title)
 		return &DownloadResult{
 			Success:    false,
@@ -129,7 +162,7 @@ func (ytd *YouTubeDownloader) Download(url, outputDir, resolution string) (*Down
 			Title:      video.Title,
 			FilePath:   "",
 			FileSize:   0,
-			Error:      fmt.Errorf("视频已下载"),
+			Error:      ErrAlreadyDownloaded,
 			RetryCount: 0,
 		}, nil
 	}
@@ -137,6 +170,9 @@ func (ytd *YouTubeDownloader) Download(url, outputDir, resolution string) (*Down
 	// 获取平台特定的输出目录
 	platform := "youtube"
 	platformOutputDir := ytd.config.GetPlatformOutputDir(platform)
+	if opts.AudioOnly {
+		platformOutputDir = ytd.config.GetPlatformAudioDir(platform)
+	}
 	log.Printf("[YouTube下载器] 使用输出目录: %s", platformOutputDir)
 
 	// 确保平台输出目录存在
@@ -146,9 +182,31 @@ func (ytd *YouTubeDownloader) Download(url, outputDir, resolution string) (*Down
 	}
 	log.Printf("[YouTube下载器] 输出目录已准备就绪: %s", platformOutputDir)
 
+	// 选择格式，文件扩展名由实际选择的格式决定
+	// 音频模式只下载一个音频流；视频模式下 audioFormat 不为空时需要合并音视频
+	var mainFormat, audioFormat *youtube.Format
+	if opts.AudioOnly {
+		mainFormat = ytd.selectAudioFormat(video, audioSourceContainer(audioFormatName))
+		if mainFormat == nil {
+			return nil, fmt.Errorf("未找到合适的音频格式: %w", ErrFormatUnavailable)
+		}
+	} else {
+		mainFormat, audioFormat = ytd.selectFormats(video, resolution)
+		if mainFormat == nil {
+			return nil, fmt.Errorf("未找到合适的视频格式: %w", ErrFormatUnavailable)
+		}
+	}
+
 	// 生成符合OutputTemplate的文件名
-	filename := ytd.generateFilename(video, ".mp4")
+	filename := ytd.generateFilename(video, formatExtension(mainFormat, audioFormat))
 	outputPath := filepath.Join(platformOutputDir, filename)
+	// 先下载到只由视频ID和格式决定的文件，中断后重试或下次运行时从 .part 继续，完成后再重命名为 filename
+	itags := fmt.Sprintf("f%d", mainFormat.ItagNo)
+	if audioFormat != nil {
+		itags += fmt.Sprintf("+%d", audioFormat.ItagNo)
+	}
+	partialName := partialFileName("youtube", video.ID, itags, formatExtension(mainFormat, audioFormat))
+	partialPath := filepath.Join(platformOutputDir, partialName)
 
 	if err := utils.CleanupZeroByteFiles(outputPath); err != nil {
 		log.Printf("清理0字节文件失败: %v", err)
@@ -157,40 +215,38 @@ func (ytd *YouTubeDownloader) Download(url, outputDir, resolution string) (*Down
 	log.Printf("开始下载: %s (ID: %s)", video.Title, video.ID)
 
 	var lastErr error
-	maxDelay := 30 * time.Second // 最大延迟上限
+	policy := NewRetryPolicy(ytd.config, "youtube")
+	attempts := 0
 
-	for retry := 0; retry < ytd.config.MaxRetries; retry++ {
+	for retry := 0; retry < policy.MaxAttempts; retry++ {
 		if retry > 0 {
-			// 指数退避算法：基础延迟 * (2^重试次数)
-			baseDelay := ytd.config.BaseRetryDelay
-			exponentialDelay := baseDelay * time.Duration(math.Pow(2, float64(retry-1)))
-
-			// 添加随机抖动 (±20%)，避免多个请求同时重试导致的网络拥塞
-			jitter := time.Duration(float64(exponentialDelay) * 0.2 * (2*rand.Float64() - 1))
-			totalDelay := exponentialDelay + jitter
-
-			// 确保延迟不超过最大值
-			if totalDelay > maxDelay {
-				totalDelay = maxDelay
+			// 按错误类别决定是否重试，视频不可用等永久性错误不再重试
+			delay, ok := policy.Next(lastErr, retry)
+			if !ok {
+				log.Printf("错误不可重试，放弃下载: %v", lastErr)
+				break
 			}
-
-			// 确保延迟为正值
-			if totalDelay < 0 {
-				totalDelay = 0
+			log.Printf("重试 %d/%d，等待 %v 后重试...", retry, policy.MaxAttempts, delay)
+			if err := utils.SleepContext(ctx, delay); err != nil {
+				return nil, fmt.Errorf("下载已取消: %w", err)
 			}
-
-			log.Printf("重试 %d/%d，等待 %v 后重试...", retry, ytd.config.MaxRetries, totalDelay)
-			time.Sleep(totalDelay)
 		}
+		attempts++
 
-		err := ytd.downloadVideo(ctx, video, filename, platformOutputDir, resolution)
+		err := ytd.downloadVideo(ctx, video, mainFormat, audioFormat, partialName, platformOutputDir, resolution)
 		if err != nil {
-			lastErr = err
-			log.Printf("下载失败 (尝试 %d/%d): %v", retry+1, ytd.config.MaxRetries, err)
+			if ctx.Err() != nil {
+				// 下载被取消或超时，不再重试，保留 .part 文件下次运行时继续下载
+				log.Printf("下载已取消: %s (ID: %s)", video.Title, video.ID)
+				return nil, fmt.Errorf("下载已取消: %w", ctx.Err())
+			}
+			lastErr = classifyError(err)
+			log.Printf("下载失败 (尝试 %d/%d): %v", retry+1, policy.MaxAttempts, err)
 			continue
 		}
-
-		ytd.indexer.MarkDownloaded(video.ID)
+		if err := os.Rename(partialPath, outputPath); err != nil {
+			return nil, fmt.Errorf("重命名下载文件失败: %w", err)
+		}
 
 		// 处理Meta文件的生成
 		if ytd.config.GenerateMetaFile {
@@ -199,8 +255,26 @@ func (ytd *YouTubeDownloader) Download(url, outputDir, resolution string) (*Down
 			}
 		}
 
+		// 处理音频转码
+		if opts.AudioOnly && audioFormatName != "" &&
+			(audioBitrate != "" || !strings.EqualFold(filepath.Ext(filename), "."+audioFormatName)) {
+			newFilename := strings.TrimSuffix(filename, filepath.Ext(filename)) + "." + audioFormatName
+			newOutputPath := filepath.Join(platformOutputDir, newFilename)
+			if !ffmpegAvailable(ytd.config.FfmpegPath) {
+				log.Printf("未找到ffmpeg，保留原始音频格式: %s", outputPath)
+			} else if err := transcodeAudio(ctx, ytd.config.FfmpegPath, outputPath, newOutputPath, audioFormatName, audioBitrate); err != nil {
+				log.Printf("音频转码失败: %v", err)
+			} else {
+				if err := os.Remove(outputPath); err != nil {
+					log.Printf("删除原始音频失败: %v", err)
+				}
+				outputPath = newOutputPath
+				filename = newFilename
+			}
+		}
+
 		// 处理视频格式转换
-		if ytd.config.RecodeVideo != "" {
+		if !opts.AudioOnly && ytd.config.RecodeVideo != "" && !strings.EqualFold(filepath.Ext(filename), "."+ytd.config.RecodeVideo) {
 			newFilename := strings.TrimSuffix(filename, filepath.Ext(filename)) + "." + ytd.config.RecodeVideo
 			newOutputPath := filepath.Join(platformOutputDir, newFilename)
 			if err := ytd.convertVideoFormat(outputPath, newOutputPath); err != nil {
@@ -212,12 +286,39 @@ func (ytd *YouTubeDownloader) Download(url, outputDir, resolution string) (*Down
 			}
 		}
 
+		// 处理字幕下载和嵌入
+		var subtitlePaths []string
+		if langs, subtitleFormat, embed := subtitleSettings(ytd.config, opts); !opts.AudioOnly && len(langs) > 0 {
+			subtitles := ytd.downloadSubtitles(ctx, video, outputPath, langs, subtitleFormat)
+			for _, sub := range subtitles {
+				subtitlePaths = append(subtitlePaths, sub.Path)
+			}
+			if embed && len(subtitles) > 0 {
+				if !ffmpegAvailable(ytd.config.FfmpegPath) {
+					log.Printf("未找到ffmpeg，字幕将不会嵌入到视频中")
+				} else if err := embedSubtitles(ctx, ytd.config.FfmpegPath, outputPath, subtitles); err != nil {
+					log.Printf("嵌入字幕失败: %v", err)
+				}
+			}
+		}
+
+		// 处理缩略图下载和封面嵌入
+		thumbnail := ""
+		if ytd.config.WriteThumbnail || ytd.config.EmbedThumbnail {
+			thumbnail = ytd.processThumbnail(ctx, video, outputPath)
+		}
+
 		info, _ := os.Stat(outputPath)
 		fileSize := int64(0)
 		if info != nil {
 			fileSize = info.Size()
 		}
 
+		// 后处理全部完成后再写入索引，记录最终文件的大小和校验和
+		if err := ytd.indexer.AddRecord(newIndexRecord(indexKey, platform, url, video.Title, outputPath, ytd.Name())); err != nil {
+			log.Printf("写入下载索引失败: %v", err)
+		}
+
 		log.Printf("下载完成: %s (ID: %s)", video.Title, video.ID)
 		return &DownloadResult{
 			Success:    true,
@@ -225,12 +326,14 @@ func (ytd *YouTubeDownloader) Download(url, outputDir, resolution string) (*Down
 			Title:      video.Title,
 			FilePath:   outputPath,
 			FileSize:   fileSize,
+			Subtitles:  subtitlePaths,
+			Thumbnail:  thumbnail,
 			Error:      nil,
 			RetryCount: retry,
 		}, nil
 	}
 
-	return nil, fmt.Errorf("下载失败: %w (尝试 %d 次后放弃)", lastErr, ytd.config.MaxRetries)
+	return nil, fmt.Errorf("下载失败: %w", &RetryError{Attempts: attempts, Err: lastErr})
 }
 
 func (ytd *YouTubeDownloader) IsDownloaded(videoID string) bool {
@@ -238,11 +341,10 @@ func (ytd *YouTubeDownloader) IsDownloaded(videoID string) bool {
 }
 
 func (ytd *YouTubeDownloader) MarkDownloaded(videoID string) error {
-	ytd.indexer.MarkDownloaded(videoID)
-	return nil
+	return ytd.indexer.MarkDownloaded(videoID)
 }
 
-func (ytd *YouTubeDownloader) downloadVideo(ctx context.Context, video *youtube.Video, filename, outputDir, resolution string) error {
+func (ytd *YouTubeDownloader) downloadVideo(ctx context.Context, video *youtube.Video, videoFormat, audioFormat *youtube.Format, filename, outputDir, resolution string) error {
 	// 创建进度条管理器，设置更高的刷新率
 	p := mpb.New(
 		mpb.WithWidth(80), // 增加进度条宽度
@@ -250,12 +352,16 @@ func (ytd *YouTubeDownloader) downloadVideo(ctx context.Context, video *youtube.
 		mpb.WithOutput(os.Stderr),                 // 将进度条输出到标准错误
 	)
 
-	format := ytd.selectBestFormat(video, resolution)
-	if format == nil {
-		return fmt.Errorf("未找到合适的视频格式")
+	// 分离的音视频流分别下载，进度条按两者的总大小计算
+	formats := []*youtube.Format{videoFormat}
+	if audioFormat != nil {
+		formats = append(formats, audioFormat)
 	}
 
-	totalBytes := format.ContentLength
+	totalBytes := int64(0)
+	for _, format := range formats {
+		totalBytes += format.ContentLength
+	}
 	if totalBytes == 0 {
 		totalBytes = 100 * 1024 * 1024
 	}
@@ -277,67 +383,107 @@ func (ytd *YouTubeDownloader) downloadVideo(ctx context.Context, video *youtube.
 	)
 
 	// 记录开始下载的日志
-	log.Printf("开始下载视频: %s (ID: %s, 分辨率: %s, 格式: %s)",
-		video.Title, video.ID, resolution, format.MimeType)
-
-	stream, size, err := ytd.client.GetStreamContext(ctx, video, format)
-	if err != nil {
-		log.Printf("获取视频流失败: %v", err)
-		return fmt.Errorf("获取视频流失败: %w", err)
+	if audioFormat != nil {
+		log.Printf("开始下载视频: %s (ID: %s, 分辨率: %s, 视频格式: %s, 音频格式: %s)",
+			video.Title, video.ID, resolution, videoFormat.MimeType, audioFormat.MimeType)
+	} else {
+		log.Printf("开始下载视频: %s (ID: %s, 分辨率: %s, 格式: %s)",
+			video.Title, video.ID, resolution, videoFormat.MimeType)
 	}
-	defer stream.Close()
 
 	outputPath := filepath.Join(outputDir, filename)
-	file, err := os.Create(outputPath)
-	if err != nil {
-		log.Printf("创建文件失败: %v", err)
-		return fmt.Errorf("创建文件失败: %w", err)
-	}
-	defer file.Close()
-
-	// 记录文件创建成功的日志
 	log.Printf("创建输出文件: %s", outputPath)
 
+	// 向调用方上报结构化进度事件
+	tracker := newProgressTracker(ctx, video.ID, video.Title)
+
 	// 上次记录进度的时间和字节数
 	lastLogTime := time.Now()
-	lastLogBytes := int64(0)
+	lastLogBytes := int64(-1)
 	logInterval := 5 * time.Second // 日志记录间隔
 
-	reader := &ProgressReader{
-		Reader: stream,
-		Total:  size,
-		OnProgress: func(current, total int64) {
-			// 更新进度条
-			bar.SetCurrent(current)
-
-			// 定期记录进度日志
-			currentTime := time.Now()
-			if currentTime.Sub(lastLogTime) >= logInterval {
-				downloaded := current - lastLogBytes
-				speed := float64(downloaded) / currentTime.Sub(lastLogTime).Seconds() / 1024 / 1024 // MB/s
-				progress := float64(current) / float64(total) * 100
-
-				log.Printf("下载进度: %s - %.2f%% (%.2f MB/%.2f MB, %.2f MB/s)",
-					utils.TruncateString(video.Title, 30),
-					progress,
-					float64(current)/1024/1024,
-					float64(total)/1024/1024,
-					speed)
-
-				lastLogTime = currentTime
-				lastLogBytes = current
-			}
-		},
+	onProgress := func(current, total int64) {
+		if total <= 0 {
+			total = totalBytes
+		} else if total != totalBytes {
+			// 格式信息中没有大小时，以服务器返回的大小为准
+			totalBytes = total
+			bar.SetTotal(totalBytes, false)
+		}
+		// 更新进度条
+		bar.SetCurrent(current)
+		tracker.Update(current, total)
+
+		// 续传时从已有的字节数开始计算速度
+		if lastLogBytes < 0 {
+			lastLogBytes = current
+		}
+
+		// 定期记录进度日志
+		currentTime := time.Now()
+		if currentTime.Sub(lastLogTime) >= logInterval {
+			downloaded := current - lastLogBytes
+			speed := float64(downloaded) / currentTime.Sub(lastLogTime).Seconds() / 1024 / 1024 // MB/s
+			progress := float64(current) / float64(total) * 100
+
+			log.Printf("下载进度: %s - %.2f%% (%.2f MB/%.2f MB, %.2f MB/s)",
+				utils.TruncateString(video.Title, 30),
+				progress,
+				float64(current)/1024/1024,
+				float64(total)/1024/1024,
+				speed)
+
+			lastLogTime = currentTime
+			lastLogBytes = current
+		}
 	}
 
-	// 开始下载
-	log.Printf("开始读取视频流，总大小: %.2f MB", float64(size)/1024/1024)
+	// 开始下载，按配置拆分为多个分段并发下载，数据先写入 .part 文件，重试时从已下载的位置继续
+	log.Printf("开始读取视频流，总大小: %.2f MB", float64(totalBytes)/1024/1024)
 
-	if _, err := io.Copy(file, reader); err != nil {
+	fail := func(err error) error {
 		log.Printf("下载失败: %v", err)
+		bar.Abort(false)
+		p.Wait()
 		return fmt.Errorf("下载失败: %w", err)
 	}
 
+	downloaded := int64(0)
+	if audioFormat == nil {
+		size, err := ytd.downloadStream(ctx, video, videoFormat, outputPath, 0, 0, onProgress)
+		if err != nil {
+			return fail(err)
+		}
+		downloaded = size
+	} else {
+		// 音视频分别下载到临时文件，再用 ffmpeg 合并
+		streamPaths := make([]string, 0, len(formats))
+		for i, format := range formats {
+			remaining := int64(0)
+			for _, next := range formats[i+1:] {
+				remaining += next.ContentLength
+			}
+
+			streamPath := streamFilePath(outputPath, format)
+			size, err := ytd.downloadStream(ctx, video, format, streamPath, downloaded, remaining, onProgress)
+			if err != nil {
+				return fail(err)
+			}
+			downloaded += size
+			streamPaths = append(streamPaths, streamPath)
+		}
+
+		if err := ytd.mergeStreams(ctx, streamPaths[0], streamPaths[1], outputPath); err != nil {
+			return fail(err)
+		}
+		for _, streamPath := range streamPaths {
+			if err := os.Remove(streamPath); err != nil {
+				log.Printf("删除临时文件失败: %v", err)
+			}
+		}
+	}
+	tracker.Finish(downloaded, downloaded)
+
 	// 完成进度条
 	bar.SetTotal(totalBytes, true)
 	p.Wait()
@@ -349,9 +495,71 @@ func (ytd *YouTubeDownloader) downloadVideo(ctx context.Context, video *youtube.
 	return nil
 }
 
-func (ytd *YouTubeDownloader) selectBestFormat(video *youtube.Video, resolution string) *youtube.Format {
-	// 解析目标分辨率
-	targetHeight := 720
+// downloadStream 下载单个格式的流到 path，已完整下载的流直接复用
+// base 为之前的流已下载的字节数，remaining 为之后的流的大小，用于把进度换算为所有流的总进度
+func (ytd *YouTubeDownloader) downloadStream(ctx context.Context, video *youtube.Video, format *youtube.Format, path string, base, remaining int64, onProgress func(current, total int64)) (int64, error) {
+	if info, err := os.Stat(path); err == nil && format.ContentLength > 0 && info.Size() == format.ContentLength {
+		log.Printf("流已下载，跳过: %s", path)
+		onProgress(base+info.Size(), -1)
+		return info.Size(), nil
+	}
+
+	streamURL, err := ytd.client.GetStreamURLContext(ctx, video, format)
+	if err != nil {
+		log.Printf("获取视频流失败: %v", err)
+		return 0, fmt.Errorf("获取视频流失败: %w", classifyError(err))
+	}
+
+	sd := newSegmentedDownloader(ytd.client.HTTPClient, nil, ytd.config.DownloadSegments, youtube.Size10Mb)
+	return sd.Download(ctx, streamURL, path, format.ContentLength, func(current, total int64) {
+		streamTotal := format.ContentLength
+		if total > 0 {
+			streamTotal = total
+		}
+		if streamTotal <= 0 {
+			onProgress(base+current, -1)
+			return
+		}
+		onProgress(base+current, base+streamTotal+remaining)
+	})
+}
+
+// streamFilePath 返回分离的音视频流的临时文件路径，以 .part 结尾，取消下载时保留以便下次继续
+func streamFilePath(outputPath string, format *youtube.Format) string {
+	return fmt.Sprintf("%s.f%d%s", outputPath, format.ItagNo, partSuffix)
+}
+
+// selectFormats 选择要下载的格式
+// ffmpeg 可用且分离的视频流比音视频合一的格式更接近目标分辨率时，返回视频流和音频流；
+// 否则返回音视频合一的格式，audioFormat 为 nil
+func (ytd *YouTubeDownloader) selectFormats(video *youtube.Video, resolution string) (videoFormat, audioFormat *youtube.Format) {
+	muxed := ytd.selectBestFormat(video, resolution)
+
+	adaptive := ytd.selectVideoFormat(video, resolution)
+	if adaptive == nil {
+		return muxed, nil
+	}
+
+	target := targetHeight(resolution)
+	if muxed != nil && heightDistance(muxed.Height, target) <= heightDistance(adaptive.Height, target) {
+		return muxed, nil
+	}
+
+	if !ffmpegAvailable(ytd.config.FfmpegPath) {
+		log.Printf("未找到ffmpeg，无法合并音视频，使用音视频合一的格式: %s", ffmpegPath(ytd.config.FfmpegPath))
+		return muxed, nil
+	}
+
+	audio := ytd.selectAudioFormat(video, mimeContainer(adaptive.MimeType))
+	if audio == nil {
+		return muxed, nil
+	}
+
+	return adaptive, audio
+}
+
+// targetHeight 解析目标分辨率，无法识别时默认为 720
+func targetHeight(resolution string) int {
 	resolutionMap := map[string]int{
 		"2160": 2160, // 4K
 		"1440": 1440, // 2K
@@ -364,64 +572,187 @@ func (ytd *YouTubeDownloader) selectBestFormat(video *youtube.Video, resolution
 	}
 
 	if h, ok := resolutionMap[resolution]; ok {
-		targetHeight = h
+		return h
 	}
+	return 720
+}
 
-	// 按分辨率和质量排序格式
-	formats := make([]*youtube.Format, 0, len(video.Formats))
+// heightDistance 计算格式高度与目标分辨率的差距，超过目标分辨率的格式排在不足的格式之后
+func heightDistance(height, target int) int {
+	if height > target {
+		return (height - target) * 2
+	}
+	return target - height
+}
+
+// selectVideoFormat 从只含视频的分离格式中选择最符合要求的格式
+func (ytd *YouTubeDownloader) selectVideoFormat(video *youtube.Video, resolution string) *youtube.Format {
+	var formats []*youtube.Format
 	for i := range video.Formats {
 		format := &video.Formats[i]
-		// 只考虑包含音频的格式
-		if format.AudioChannels == 0 {
-			continue
-		}
-		// 确保高度有效
-		if format.Height == 0 {
+		if format.AudioChannels != 0 || format.Height == 0 {
 			continue
 		}
 		formats = append(formats, format)
 	}
 
-	// 如果没有找到合适的格式，返回nil
-	if len(formats) == 0 {
-		return nil
+	return ytd.pickFormat(formats, targetHeight(resolution))
+}
+
+// selectAudioFormat 选择比特率最高的音频流，优先选择容器为 container 的格式（为空时不限）
+func (ytd *YouTubeDownloader) selectAudioFormat(video *youtube.Video, container string) *youtube.Format {
+
+	var best *youtube.Format
+	for i := range video.Formats {
+		format := &video.Formats[i]
+		if format.AudioChannels == 0 || format.Height != 0 {
+			continue
+		}
+		if best == nil {
+			best = format
+			continue
+		}
+
+		sameContainer := mimeContainer(format.MimeType) == container
+		bestSameContainer := mimeContainer(best.MimeType) == container
+		if sameContainer != bestSameContainer {
+			if sameContainer {
+				best = format
+			}
+			continue
+		}
+		if format.Bitrate > best.Bitrate {
+			best = format
+		}
 	}
 
-	// 计算每个格式的得分
-	type formatScore struct {
-		format *youtube.Format
-		score  int
+	return best
+}
+
+// pickFormat 从候选格式中选出最符合要求的格式
+// 超过比特率上限的格式被排除（全部超过时忽略上限），其余先比较与目标分辨率的差距，
+// 再依次比较配置的编码偏好、容器偏好，最后选择比特率最高的
+func (ytd *YouTubeDownloader) pickFormat(formats []*youtube.Format, target int) *youtube.Format {
+	if ytd.config.MaxBitrate > 0 {
+		var limited []*youtube.Format
+		for _, format := range formats {
+			if format.Bitrate <= ytd.config.MaxBitrate*1000 {
+				limited = append(limited, format)
+			}
+		}
+		if len(limited) > 0 {
+			formats = limited
+		}
 	}
 
-	var scoredFormats []formatScore
+	var best *youtube.Format
 	for _, format := range formats {
-		// 计算分辨率差异
-		heightDiff := format.Height - targetHeight
-		if heightDiff < 0 {
-			heightDiff = -heightDiff
+		if best == nil || ytd.betterFormat(format, best, target) {
+			best = format
+		}
+	}
+	return best
+}
+
+// betterFormat 判断格式 a 是否优于格式 b
+func (ytd *YouTubeDownloader) betterFormat(a, b *youtube.Format, target int) bool {
+	if da, db := heightDistance(a.Height, target), heightDistance(b.Height, target); da != db {
+		return da < db
+	}
+
+	if ra, rb := preferenceRank(ytd.config.PreferredCodecs, mimeCodec(a.MimeType)), preferenceRank(ytd.config.PreferredCodecs, mimeCodec(b.MimeType)); ra != rb {
+		return ra < rb
+	}
+
+	if ra, rb := preferenceRank(ytd.config.PreferredContainers, mimeContainer(a.MimeType)), preferenceRank(ytd.config.PreferredContainers, mimeContainer(b.MimeType)); ra != rb {
+		return ra < rb
+	}
+
+	return a.Bitrate > b.Bitrate
+}
+
+// preferenceRank 返回 value 在偏好列表中的位置（前缀匹配，忽略大小写），不在列表中时排在最后
+func preferenceRank(preferences []string, value string) int {
+	value = strings.ToLower(value)
+	for i, preference := range preferences {
+		if preference != "" && strings.HasPrefix(value, strings.ToLower(preference)) {
+			return i
 		}
+	}
+	return len(preferences)
+}
 
-		// 计算比特率得分（越高越好）
-		bitrateScore := int(format.Bitrate / 1000) // 转换为kbps
+// mimeContainer 从 MimeType（如 `video/mp4; codecs="avc1.640028"`）中提取容器名
+func mimeContainer(mimeType string) string {
+	mediaType := strings.TrimSpace(strings.SplitN(mimeType, ";", 2)[0])
+	if i := strings.Index(mediaType, "/"); i >= 0 {
+		return mediaType[i+1:]
+	}
+	return mediaType
+}
+
+// mimeCodec 从 MimeType 中提取第一个编码（通常是视频编码），vp09 统一为 vp9
+func mimeCodec(mimeType string) string {
+	i := strings.Index(mimeType, "codecs=")
+	if i < 0 {
+		return ""
+	}
+	codecs := strings.Trim(mimeType[i+len("codecs="):], `"' `)
+	codec := strings.TrimSpace(strings.SplitN(codecs, ",", 2)[0])
+	if strings.HasPrefix(codec, "vp09") {
+		codec = "vp9" + strings.TrimPrefix(codec, "vp09")
+	}
+	return codec
+}
 
-		// 计算总得分：分辨率差异越小越好，比特率越高越好
-		totalScore := bitrateScore - heightDiff*10
+// formatExtension 根据实际选择的格式确定文件扩展名
+// 分离的音视频流容器不同时，合并为 mkv；只有音频的 mp4 使用 m4a
+func formatExtension(videoFormat, audioFormat *youtube.Format) string {
+	container := mimeContainer(videoFormat.MimeType)
+	if audioFormat != nil && mimeContainer(audioFormat.MimeType) != container {
+		return ".mkv"
+	}
+	if videoFormat.Height == 0 && container == "mp4" {
+		return ".m4a"
+	}
 
-		scoredFormats = append(scoredFormats, formatScore{
-			format: format,
-			score:  totalScore,
-		})
+	switch container {
+	case "mp4", "webm":
+		return "." + container
+	case "3gpp":
+		return ".3gp"
+	default:
+		return ".mp4"
 	}
+}
 
-	// 按得分排序，选择得分最高的格式
-	bestFormat := scoredFormats[0].format
-	bestScore := scoredFormats[0].score
+// audioSourceContainer 返回转码为 audioFormat 时优先下载的音频容器，避免不必要的转码
+func audioSourceContainer(audioFormat string) string {
+	switch audioFormat {
+	case "m4a", "mp3":
+		return "mp4"
+	case "opus":
+		return "webm"
+	default:
+		return ""
+	}
+}
 
-	for _, sf := range scoredFormats {
-		if sf.score > bestScore {
-			bestScore = sf.score
-			bestFormat = sf.format
+func (ytd *YouTubeDownloader) selectBestFormat(video *youtube.Video, resolution string) *youtube.Format {
+	// 只考虑包含音频、且高度有效的格式
+	var formats []*youtube.Format
+	for i := range video.Formats {
+		format := &video.Formats[i]
+		if format.AudioChannels == 0 || format.Height == 0 {
+			continue
 		}
+		formats = append(formats, format)
+	}
+
+	// 如果没有找到合适的格式，返回nil
+	bestFormat := ytd.pickFormat(formats, targetHeight(resolution))
+	if bestFormat == nil {
+		return nil
 	}
 
 	log.Printf("为视频 '%s' 选择最佳格式: 分辨率=%dp, 比特率=%dkbps, 格式=%s",
@@ -482,7 +813,7 @@ func (ytd *YouTubeDownloader) generateFilename(video *youtube.Video, ext string)
 	// 替换分辨率
 	resolution := ""
 	if video.Formats != nil && len(video.Formats) > 0 {
-		bestFormat := ytd.selectBestFormat(video, ytd.config.DefaultResolution)
+		bestFormat, _ := ytd.selectFormats(video, ytd.config.DefaultResolution)
 		if bestFormat != nil {
 			resolution = fmt.Sprintf("%dp", bestFormat.Height)
 			result = strings.ReplaceAll(result, "%(width)s", fmt.Sprintf("%d", bestFormat.Width))
@@ -612,21 +943,31 @@ func (ytd *YouTubeDownloader) generateMetaFile(video *youtube.Video, outputDir,
 	return nil
 }
 
-// convertVideoFormat 使用ffmpeg进行视频格式转换
-func (ytd *YouTubeDownloader) convertVideoFormat(inputPath, outputPath string) error {
-	// 优先使用配置文件中的ffmpeg路径
-	ffmpegPath := ytd.config.FfmpegPath
-	if ffmpegPath == "" {
-		// 尝试使用当前目录下的ffmpeg.exe
-		ffmpegPath = "./ffmpeg.exe"
-		if _, err := os.Stat(ffmpegPath); os.IsNotExist(err) {
-			// 如果当前目录不存在，则尝试使用系统PATH中的ffmpeg
-			ffmpegPath = "ffmpeg"
-		}
+// mergeStreams 使用ffmpeg将分离的视频流和音频流合并为一个文件，不重新编码
+func (ytd *YouTubeDownloader) mergeStreams(ctx context.Context, videoPath, audioPath, outputPath string) error {
+	cmd := exec.CommandContext(ctx, ffmpegPath(ytd.config.FfmpegPath),
+		"-y",
+		"-i", videoPath,
+		"-i", audioPath,
+		"-map", "0:v:0",
+		"-map", "1:a:0",
+		"-c", "copy",
+		outputPath,
+	)
+
+	if output, err := cmd.CombinedOutput(); err != nil {
+		os.Remove(outputPath)
+		return fmt.Errorf("ffmpeg合并音视频失败: %w\n%s", err, ffmpegErrorOutput(output))
 	}
 
+	log.Printf("音视频合并完成: %s", outputPath)
+	return nil
+}
+
+// convertVideoFormat 使用ffmpeg进行视频格式转换
+func (ytd *YouTubeDownloader) convertVideoFormat(inputPath, outputPath string) error {
 	// 构建ffmpeg命令
-	cmd := exec.Command(ffmpegPath, "-i", inputPath, "-c", "copy", outputPath)
+	cmd := exec.Command(ffmpegPath(ytd.config.FfmpegPath), "-i", inputPath, "-c", "copy", outputPath)
 
 	// 执行命令
 	if err := cmd.Run(); err != nil {
@@ -636,3 +977,119 @@ func (ytd *YouTubeDownloader) convertVideoFormat(inputPath, outputPath string) e
 	log.Printf("视频格式转换完成: %s -> %s", inputPath, outputPath)
 	return nil
 }
+
+// ExpandContext 把 YouTube 播放列表和频道展开为单个视频，按 ctx 携带的下载选项选取范围、数量、日期和顺序
+// 播放列表通过 YouTube 播放列表接口读取，频道通过 channelLister 读取；
+// 没有指定数量和范围时使用配置文件中的 playlist_max_items / channel_max_items
+func (ytd *YouTubeDownloader) ExpandContext(ctx context.Context, rawURL string) ([]PlaylistItem, bool, error) {
+	match := utils.MatchURL(rawURL)
+	if match.Platform != "youtube" || !match.Kind.IsCollection() {
+		return nil, false, nil
+	}
+
+	opts := collectionOptions(ytd.config, optionsFromContext(ctx), match.Kind)
+	var items []PlaylistItem
+	switch match.Kind {
+	case utils.KindPlaylist:
+		playlist, err := ytd.client.GetPlaylistContext(ctx, match.Canonical)
+		if err != nil {
+			return nil, true, fmt.Errorf("获取播放列表失败: %w", classifyError(err))
+		}
+		for _, entry := range playlist.Videos {
+			items = append(items, PlaylistItem{ID: entry.ID, Title: entry.Title})
+		}
+		log.Printf("[YouTube下载器] 播放列表 %s 共 %d 个视频", playlist.Title, len(items))
+	case utils.KindChannel:
+		if ytd.channelLister == nil {
+			return nil, false, nil
+		}
+		var err error
+		items, err = ytd.channelLister.ListChannel(ctx, channelVideosURL(match.Canonical), listBound(opts))
+		if err != nil {
+			return nil, true, err
+		}
+		log.Printf("[YouTube下载器] 频道 %s 读取到 %d 个视频", match.ID, len(items))
+	}
+
+	selected, err := selectItems(items, opts, ytd.itemFilter(ctx, opts, match.Kind))
+	if err != nil {
+		return nil, true, err
+	}
+	for i := range selected {
+		// 统一使用规范的视频URL，与单独添加的视频URL去重
+		selected[i].URL = "https://www.youtube.com/watch?v=" + selected[i].ID
+	}
+	return selected, true, nil
+}
+
+// itemFilter 返回按已下载记录和上传日期筛选视频的函数，不需要筛选时返回 nil
+// 列表中没有上传日期时通过视频信息获取，仍无法确定上传日期的视频跳过
+func (ytd *YouTubeDownloader) itemFilter(ctx context.Context, opts Options, kind utils.ContentKind) itemFilter {
+	stopAtIndexed := opts.stopAtIndexed()
+	if opts.StopAtIndexed && !stopAtIndexed {
+		log.Printf("[YouTube下载器] 从最早的视频开始选取时不使用 stop-at-indexed")
+	}
+	if !stopAtIndexed && opts.DateAfter == "" && opts.DateBefore == "" {
+		return nil
+	}
+
+	return func(item PlaylistItem) (bool, bool, error) {
+		if stopAtIndexed && ytd.indexer != nil {
+			key := item.ID
+			if opts.AudioOnly {
+				key = indexer.AudioKey(key)
+			}
+			if ytd.indexer.IsDownloaded(key) {
+				log.Printf("[YouTube下载器] 遇到已下载的视频 %s，不再检查后面的视频", item.ID)
+				return false, true, nil
+			}
+		}
+		if opts.DateAfter == "" && opts.DateBefore == "" {
+			return true, false, nil
+		}
+
+		date := item.UploadDate
+		if date == "" {
+			video, err := ytd.client.GetVideoContext(ctx, item.ID)
+			if err != nil {
+				if ctx.Err() != nil {
+					return false, true, fmt.Errorf("获取视频信息已取消: %w", ctx.Err())
+				}
+				// 下载单个视频时不再检查日期，无法确定上传日期的视频不下载
+				log.Printf("[YouTube下载器] 获取视频 %s 的上传日期失败，跳过: %v", item.ID, err)
+				return false, false, nil
+			}
+			if video.PublishDate.IsZero() {
+				log.Printf("[YouTube下载器] 视频 %s 没有上传日期，跳过", item.ID)
+				return false, false, nil
+			}
+			date = video.PublishDate.Format("20060102")
+		}
+
+		if opts.DateBefore != "" && date > opts.DateBefore {
+			return false, false, nil
+		}
+		if opts.DateAfter != "" && date < opts.DateAfter {
+			// 频道从新到旧排列，后面的视频都更早
+			return false, kind == utils.KindChannel && !opts.Reverse, nil
+		}
+		return true, false, nil
+	}
+}
+
+// channelVideosURL 返回频道"视频"标签页的URL，频道首页会按标签页分组列出视频
+func channelVideosURL(channelURL string) string {
+	u, err := url.Parse(channelURL)
+	if err != nil {
+		return channelURL
+	}
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+	root := 1
+	if !strings.HasPrefix(segments[0], "@") {
+		root = 2
+	}
+	if len(segments) == root {
+		u.Path = strings.TrimRight(u.Path, "/") + "/videos"
+	}
+	return u.String()
+}
@@ -0,0 +1,137 @@
+package indexer
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ArchiveDownloader 从 yt-dlp 下载存档导入的记录使用的下载器名称
+const ArchiveDownloader = "yt-dlp-archive"
+
+// ArchiveEntry yt-dlp 下载存档（--download-archive）中的一行，格式为 "extractor id"
+type ArchiveEntry struct {
+	// Extractor yt-dlp 提取器名称的小写形式，与索引记录的平台名称一致，例如 youtube、tiktok
+	Extractor string
+	ID        string
+}
+
+func (entry ArchiveEntry) String() string {
+	return entry.Extractor + " " + entry.ID
+}
+
+// ReadArchive 读取 yt-dlp 下载存档，文件不存在时返回空列表
+func ReadArchive(path string) ([]ArchiveEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("打开下载存档失败: %w", err)
+	}
+	defer file.Close()
+
+	var entries []ArchiveEntry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		entries = append(entries, ArchiveEntry{Extractor: strings.ToLower(fields[0]), ID: fields[1]})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取下载存档失败: %w", err)
+	}
+	return entries, nil
+}
+
+// ImportArchive 把 yt-dlp 下载存档中索引还没有的视频加入索引，返回新增的记录数
+// audio 为 true 时作为音频模式的下载记录（AudioKey）导入
+func (idx *Indexer) ImportArchive(path string, audio bool) (int, error) {
+	entries, err := ReadArchive(path)
+	if err != nil {
+		return 0, err
+	}
+
+	imported := 0
+	for _, entry := range entries {
+		key := entry.ID
+		if audio {
+			key = AudioKey(entry.ID)
+		}
+		if idx.IsDownloaded(key) {
+			continue
+		}
+		record := Record{ID: key, Platform: entry.Extractor, Downloader: ArchiveDownloader}
+		if err := idx.AddRecord(record); err != nil {
+			return imported, err
+		}
+		imported++
+	}
+	return imported, nil
+}
+
+// ExportArchive 把索引中 platform 平台的记录追加到 yt-dlp 下载存档，存档中已有的行保持不变，返回新增的行数
+// platform 为空时导出所有记录了平台的记录；audio 为 true 时只导出音频模式的记录，否则只导出视频记录
+func (idx *Indexer) ExportArchive(path, platform string, audio bool) (int, error) {
+	existing, err := ReadArchive(path)
+	if err != nil {
+		return 0, err
+	}
+	seen := make(map[ArchiveEntry]bool, len(existing))
+	for _, entry := range existing {
+		seen[entry] = true
+	}
+
+	var lines strings.Builder
+	added := 0
+	for _, record := range idx.Records() {
+		id, isAudio := strings.CutSuffix(record.ID, ":audio")
+		if isAudio != audio || record.Platform == "" || record.Platform == "unknown" {
+			continue
+		}
+		if platform != "" && !strings.EqualFold(record.Platform, platform) {
+			continue
+		}
+		entry := ArchiveEntry{Extractor: strings.ToLower(record.Platform), ID: id}
+		if seen[entry] {
+			continue
+		}
+		seen[entry] = true
+		lines.WriteString(entry.String() + "\n")
+		added++
+	}
+	if added == 0 {
+		return 0, nil
+	}
+
+	// 追加而不是重写，避免覆盖同时运行的 yt-dlp 写入的行
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return 0, fmt.Errorf("创建目录失败: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return 0, fmt.Errorf("打开下载存档失败: %w", err)
+	}
+	// 存档最后一行没有换行符时先补上，否则新行会接在最后一行后面
+	if info, err := file.Stat(); err == nil && info.Size() > 0 {
+		last := make([]byte, 1)
+		if _, err := file.ReadAt(last, info.Size()-1); err == nil && last[0] != '\n' {
+			if _, err := file.WriteString("\n"); err != nil {
+				file.Close()
+				return 0, fmt.Errorf("写入下载存档失败: %w", err)
+			}
+		}
+	}
+	if _, err := file.WriteString(lines.String()); err != nil {
+		file.Close()
+		return 0, fmt.Errorf("写入下载存档失败: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return 0, fmt.Errorf("写入下载存档失败: %w", err)
+	}
+	return added, nil
+}
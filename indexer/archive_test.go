@@ -0,0 +1,98 @@
+package indexer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestImportArchive(t *testing.T) {
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "downloaded_archive.txt")
+	content := "youtube abc123\nTikTok 7001\n\nmalformed line here\nyoutube known1\n"
+	if err := os.WriteFile(archive, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	idx := NewIndexer(dir)
+	idx.AddRecord(Record{ID: "known1", Platform: "youtube", Title: "Known"})
+
+	imported, err := idx.ImportArchive(archive, false)
+	if err != nil {
+		t.Fatalf("ImportArchive() error = %v", err)
+	}
+	if imported != 2 {
+		t.Errorf("ImportArchive() = %d, want 2", imported)
+	}
+	if record, _ := idx.GetRecord("7001"); record.Platform != "tiktok" || record.Downloader != ArchiveDownloader {
+		t.Errorf("imported record = %+v", record)
+	}
+	if record, _ := idx.GetRecord("known1"); record.Title != "Known" {
+		t.Errorf("existing record was replaced: %+v", record)
+	}
+
+	imported, err = idx.ImportArchive(archive, true)
+	if err != nil {
+		t.Fatalf("ImportArchive(audio) error = %v", err)
+	}
+	if imported != 3 || !idx.IsDownloaded(AudioKey("abc123")) {
+		t.Errorf("ImportArchive(audio) = %d, want 3", imported)
+	}
+
+	if imported, err := idx.ImportArchive(filepath.Join(dir, "missing.txt"), false); err != nil || imported != 0 {
+		t.Errorf("ImportArchive(missing) = %d, %v", imported, err)
+	}
+}
+
+func TestExportArchive(t *testing.T) {
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "youtube", "downloaded_archive.txt")
+	if err := os.MkdirAll(filepath.Dir(archive), 0755); err != nil {
+		t.Fatal(err)
+	}
+	// 最后一行没有换行符
+	if err := os.WriteFile(archive, []byte("youtube existing1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	idx := NewIndexer(dir)
+	for _, record := range []Record{
+		{ID: "existing1", Platform: "youtube"},
+		{ID: "new1", Platform: "YouTube"},
+		{ID: AudioKey("song1"), Platform: "youtube"},
+		{ID: "dy1", Platform: "douyin"},
+		{ID: "legacy1"},
+	} {
+		idx.AddRecord(record)
+	}
+
+	exported, err := idx.ExportArchive(archive, "youtube", false)
+	if err != nil {
+		t.Fatalf("ExportArchive() error = %v", err)
+	}
+	if exported != 1 {
+		t.Errorf("ExportArchive() = %d, want 1", exported)
+	}
+
+	entries, err := ReadArchive(archive)
+	if err != nil {
+		t.Fatalf("ReadArchive() error = %v", err)
+	}
+	want := []ArchiveEntry{{"youtube", "existing1"}, {"youtube", "new1"}}
+	if len(entries) != len(want) || entries[0] != want[0] || entries[1] != want[1] {
+		t.Errorf("archive entries = %v, want %v", entries, want)
+	}
+
+	// 再次导出不会产生重复的行
+	if exported, err := idx.ExportArchive(archive, "youtube", false); err != nil || exported != 0 {
+		t.Errorf("second ExportArchive() = %d, %v", exported, err)
+	}
+
+	audioArchive := filepath.Join(dir, "audio_archive.txt")
+	if exported, err := idx.ExportArchive(audioArchive, "", true); err != nil || exported != 1 {
+		t.Errorf("ExportArchive(audio) = %d, %v", exported, err)
+	}
+	if entries, _ := ReadArchive(audioArchive); len(entries) != 1 || entries[0].ID != "song1" {
+		t.Errorf("audio archive entries = %v", entries)
+	}
+}
@@ -0,0 +1,357 @@
+package indexer
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"batch_download_videos/logger"
+	"batch_download_videos/utils"
+)
+
+// FormatVersion 索引文件的格式版本
+// 版本 1 每行一个视频ID；版本 2 每行一条 JSON 格式的下载记录
+const FormatVersion = 2
+
+// versionPrefix 索引文件中声明格式版本的注释行前缀
+const versionPrefix = "# version: "
+
+// journalCompactThreshold 日志中的记录数超过该值时自动压缩到索引文件
+const journalCompactThreshold = 1000
+
+// FileStore 基于文本文件的存储后端（默认）
+// 每次 Put 都会追加一行到日志文件（.journal），程序中途崩溃也不会丢失已完成的下载；
+// Flush 把索引文件和日志合并后写入临时文件，再原子地重命名为索引文件并清空日志。
+// 对文件的读写都持有 .lock 文件上的排他锁，多个进程可以同时使用同一个输出目录。
+type FileStore struct {
+	indexFile string
+	// mutex 串行化本进程内对索引文件和日志的读写
+	mutex sync.Mutex
+	// journalEntries 日志中的记录数
+	journalEntries int
+}
+
+// NewFileStore 创建以 indexFile 为索引文件的存储后端
+func NewFileStore(indexFile string) *FileStore {
+	return &FileStore{indexFile: indexFile}
+}
+
+// journalFile 返回日志文件路径
+func (fs *FileStore) journalFile() string {
+	return fs.indexFile + ".journal"
+}
+
+// lockFile 返回锁文件路径
+func (fs *FileStore) lockFile() string {
+	return fs.indexFile + ".lock"
+}
+
+// withLock 在持有进程内互斥锁和文件锁时执行 fn
+func (fs *FileStore) withLock(fn func() error) error {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	return withFileLock(fs.lockFile(), fn)
+}
+
+// Load 读取索引文件并重放日志，旧版本（每行一个视频ID）的文件会迁移为当前格式并保留一份 .v1 备份
+func (fs *FileStore) Load() ([]Record, error) {
+	if _, err := os.Stat(fs.indexFile); os.IsNotExist(err) {
+		if _, err := os.Stat(fs.journalFile()); os.IsNotExist(err) {
+			return nil, nil
+		}
+	}
+
+	var records map[string]Record
+	err := fs.withLock(func() error {
+		var version int
+		var err error
+		records, version, fs.journalEntries, err = fs.readFiles()
+		if err != nil {
+			return err
+		}
+		if version < FormatVersion {
+			return fs.migrate(version)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return sortedRecords(records), nil
+}
+
+// Put 追加一条记录到日志，日志过长时压缩到索引文件
+func (fs *FileStore) Put(record Record) error {
+	return fs.withLock(func() error {
+		if err := appendJournal(fs.journalFile(), record); err != nil {
+			return err
+		}
+		fs.journalEntries++
+		if fs.journalEntries < journalCompactThreshold {
+			return nil
+		}
+		return fs.compact()
+	})
+}
+
+// Flush 压缩索引：把索引文件和日志中的记录（包括其他进程写入的）合并写入索引文件并清空日志
+func (fs *FileStore) Flush() error {
+	return fs.withLock(fs.compact)
+}
+
+// Delete 从索引文件和日志中删除记录，删除后日志已合并到索引文件
+func (fs *FileStore) Delete(ids ...string) error {
+	return fs.withLock(func() error {
+		records, _, _, err := fs.readFiles()
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			delete(records, id)
+		}
+		return fs.writeIndex(records)
+	})
+}
+
+// Query 读取全部记录后按条件过滤
+func (fs *FileStore) Query(filter Filter) ([]Record, error) {
+	records, err := fs.Load()
+	if err != nil {
+		return nil, err
+	}
+	return filter.apply(records), nil
+}
+
+// readFiles 读取索引文件和日志中的所有记录，日志中的记录覆盖索引文件中的同名记录
+// 返回索引文件的格式版本和日志中的记录数，调用方需持有锁
+func (fs *FileStore) readFiles() (map[string]Record, int, int, error) {
+	records := make(map[string]Record)
+
+	version, err := readIndexFile(fs.indexFile, records)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	journalEntries, err := readJournal(fs.journalFile(), records)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	return records, version, journalEntries, nil
+}
+
+// readIndexFile 读取索引文件中的记录，返回文件的格式版本，文件不存在时返回当前版本
+// 无法解析的行被跳过，下次压缩索引文件时删除
+func readIndexFile(path string, records map[string]Record) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return FormatVersion, nil
+		}
+		return 0, fmt.Errorf("打开索引文件失败: %w", err)
+	}
+	defer file.Close()
+
+	version := 1
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, versionPrefix) {
+			version, err = strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, versionPrefix)))
+			if err != nil {
+				return 0, fmt.Errorf("索引文件版本无效: %s", line)
+			}
+			if version > FormatVersion {
+				return 0, fmt.Errorf("索引文件版本 %d 高于支持的版本 %d，请升级程序", version, FormatVersion)
+			}
+			continue
+		}
+		if line[0] == '#' {
+			continue
+		}
+
+		if version < 2 {
+			records[line] = Record{ID: line}
+			continue
+		}
+
+		// 单行损坏时跳过该行并记录日志，不影响其他记录，避免整个索引加载失败后重新下载所有视频
+		var record Record
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			logger.GetLogger().Warn("跳过索引文件第 %d 行: %v, 内容: %s", lineNumber, err, utils.TruncateString(line, 200))
+			continue
+		}
+		if record.ID != "" {
+			records[record.ID] = record
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, fmt.Errorf("读取索引文件失败: %w", err)
+	}
+
+	return version, nil
+}
+
+// readJournal 重放日志中的记录，返回读取到的记录数
+// 崩溃时最后一行可能只写了一半，无法解析的行直接跳过
+func readJournal(path string, records map[string]Record) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("打开索引日志失败: %w", err)
+	}
+	defer file.Close()
+
+	entries := 0
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var record Record
+		if err := json.Unmarshal([]byte(line), &record); err != nil || record.ID == "" {
+			continue
+		}
+		records[record.ID] = record
+		entries++
+	}
+	if err := scanner.Err(); err != nil {
+		return entries, fmt.Errorf("读取索引日志失败: %w", err)
+	}
+
+	return entries, nil
+}
+
+// migrate 备份旧版本的索引文件，并以当前格式重新保存，调用方需持有锁
+func (fs *FileStore) migrate(version int) error {
+	backup := fmt.Sprintf("%s.v%d", fs.indexFile, version)
+	data, err := os.ReadFile(fs.indexFile)
+	if err != nil {
+		return fmt.Errorf("读取旧版本索引文件失败: %w", err)
+	}
+	if err := os.WriteFile(backup, data, 0644); err != nil {
+		return fmt.Errorf("备份旧版本索引文件失败: %w", err)
+	}
+	if err := fs.compact(); err != nil {
+		return fmt.Errorf("迁移索引文件失败: %w", err)
+	}
+	return nil
+}
+
+// compact 把索引文件和日志中的记录合并写入索引文件，调用方需持有锁
+func (fs *FileStore) compact() error {
+	records, _, _, err := fs.readFiles()
+	if err != nil {
+		return err
+	}
+	return fs.writeIndex(records)
+}
+
+// writeIndex 把记录写入临时文件，同步到磁盘后原子地重命名为索引文件，再删除日志
+// 任何一步失败时原索引文件和日志保持不变，调用方需持有锁
+func (fs *FileStore) writeIndex(records map[string]Record) error {
+	tmpPath := fs.indexFile + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("创建索引文件失败: %w", err)
+	}
+
+	if err := writeRecords(file, sortedRecords(records)); err != nil {
+		file.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("写入索引文件失败: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("同步索引文件失败: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("写入索引文件失败: %w", err)
+	}
+	if err := os.Rename(tmpPath, fs.indexFile); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("重命名索引文件失败: %w", err)
+	}
+
+	// 索引文件已包含日志中的所有记录，删除日志前崩溃只会导致重复重放
+	if err := os.Remove(fs.journalFile()); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("清空索引日志失败: %w", err)
+	}
+	fs.journalEntries = 0
+	return nil
+}
+
+// writeRecords 以当前格式写入所有记录
+func writeRecords(w io.Writer, records []Record) error {
+	writer := bufio.NewWriter(w)
+	if _, err := fmt.Fprintf(writer, "# 视频下载索引\n%s%d\n", versionPrefix, FormatVersion); err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		data, err := json.Marshal(record)
+		if err != nil {
+			return fmt.Errorf("序列化下载记录失败: %w", err)
+		}
+		if _, err := writer.Write(append(data, '\n')); err != nil {
+			return err
+		}
+	}
+
+	return writer.Flush()
+}
+
+// appendJournal 追加一条记录到日志，写入后同步到磁盘
+func appendJournal(path string, record Record) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("序列化下载记录失败: %w", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("打开索引日志失败: %w", err)
+	}
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		file.Close()
+		return fmt.Errorf("写入索引日志失败: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return fmt.Errorf("同步索引日志失败: %w", err)
+	}
+	return file.Close()
+}
+
+// sortedRecords 返回按ID排序的记录列表
+func sortedRecords(records map[string]Record) []Record {
+	list := make([]Record, 0, len(records))
+	for _, record := range records {
+		list = append(list, record)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
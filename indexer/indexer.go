@@ -1,82 +1,103 @@
 package indexer
 
 import (
-	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
+	"time"
+
+	"batch_download_videos/utils"
 )
 
+// Record 一条下载记录
+type Record struct {
+	// ID 索引键，通常是视频ID，音频模式为 AudioKey(videoID)
+	ID           string    `json:"id"`
+	Platform     string    `json:"platform,omitempty"`
+	SourceURL    string    `json:"source_url,omitempty"`
+	Title        string    `json:"title,omitempty"`
+	FilePath     string    `json:"file_path,omitempty"`
+	FileSize     int64     `json:"file_size,omitempty"`
+	Checksum     string    `json:"checksum,omitempty"` // 文件的 SHA-256，十六进制
+	DownloadedAt time.Time `json:"downloaded_at"`
+	Downloader   string    `json:"downloader,omitempty"`
+}
+
+// Indexer 记录已下载的视频，内存中保存全部记录用于快速判断，记录持久化到 Store
 type Indexer struct {
-	index      map[string]bool
+	index      map[string]Record
 	indexMutex sync.RWMutex
-	baseDir    string
-	indexFile  string
+	store      Store
+}
+
+// AudioKey 返回音频模式下载的索引键，与同一视频的视频下载分别记录
+func AudioKey(videoID string) string {
+	return videoID + ":audio"
 }
 
+// IsAudioKey 判断索引键是否为音频模式下载的索引键
+func IsAudioKey(key string) bool {
+	return strings.HasSuffix(key, ":audio")
+}
+
+// IndexFileName 输出目录下索引文件的文件名
+const IndexFileName = ".video_downloaded.index"
+
+// NewIndexer 创建使用 baseDir 下索引文件的索引器
 func NewIndexer(baseDir string) *Indexer {
+	return NewIndexerWithStore(NewFileStore(filepath.Join(baseDir, IndexFileName)))
+}
+
+// NewIndexerWithStore 创建使用指定存储后端的索引器
+func NewIndexerWithStore(store Store) *Indexer {
 	return &Indexer{
-		index:     make(map[string]bool),
-		baseDir:   baseDir,
-		indexFile: filepath.Join(baseDir, ".video_downloaded.index"),
+		index: make(map[string]Record),
+		store: store,
 	}
 }
 
+// Load 从存储后端加载所有记录
 func (idx *Indexer) Load() error {
-	file, err := os.Open(idx.indexFile)
+	records, err := idx.store.Load()
 	if err != nil {
-		if os.IsNotExist(err) {
-			return nil
-		}
-		return fmt.Errorf("打开索引文件失败: %w", err)
+		return err
 	}
-	defer file.Close()
 
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := scanner.Text()
-		if line == "" || len(line) == 0 {
-			continue
-		}
-		if line[0] == '#' {
-			continue
-		}
+	idx.indexMutex.Lock()
+	defer idx.indexMutex.Unlock()
 
-		videoID := line
-		idx.indexMutex.Lock()
-		idx.index[videoID] = true
-		idx.indexMutex.Unlock()
+	for _, record := range records {
+		idx.index[record.ID] = record
 	}
-
-	return scanner.Err()
+	return nil
 }
 
+// Save 整理存储后端，并合并其他进程写入的记录
 func (idx *Indexer) Save() error {
-	file, err := os.Create(idx.indexFile)
-	if err != nil {
-		return fmt.Errorf("创建索引文件失败: %w", err)
+	if err := idx.store.Flush(); err != nil {
+		return err
 	}
-	defer file.Close()
 
-	idx.indexMutex.RLock()
-	defer idx.indexMutex.RUnlock()
-
-	writer := bufio.NewWriter(file)
-	defer writer.Flush()
-
-	_, err = writer.WriteString("# 视频下载索引\n")
+	records, err := idx.store.Load()
 	if err != nil {
 		return err
 	}
 
-	for vid := range idx.index {
-		_, err = writer.WriteString(fmt.Sprintf("%s\n", vid))
-		if err != nil {
-			return err
+	// 其他进程下载的视频也要保留，同一视频以较新的记录为准
+	idx.indexMutex.Lock()
+	defer idx.indexMutex.Unlock()
+
+	for _, record := range records {
+		if existing, ok := idx.index[record.ID]; !ok || record.DownloadedAt.After(existing.DownloadedAt) {
+			idx.index[record.ID] = record
 		}
 	}
-
 	return nil
 }
 
@@ -88,11 +109,101 @@ func (idx *Indexer) IsDownloaded(videoID string) bool {
 	return exists
 }
 
-func (idx *Indexer) MarkDownloaded(videoID string) {
+// LookupURL 返回URL对应视频的下载记录，不需要访问网络
+// 同一视频的不同写法（例如 shorts 链接和 watch 链接）规范化后对应同一条记录；
+// 无法从URL中识别视频ID时按规范URL查找（没有视频ID时下载器以URL作为索引键）
+func (idx *Indexer) LookupURL(rawURL string, audio bool) (Record, bool) {
+	normalized, err := utils.NormalizeURL(rawURL)
+	if err != nil {
+		return Record{}, false
+	}
+
+	key := normalized.ID
+	if key == "" {
+		key = normalized.URL
+	}
+	if audio {
+		key = AudioKey(key)
+	}
+
+	record, exists := idx.GetRecord(key)
+	if !exists {
+		return Record{}, false
+	}
+	// 不同平台的视频ID可能相同，记录了平台时要求平台一致
+	if normalized.ID != "" && record.Platform != "" && !strings.EqualFold(record.Platform, normalized.Platform) {
+		return Record{}, false
+	}
+	return record, true
+}
+
+// MarkDownloaded 只记录视频ID，需要完整信息时使用 AddRecord
+func (idx *Indexer) MarkDownloaded(videoID string) error {
+	return idx.AddRecord(Record{ID: videoID})
+}
+
+// AddRecord 添加或替换一条下载记录并立即持久化，DownloadedAt 为空时使用当前时间
+// 持久化失败时记录仍保留在内存中
+func (idx *Indexer) AddRecord(record Record) error {
+	if record.DownloadedAt.IsZero() {
+		record.DownloadedAt = time.Now()
+	}
+
 	idx.indexMutex.Lock()
-	defer idx.indexMutex.Unlock()
+	idx.index[record.ID] = record
+	idx.indexMutex.Unlock()
+
+	return idx.store.Put(record)
+}
+
+// Remove 删除下载记录，下次运行时会重新下载这些视频
+func (idx *Indexer) Remove(ids ...string) error {
+	idx.indexMutex.Lock()
+	for _, id := range ids {
+		delete(idx.index, id)
+	}
+	idx.indexMutex.Unlock()
+
+	return idx.store.Delete(ids...)
+}
+
+// Query 按条件查询存储后端中的下载记录
+func (idx *Indexer) Query(filter Filter) ([]Record, error) {
+	return idx.store.Query(filter)
+}
 
-	idx.index[videoID] = true
+// GetRecord 返回视频ID对应的下载记录
+func (idx *Indexer) GetRecord(videoID string) (Record, bool) {
+	idx.indexMutex.RLock()
+	defer idx.indexMutex.RUnlock()
+
+	record, exists := idx.index[videoID]
+	return record, exists
+}
+
+// Records 返回所有下载记录，按ID排序
+func (idx *Indexer) Records() []Record {
+	idx.indexMutex.RLock()
+	records := make([]Record, 0, len(idx.index))
+	for _, record := range idx.index {
+		records = append(records, record)
+	}
+	idx.indexMutex.RUnlock()
+
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].ID < records[j].ID
+	})
+	return records
+}
+
+// sortByDownloadedAt 按下载时间排序，时间相同时按ID排序
+func sortByDownloadedAt(records []Record) {
+	sort.Slice(records, func(i, j int) bool {
+		if !records[i].DownloadedAt.Equal(records[j].DownloadedAt) {
+			return records[i].DownloadedAt.Before(records[j].DownloadedAt)
+		}
+		return records[i].ID < records[j].ID
+	})
 }
 
 func (idx *Indexer) GetCount() int {
@@ -106,5 +217,20 @@ func (idx *Indexer) Clear() {
 	idx.indexMutex.Lock()
 	defer idx.indexMutex.Unlock()
 
-	idx.index = make(map[string]bool)
+	idx.index = make(map[string]Record)
+}
+
+// FileChecksum 计算文件的 SHA-256 校验和，返回十六进制字符串
+func FileChecksum(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("打开文件失败: %w", err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", fmt.Errorf("计算校验和失败: %w", err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
 }
@@ -1,9 +1,13 @@
 package indexer
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestNewIndexer(t *testing.T) {
@@ -14,8 +18,12 @@ func TestNewIndexer(t *testing.T) {
 		t.Fatal("NewIndexer() returned nil")
 	}
 
-	if idx.indexFile != filepath.Join(tempDir, ".video_downloaded.index") {
-		t.Errorf("indexFile = %q, want %q", idx.indexFile, filepath.Join(tempDir, ".video_downloaded.index"))
+	store, ok := idx.store.(*FileStore)
+	if !ok {
+		t.Fatalf("store = %T, want *FileStore", idx.store)
+	}
+	if store.indexFile != filepath.Join(tempDir, ".video_downloaded.index") {
+		t.Errorf("indexFile = %q, want %q", store.indexFile, filepath.Join(tempDir, ".video_downloaded.index"))
 	}
 
 	if len(idx.index) != 0 {
@@ -52,6 +60,55 @@ func TestIndexerLoad(t *testing.T) {
 	if !idx.IsDownloaded("video3") {
 		t.Error("video3 should be marked as downloaded")
 	}
+
+	// 旧版本的文件应迁移为当前格式，并保留备份
+	if _, err := os.Stat(indexFile + ".v1"); err != nil {
+		t.Errorf("legacy index backup should exist: %v", err)
+	}
+	migrated, err := os.ReadFile(indexFile)
+	if err != nil {
+		t.Fatalf("Failed to read migrated index file: %v", err)
+	}
+	if !strings.Contains(string(migrated), "# version: 2\n") {
+		t.Errorf("migrated index file should declare version 2, got %q", string(migrated))
+	}
+
+	idx2 := NewIndexer(tempDir)
+	if err := idx2.Load(); err != nil {
+		t.Fatalf("Load() migrated file failed: %v", err)
+	}
+	if idx2.GetCount() != 3 {
+		t.Errorf("GetCount() after migration = %d, want 3", idx2.GetCount())
+	}
+}
+
+func TestIndexerLoadNewerVersion(t *testing.T) {
+	tempDir := t.TempDir()
+	indexFile := filepath.Join(tempDir, ".video_downloaded.index")
+	if err := os.WriteFile(indexFile, []byte("# version: 99\n"), 0644); err != nil {
+		t.Fatalf("Failed to write test index file: %v", err)
+	}
+
+	if err := NewIndexer(tempDir).Load(); err == nil {
+		t.Error("Load() should fail for a newer index version")
+	}
+}
+
+func TestIndexerLoadSkipsMalformedLines(t *testing.T) {
+	tempDir := t.TempDir()
+	indexFile := filepath.Join(tempDir, ".video_downloaded.index")
+	content := "# version: 2\n{\"id\":\"video1\"}\n{\"id\":\"vid\n{\"id\":\"video3\"}\n"
+	if err := os.WriteFile(indexFile, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write test index file: %v", err)
+	}
+
+	idx := NewIndexer(tempDir)
+	if err := idx.Load(); err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if idx.GetCount() != 2 || !idx.IsDownloaded("video1") || !idx.IsDownloaded("video3") {
+		t.Errorf("GetCount() = %d, want the 2 valid records loaded", idx.GetCount())
+	}
 }
 
 func TestIndexerLoadNonExistent(t *testing.T) {
@@ -67,22 +124,64 @@ func TestIndexerSave(t *testing.T) {
 	tempDir := t.TempDir()
 	idx := NewIndexer(tempDir)
 
-	idx.MarkDownloaded("video1")
+	downloadedAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	idx.AddRecord(Record{
+		ID:           "video1",
+		Platform:     "youtube",
+		SourceURL:    "https://www.youtube.com/watch?v=video1",
+		Title:        "Video 1",
+		FilePath:     "output/youtube/video1.mp4",
+		FileSize:     1024,
+		Checksum:     "abc",
+		DownloadedAt: downloadedAt,
+		Downloader:   "YouTube专用下载器",
+	})
 	idx.MarkDownloaded("video2")
 
 	if err := idx.Save(); err != nil {
 		t.Fatalf("Save() failed: %v", err)
 	}
 
-	indexFile := filepath.Join(tempDir, ".video_downloaded.index")
-	content, err := os.ReadFile(indexFile)
-	if err != nil {
-		t.Fatalf("Failed to read saved index file: %v", err)
+	idx2 := NewIndexer(tempDir)
+	if err := idx2.Load(); err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+
+	record, ok := idx2.GetRecord("video1")
+	if !ok {
+		t.Fatal("video1 record should be loaded")
+	}
+	want := idx.index["video1"]
+	if record != want {
+		t.Errorf("loaded record = %+v, want %+v", record, want)
+	}
+
+	if !idx2.IsDownloaded("video2") {
+		t.Error("video2 should be marked as downloaded")
+	}
+	if record, _ := idx2.GetRecord("video2"); record.DownloadedAt.IsZero() {
+		t.Error("MarkDownloaded() should set DownloadedAt")
+	}
+
+	// 已经是当前版本的文件不应生成备份
+	if _, err := os.Stat(filepath.Join(tempDir, ".video_downloaded.index.v1")); !os.IsNotExist(err) {
+		t.Error("current index file should not be backed up")
+	}
+}
+
+func TestFileChecksum(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "video.mp4")
+	if err := os.WriteFile(path, []byte("hello"), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
 	}
 
-	expectedContent := "# 视频下载索引\nvideo1\nvideo2\n"
-	if string(content) != expectedContent {
-		t.Errorf("Saved content = %q, want %q", string(content), expectedContent)
+	checksum, err := FileChecksum(path)
+	if err != nil {
+		t.Fatalf("FileChecksum() error = %v", err)
+	}
+	want := "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+	if checksum != want {
+		t.Errorf("FileChecksum() = %q, want %q", checksum, want)
 	}
 }
 
@@ -159,3 +258,131 @@ func TestIndexerClear(t *testing.T) {
 		t.Error("video1 should not be marked as downloaded after Clear")
 	}
 }
+
+func TestIndexerJournal(t *testing.T) {
+	tempDir := t.TempDir()
+	idx := NewIndexer(tempDir)
+
+	if err := idx.MarkDownloaded("video1"); err != nil {
+		t.Fatalf("MarkDownloaded() error = %v", err)
+	}
+	if err := idx.AddRecord(Record{ID: "video2", Title: "Video 2"}); err != nil {
+		t.Fatalf("AddRecord() error = %v", err)
+	}
+
+	// 模拟崩溃：没有调用 Save，日志最后一行只写了一半
+	journal := filepath.Join(tempDir, ".video_downloaded.index.journal")
+	f, err := os.OpenFile(journal, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("Failed to open journal: %v", err)
+	}
+	f.WriteString(`{"id":"video3","tit`)
+	f.Close()
+
+	idx2 := NewIndexer(tempDir)
+	if err := idx2.Load(); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if idx2.GetCount() != 2 {
+		t.Errorf("GetCount() = %d, want 2", idx2.GetCount())
+	}
+	if record, _ := idx2.GetRecord("video2"); record.Title != "Video 2" {
+		t.Errorf("video2 Title = %q, want %q", record.Title, "Video 2")
+	}
+
+	if err := idx2.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if _, err := os.Stat(journal); !os.IsNotExist(err) {
+		t.Error("journal should be removed after Save")
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, ".video_downloaded.index.tmp")); !os.IsNotExist(err) {
+		t.Error("temporary index file should not remain after Save")
+	}
+
+	idx3 := NewIndexer(tempDir)
+	if err := idx3.Load(); err != nil {
+		t.Fatalf("Load() after Save error = %v", err)
+	}
+	if idx3.GetCount() != 2 {
+		t.Errorf("GetCount() after Save = %d, want 2", idx3.GetCount())
+	}
+}
+
+func TestIndexerConcurrentProcesses(t *testing.T) {
+	tempDir := t.TempDir()
+
+	// 两个索引器模拟同时运行在同一输出目录的两个进程
+	first := NewIndexer(tempDir)
+	second := NewIndexer(tempDir)
+
+	var wg sync.WaitGroup
+	for i, idx := range []*Indexer{first, second} {
+		wg.Add(1)
+		go func(i int, idx *Indexer) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				if err := idx.MarkDownloaded(fmt.Sprintf("video-%d-%d", i, j)); err != nil {
+					t.Errorf("MarkDownloaded() error = %v", err)
+				}
+			}
+			if err := idx.Save(); err != nil {
+				t.Errorf("Save() error = %v", err)
+			}
+		}(i, idx)
+	}
+	wg.Wait()
+
+	idx := NewIndexer(tempDir)
+	if err := idx.Load(); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if idx.GetCount() != 40 {
+		t.Errorf("GetCount() = %d, want 40", idx.GetCount())
+	}
+}
+
+func TestFileStoreQuery(t *testing.T) {
+	tempDir := t.TempDir()
+	idx := NewIndexer(tempDir)
+
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	idx.AddRecord(Record{ID: "yt1", Platform: "youtube", DownloadedAt: base.Add(time.Hour)})
+	idx.AddRecord(Record{ID: "dy1", Platform: "douyin", DownloadedAt: base})
+	idx.AddRecord(Record{ID: "yt2", Platform: "youtube", DownloadedAt: base})
+
+	records, err := idx.Query(Filter{Platform: "YouTube"})
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if len(records) != 2 || records[0].ID != "yt2" || records[1].ID != "yt1" {
+		t.Errorf("Query() = %+v, want yt2, yt1", records)
+	}
+}
+
+func TestIndexerLookupURL(t *testing.T) {
+	idx := NewIndexer(t.TempDir())
+	idx.AddRecord(Record{ID: "dQw4w9WgXcQ", Platform: "youtube", Title: "Video"})
+	idx.AddRecord(Record{ID: AudioKey("9bZkp7q19f0"), Platform: "youtube"})
+	idx.AddRecord(Record{ID: "7001234567890", Platform: "douyin"})
+
+	tests := []struct {
+		url   string
+		audio bool
+		want  bool
+	}{
+		{"https://www.youtube.com/shorts/dQw4w9WgXcQ?si=x", false, true},
+		{"https://youtu.be/dQw4w9WgXcQ", false, true},
+		{"https://youtu.be/dQw4w9WgXcQ", true, false},
+		{"https://www.youtube.com/watch?v=9bZkp7q19f0", true, true},
+		{"https://www.youtube.com/watch?v=9bZkp7q19f0", false, false},
+		// 同一个ID但平台不同
+		{"https://www.tiktok.com/@user/video/7001234567890", false, false},
+		{"https://www.douyin.com/video/7001234567890", false, true},
+	}
+	for _, tt := range tests {
+		if _, got := idx.LookupURL(tt.url, tt.audio); got != tt.want {
+			t.Errorf("LookupURL(%q, %t) = %t, want %t", tt.url, tt.audio, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package indexer
+
+import (
+	"fmt"
+	"os"
+)
+
+// withFileLock 在持有 path 上的排他文件锁时执行 fn，用于多个进程共享同一个输出目录时串行化索引文件的读写
+func withFileLock(path string, fn func() error) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return fmt.Errorf("打开锁文件失败: %w", err)
+	}
+	defer file.Close()
+
+	if err := lockFile(file); err != nil {
+		return fmt.Errorf("锁定索引文件失败: %w", err)
+	}
+	defer unlockFile(file)
+
+	return fn()
+}
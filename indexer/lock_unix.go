@@ -0,0 +1,23 @@
+//go:build !windows
+
+package indexer
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile 阻塞直到获得文件的排他锁
+func lockFile(file *os.File) error {
+	for {
+		err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX)
+		if err != syscall.EINTR {
+			return err
+		}
+	}
+}
+
+// unlockFile 释放文件锁
+func unlockFile(file *os.File) error {
+	return syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+}
@@ -0,0 +1,21 @@
+//go:build windows
+
+package indexer
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// lockFile 阻塞直到获得文件的排他锁
+func lockFile(file *os.File) error {
+	overlapped := new(windows.Overlapped)
+	return windows.LockFileEx(windows.Handle(file.Fd()), windows.LOCKFILE_EXCLUSIVE_LOCK, 0, 1, 0, overlapped)
+}
+
+// unlockFile 释放文件锁
+func unlockFile(file *os.File) error {
+	overlapped := new(windows.Overlapped)
+	return windows.UnlockFileEx(windows.Handle(file.Fd()), 0, 1, 0, overlapped)
+}
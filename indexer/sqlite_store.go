@@ -0,0 +1,186 @@
+package indexer
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"batch_download_videos/storage"
+)
+
+// sqliteSchema 下载记录表，按平台、下载器和下载时间建立索引
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS download_records (
+	id            TEXT PRIMARY KEY,
+	platform      TEXT NOT NULL DEFAULT '',
+	source_url    TEXT NOT NULL DEFAULT '',
+	title         TEXT NOT NULL DEFAULT '',
+	file_path     TEXT NOT NULL DEFAULT '',
+	file_size     INTEGER NOT NULL DEFAULT 0,
+	checksum      TEXT NOT NULL DEFAULT '',
+	downloaded_at TEXT,
+	downloader    TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS idx_download_records_platform ON download_records(platform, downloaded_at);
+CREATE INDEX IF NOT EXISTS idx_download_records_downloader ON download_records(downloader, downloaded_at);
+CREATE INDEX IF NOT EXISTS idx_download_records_downloaded_at ON download_records(downloaded_at);
+`
+
+const recordColumns = "id, platform, source_url, title, file_path, file_size, checksum, downloaded_at, downloader"
+
+// SQLiteStore 基于嵌入式 SQLite 数据库的存储后端，支持按平台、下载器和时间的索引查询
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+// NewSQLiteStore 在 db 中创建下载记录表，db 由调用方关闭
+func NewSQLiteStore(db *sql.DB) (*SQLiteStore, error) {
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		return nil, fmt.Errorf("创建下载记录表失败: %w", err)
+	}
+	return &SQLiteStore{db: db}, nil
+}
+
+// Load 返回所有下载记录
+func (ss *SQLiteStore) Load() ([]Record, error) {
+	return ss.Query(Filter{})
+}
+
+// Put 添加或替换一条下载记录
+func (ss *SQLiteStore) Put(record Record) error {
+	_, err := ss.db.Exec(`INSERT INTO download_records (`+recordColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET
+			platform = excluded.platform,
+			source_url = excluded.source_url,
+			title = excluded.title,
+			file_path = excluded.file_path,
+			file_size = excluded.file_size,
+			checksum = excluded.checksum,
+			downloaded_at = excluded.downloaded_at,
+			downloader = excluded.downloader`,
+		record.ID, strings.ToLower(record.Platform), record.SourceURL, record.Title, record.FilePath,
+		record.FileSize, record.Checksum, storage.FormatTime(record.DownloadedAt), record.Downloader)
+	if err != nil {
+		return fmt.Errorf("写入下载记录失败: %w", err)
+	}
+	return nil
+}
+
+// Delete 删除指定ID的下载记录
+func (ss *SQLiteStore) Delete(ids ...string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	if _, err := ss.db.Exec("DELETE FROM download_records WHERE id IN ("+placeholders+")", args...); err != nil {
+		return fmt.Errorf("删除下载记录失败: %w", err)
+	}
+	return nil
+}
+
+// Query 按条件查询下载记录，结果按下载时间排序
+func (ss *SQLiteStore) Query(filter Filter) ([]Record, error) {
+	var conditions []string
+	var args []any
+	if filter.Platform != "" {
+		conditions = append(conditions, "platform = ?")
+		args = append(args, strings.ToLower(filter.Platform))
+	}
+	if filter.Downloader != "" {
+		conditions = append(conditions, "downloader = ?")
+		args = append(args, filter.Downloader)
+	}
+	if !filter.Since.IsZero() {
+		conditions = append(conditions, "downloaded_at >= ?")
+		args = append(args, storage.FormatTime(filter.Since))
+	}
+	if !filter.Until.IsZero() {
+		conditions = append(conditions, "downloaded_at < ?")
+		args = append(args, storage.FormatTime(filter.Until))
+	}
+
+	query := "SELECT " + recordColumns + " FROM download_records"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY downloaded_at, id"
+	if filter.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", filter.Limit)
+	}
+
+	rows, err := ss.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("查询下载记录失败: %w", err)
+	}
+	defer rows.Close()
+
+	var records []Record
+	for rows.Next() {
+		var record Record
+		var downloadedAt sql.NullString
+		if err := rows.Scan(&record.ID, &record.Platform, &record.SourceURL, &record.Title, &record.FilePath,
+			&record.FileSize, &record.Checksum, &downloadedAt, &record.Downloader); err != nil {
+			return nil, fmt.Errorf("读取下载记录失败: %w", err)
+		}
+		if record.DownloadedAt, err = storage.ParseTime(downloadedAt); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("读取下载记录失败: %w", err)
+	}
+	return records, nil
+}
+
+// Flush 每条记录写入时已提交，无需整理
+func (ss *SQLiteStore) Flush() error {
+	return nil
+}
+
+// Count 返回数据库中的记录数
+func (ss *SQLiteStore) Count() (int, error) {
+	var count int
+	if err := ss.db.QueryRow("SELECT COUNT(*) FROM download_records").Scan(&count); err != nil {
+		return 0, fmt.Errorf("统计下载记录失败: %w", err)
+	}
+	return count, nil
+}
+
+// Import 把 src 中的所有记录导入数据库，用于从文件后端切换到数据库后端，返回导入的记录数
+func (ss *SQLiteStore) Import(src Store) (int, error) {
+	records, err := src.Load()
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := ss.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("开始事务失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`INSERT OR IGNORE INTO download_records (` + recordColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return 0, fmt.Errorf("准备导入语句失败: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, record := range records {
+		if _, err := stmt.Exec(record.ID, strings.ToLower(record.Platform), record.SourceURL, record.Title, record.FilePath,
+			record.FileSize, record.Checksum, storage.FormatTime(record.DownloadedAt), record.Downloader); err != nil {
+			return 0, fmt.Errorf("导入下载记录失败: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("提交事务失败: %w", err)
+	}
+	return len(records), nil
+}
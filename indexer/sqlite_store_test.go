@@ -0,0 +1,98 @@
+package indexer
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"batch_download_videos/storage"
+)
+
+func newTestSQLiteStore(t *testing.T) *SQLiteStore {
+	t.Helper()
+	db, err := storage.OpenSQLite(filepath.Join(t.TempDir(), "downloads.db"))
+	if err != nil {
+		t.Fatalf("OpenSQLite() error = %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	store, err := NewSQLiteStore(db)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore() error = %v", err)
+	}
+	return store
+}
+
+func TestSQLiteStore(t *testing.T) {
+	store := newTestSQLiteStore(t)
+	idx := NewIndexerWithStore(store)
+
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	records := []Record{
+		{ID: "yt1", Platform: "youtube", Title: "First", FileSize: 10, DownloadedAt: base},
+		{ID: "dy1", Platform: "douyin", Title: "Second", DownloadedAt: base.Add(time.Hour)},
+		{ID: "yt2", Platform: "YouTube", Title: "Third", DownloadedAt: base.Add(48 * time.Hour)},
+	}
+	for _, record := range records {
+		if err := idx.AddRecord(record); err != nil {
+			t.Fatalf("AddRecord() error = %v", err)
+		}
+	}
+
+	idx2 := NewIndexerWithStore(store)
+	if err := idx2.Load(); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if idx2.GetCount() != 3 {
+		t.Errorf("GetCount() = %d, want 3", idx2.GetCount())
+	}
+	if record, _ := idx2.GetRecord("yt1"); record.Title != "First" || record.FileSize != 10 || !record.DownloadedAt.Equal(base) {
+		t.Errorf("loaded record = %+v", record)
+	}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   []string
+	}{
+		{"platform", Filter{Platform: "youtube"}, []string{"yt1", "yt2"}},
+		{"since", Filter{Since: base.Add(time.Minute)}, []string{"dy1", "yt2"}},
+		{"until", Filter{Until: base.Add(24 * time.Hour)}, []string{"yt1", "dy1"}},
+		{"limit", Filter{Limit: 1}, []string{"yt1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := idx.Query(tt.filter)
+			if err != nil {
+				t.Fatalf("Query() error = %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Query() returned %d records, want %d", len(got), len(tt.want))
+			}
+			for i, record := range got {
+				if record.ID != tt.want[i] {
+					t.Errorf("record %d = %q, want %q", i, record.ID, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestSQLiteStoreImport(t *testing.T) {
+	tempDir := t.TempDir()
+	fileIndexer := NewIndexer(tempDir)
+	fileIndexer.MarkDownloaded("video1")
+	fileIndexer.MarkDownloaded("video2")
+
+	store := newTestSQLiteStore(t)
+	imported, err := store.Import(NewFileStore(filepath.Join(tempDir, ".video_downloaded.index")))
+	if err != nil {
+		t.Fatalf("Import() error = %v", err)
+	}
+	if imported != 2 {
+		t.Errorf("Import() = %d, want 2", imported)
+	}
+	if count, _ := store.Count(); count != 2 {
+		t.Errorf("Count() = %d, want 2", count)
+	}
+}
@@ -0,0 +1,64 @@
+package indexer
+
+import (
+	"strings"
+	"time"
+)
+
+// Store 下载记录的存储后端
+// 默认使用 FileStore（文本索引文件），也可以使用 SQLiteStore（嵌入式数据库）
+type Store interface {
+	// Load 返回所有下载记录
+	Load() ([]Record, error)
+	// Put 添加或替换一条下载记录，返回时记录已持久化
+	Put(record Record) error
+	// Delete 删除指定ID的下载记录，不存在的ID直接忽略
+	Delete(ids ...string) error
+	// Query 按条件查询下载记录，结果按下载时间排序
+	Query(filter Filter) ([]Record, error)
+	// Flush 整理存储，程序结束前调用
+	Flush() error
+}
+
+// Filter 下载记录的查询条件，零值字段表示不限制
+type Filter struct {
+	Platform   string
+	Downloader string
+	// Since、Until 下载时间范围 [Since, Until)
+	Since time.Time
+	Until time.Time
+	// Limit 最多返回的记录数，0 表示不限制
+	Limit int
+}
+
+// Match 判断记录是否满足查询条件
+func (f Filter) Match(record Record) bool {
+	if f.Platform != "" && !strings.EqualFold(record.Platform, f.Platform) {
+		return false
+	}
+	if f.Downloader != "" && record.Downloader != f.Downloader {
+		return false
+	}
+	if !f.Since.IsZero() && record.DownloadedAt.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !record.DownloadedAt.Before(f.Until) {
+		return false
+	}
+	return true
+}
+
+// apply 过滤记录并按下载时间排序
+func (f Filter) apply(records []Record) []Record {
+	matched := make([]Record, 0, len(records))
+	for _, record := range records {
+		if f.Match(record) {
+			matched = append(matched, record)
+		}
+	}
+	sortByDownloadedAt(matched)
+	if f.Limit > 0 && len(matched) > f.Limit {
+		matched = matched[:f.Limit]
+	}
+	return matched
+}
@@ -0,0 +1,230 @@
+package indexer
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// mediaExtensions 校验时视为下载结果的文件扩展名
+var mediaExtensions = map[string]bool{
+	".mp4": true, ".mkv": true, ".webm": true, ".avi": true, ".mov": true, ".m4v": true, ".flv": true,
+	".m4a": true, ".mp3": true, ".opus": true, ".ogg": true, ".aac": true, ".wav": true, ".flac": true,
+}
+
+// IssueKind 索引校验发现的问题类型
+type IssueKind string
+
+const (
+	IssueMissing   IssueKind = "missing"   // 找不到文件
+	IssueEmpty     IssueKind = "empty"     // 文件大小为 0
+	IssueTruncated IssueKind = "truncated" // 文件小于记录的大小
+	IssueMoved     IssueKind = "moved"     // 记录的路径不存在，但按视频ID找到了文件
+)
+
+// Issue 一条有问题的下载记录
+type Issue struct {
+	Record Record
+	Kind   IssueKind
+	// Path 找到的文件路径，文件不存在时为空
+	Path string
+	// Size 找到的文件大小
+	Size int64
+}
+
+// Stale 判断记录是否应该从索引中删除，使下次运行重新下载
+func (issue Issue) Stale() bool {
+	return issue.Kind != IssueMoved
+}
+
+func (issue Issue) String() string {
+	switch issue.Kind {
+	case IssueMissing:
+		return fmt.Sprintf("[缺失] %s: 找不到文件 %s", issue.Record.ID, issue.Record.FilePath)
+	case IssueEmpty:
+		return fmt.Sprintf("[空文件] %s: %s", issue.Record.ID, issue.Path)
+	case IssueTruncated:
+		return fmt.Sprintf("[不完整] %s: %s 大小 %d 字节，记录为 %d 字节", issue.Record.ID, issue.Path, issue.Size, issue.Record.FileSize)
+	case IssueMoved:
+		return fmt.Sprintf("[已移动] %s: %s -> %s", issue.Record.ID, issue.Record.FilePath, issue.Path)
+	default:
+		return fmt.Sprintf("[%s] %s", issue.Kind, issue.Record.ID)
+	}
+}
+
+// VerifyReport 索引校验结果
+type VerifyReport struct {
+	// Checked 检查的记录数
+	Checked int
+	// Issues 有问题的记录，按视频ID排序
+	Issues []Issue
+	// Orphans 没有对应索引记录的媒体文件
+	Orphans []string
+}
+
+// Verify 检查每条下载记录对应的文件是否仍然完整
+// 先按记录的文件路径查找，找不到时在 dirs 下按文件名中的视频ID查找；
+// 同时列出 dirs 下没有被任何记录引用的媒体文件
+func Verify(records []Record, dirs []string) (*VerifyReport, error) {
+	files, err := scanMediaFiles(dirs)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &VerifyReport{Checked: len(records)}
+	referenced := make(map[string]bool)
+	for _, record := range records {
+		path, moved := locateFile(record, files)
+		if path == "" {
+			report.Issues = append(report.Issues, Issue{Record: record, Kind: IssueMissing})
+			continue
+		}
+		referenced[path] = true
+
+		info, err := os.Stat(path)
+		if err != nil {
+			report.Issues = append(report.Issues, Issue{Record: record, Kind: IssueMissing})
+			continue
+		}
+		issue := Issue{Record: record, Path: path, Size: info.Size()}
+		switch {
+		case info.Size() == 0:
+			issue.Kind = IssueEmpty
+		case record.FileSize > 0 && info.Size() < record.FileSize:
+			issue.Kind = IssueTruncated
+		case moved:
+			issue.Kind = IssueMoved
+		default:
+			continue
+		}
+		report.Issues = append(report.Issues, issue)
+	}
+
+	for _, file := range files {
+		if !referenced[file] {
+			report.Orphans = append(report.Orphans, file)
+		}
+	}
+
+	sort.Slice(report.Issues, func(i, j int) bool {
+		return report.Issues[i].Record.ID < report.Issues[j].Record.ID
+	})
+	return report, nil
+}
+
+// Fix 删除报告中失效的记录，并更新已移动文件的路径，返回删除的记录数
+func (idx *Indexer) Fix(report *VerifyReport) (int, error) {
+	var stale []string
+	for _, issue := range report.Issues {
+		if issue.Stale() {
+			stale = append(stale, issue.Record.ID)
+			continue
+		}
+		record := issue.Record
+		record.FilePath = issue.Path
+		if err := idx.AddRecord(record); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := idx.Remove(stale...); err != nil {
+		return 0, err
+	}
+	return len(stale), nil
+}
+
+// scanMediaFiles 返回 dirs 下所有媒体文件的绝对路径，已排序且去重
+// 不存在的目录直接跳过
+func scanMediaFiles(dirs []string) ([]string, error) {
+	seen := make(map[string]bool)
+	for _, dir := range dirs {
+		if dir == "" {
+			continue
+		}
+		err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			if entry.IsDir() || !mediaExtensions[strings.ToLower(filepath.Ext(path))] {
+				return nil
+			}
+			seen[absPath(path)] = true
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("扫描目录 %s 失败: %w", dir, err)
+		}
+	}
+
+	files := make([]string, 0, len(seen))
+	for file := range seen {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// locateFile 查找记录对应的文件，返回绝对路径，以及文件是否不在记录的路径上
+func locateFile(record Record, files []string) (string, bool) {
+	if record.FilePath != "" {
+		if info, err := os.Stat(record.FilePath); err == nil && !info.IsDir() {
+			return absPath(record.FilePath), false
+		}
+	}
+
+	id, audio := strings.CutSuffix(record.ID, ":audio")
+	if id == "" {
+		return "", false
+	}
+	for _, file := range files {
+		if audio != isAudioDownload(file) {
+			continue
+		}
+		if containsID(filepath.Base(file), id) {
+			return file, record.FilePath != ""
+		}
+	}
+	return "", false
+}
+
+// containsID 判断文件名中是否包含完整的视频ID，ID 前后不能紧接字母或数字
+func containsID(name, id string) bool {
+	for offset := 0; ; {
+		i := strings.Index(name[offset:], id)
+		if i < 0 {
+			return false
+		}
+		start := offset + i
+		end := start + len(id)
+		if (start == 0 || !isAlnum(name[start-1])) && (end == len(name) || !isAlnum(name[end])) {
+			return true
+		}
+		offset = start + 1
+	}
+}
+
+func isAlnum(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// isAudioDownload 判断是否为音频模式下载的文件：音频扩展名，或者位于 audio 目录中
+func isAudioDownload(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".m4a", ".mp3", ".opus", ".ogg", ".aac", ".wav", ".flac":
+		return true
+	}
+	return filepath.Base(filepath.Dir(path)) == "audio"
+}
+
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return filepath.Clean(path)
+}
@@ -0,0 +1,114 @@
+package indexer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTestFile(t *testing.T, path string, size int) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, make([]byte, size), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "youtube_short_Good_good1_20240501.mp4"), 100)
+	writeTestFile(t, filepath.Join(dir, "youtube_short_Empty_empty1_20240501.mp4"), 0)
+	writeTestFile(t, filepath.Join(dir, "youtube_short_Cut_cut1_20240501.mp4"), 50)
+	writeTestFile(t, filepath.Join(dir, "moved", "youtube_short_Moved_moved1_20240501.mp4"), 10)
+	writeTestFile(t, filepath.Join(dir, "audio", "youtube_short_Song_good1_20240501.m4a"), 10)
+	writeTestFile(t, filepath.Join(dir, "youtube_short_Orphan_other1_20240501.mp4"), 10)
+	writeTestFile(t, filepath.Join(dir, "youtube_short_Good_good1_20240501.jpg"), 10)
+
+	records := []Record{
+		{ID: "good1", FilePath: filepath.Join(dir, "youtube_short_Good_good1_20240501.mp4"), FileSize: 100},
+		{ID: AudioKey("good1")},
+		{ID: "empty1"},
+		{ID: "cut1", FileSize: 100},
+		{ID: "moved1", FilePath: filepath.Join(dir, "youtube_short_Moved_moved1_20240501.mp4")},
+		{ID: "gone1", FilePath: filepath.Join(dir, "gone.mp4")},
+		// ID 只是其他文件名的一部分，不能算作匹配
+		{ID: "ood1"},
+	}
+
+	report, err := Verify(records, []string{dir, filepath.Join(dir, "moved")})
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if report.Checked != len(records) {
+		t.Errorf("Checked = %d, want %d", report.Checked, len(records))
+	}
+
+	want := map[string]IssueKind{
+		"cut1":   IssueTruncated,
+		"empty1": IssueEmpty,
+		"gone1":  IssueMissing,
+		"moved1": IssueMoved,
+		"ood1":   IssueMissing,
+	}
+	if len(report.Issues) != len(want) {
+		t.Errorf("Issues = %v, want %d issues", report.Issues, len(want))
+	}
+	for _, issue := range report.Issues {
+		if want[issue.Record.ID] != issue.Kind {
+			t.Errorf("issue %s kind = %s, want %s", issue.Record.ID, issue.Kind, want[issue.Record.ID])
+		}
+	}
+
+	if len(report.Orphans) != 1 || filepath.Base(report.Orphans[0]) != "youtube_short_Orphan_other1_20240501.mp4" {
+		t.Errorf("Orphans = %v", report.Orphans)
+	}
+
+	idx := NewIndexer(dir)
+	for _, record := range records {
+		if err := idx.AddRecord(record); err != nil {
+			t.Fatalf("AddRecord() error = %v", err)
+		}
+	}
+	removed, err := idx.Fix(report)
+	if err != nil {
+		t.Fatalf("Fix() error = %v", err)
+	}
+	if removed != 4 {
+		t.Errorf("Fix() removed %d records, want 4", removed)
+	}
+
+	reloaded := NewIndexer(dir)
+	if err := reloaded.Load(); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if reloaded.GetCount() != 3 {
+		t.Errorf("GetCount() = %d, want 3", reloaded.GetCount())
+	}
+	if reloaded.IsDownloaded("gone1") || !reloaded.IsDownloaded(AudioKey("good1")) {
+		t.Errorf("unexpected records after Fix(): %v", reloaded.Records())
+	}
+	if record, _ := reloaded.GetRecord("moved1"); filepath.Base(filepath.Dir(record.FilePath)) != "moved" {
+		t.Errorf("moved1 FilePath = %s, want file in moved/", record.FilePath)
+	}
+}
+
+func TestSQLiteStoreDelete(t *testing.T) {
+	store := newTestSQLiteStore(t)
+	for _, id := range []string{"a", "b", "c"} {
+		if err := store.Put(Record{ID: id}); err != nil {
+			t.Fatalf("Put() error = %v", err)
+		}
+	}
+	if err := store.Delete("a", "c", "missing"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	records, err := store.Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(records) != 1 || records[0].ID != "b" {
+		t.Errorf("Load() = %v, want [b]", records)
+	}
+}
@@ -2,20 +2,24 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"database/sql"
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
 	"path/filepath"
-	"runtime"
 	"sort"
 	"strings"
-	"sync"
+	"syscall"
 	"time"
 
 	"batch_download_videos/config"
 	"batch_download_videos/downloader"
 	"batch_download_videos/indexer"
 	"batch_download_videos/logger"
+	"batch_download_videos/storage"
+	"batch_download_videos/task"
 	"batch_download_videos/utils"
 )
 
@@ -42,6 +46,10 @@ func main() {
 	configPath := flag.String("c", "", "配置文件路径 (默认: config.json)")
 	logDir := flag.String("log", "logs", "日志目录")
 	logLevel := flag.String("log-level", "info", "日志级别 (debug/info/warn/error)")
+	audioOnly := flag.Bool("x", false, "只下载音频")
+	audioFormat := flag.String("audio-format", "", "音频转码格式 (mp3/m4a/opus)，为空时保留原始格式")
+	audioBitrate := flag.String("audio-bitrate", "", "音频转码比特率 (例如 192k)")
+	reportFiles := flag.String("report", "", "运行报告文件，多个文件用逗号分隔，.xml 为 JUnit XML 格式，其他为 JSON 格式")
 	help := flag.Bool("help", false, "显示帮助信息")
 	version := flag.Bool("version", false, "显示版本信息")
 	flag.Parse()
@@ -56,9 +64,28 @@ func main() {
 		return
 	}
 
+	// 出现错误或有URL下载失败时以非零状态退出；最先注册，在关闭数据库和日志等其他 defer 之后执行
+	exitCode := 0
+	defer func() {
+		if exitCode != 0 {
+			os.Exit(exitCode)
+		}
+	}()
+
+	command := flag.Arg(0)
+	switch command {
+	case "", "verify", "import-archive", "export-archive", "retry-failed":
+	default:
+		fmt.Printf("未知的命令: %s\n", command)
+		printHelp()
+		exitCode = 1
+		return
+	}
+
 	level := parseLogLevel(*logLevel)
 	if _, err := logger.InitLogger(*logDir, level); err != nil {
 		fmt.Printf("初始化日志失败: %v\n", err)
+		exitCode = 1
 		return
 	}
 	defer logger.GetLogger().Close()
@@ -66,6 +93,7 @@ func main() {
 	cfg, err := config.LoadConfig(*configPath)
 	if err != nil {
 		logger.GetLogger().Error("加载配置失败: %v", err)
+		exitCode = 1
 		return
 	}
 
@@ -75,6 +103,29 @@ func main() {
 	if *downloaderType != "" {
 		cfg.DefaultDownloader = *downloaderType
 	}
+	if *audioFormat != "" {
+		cfg.AudioFormat = strings.ToLower(*audioFormat)
+	}
+	if *audioBitrate != "" {
+		cfg.AudioBitrate = *audioBitrate
+	}
+	if err := downloader.ValidateAudioFormat(cfg.AudioFormat); err != nil {
+		logger.GetLogger().Error("配置错误: %v", err)
+		exitCode = 1
+		return
+	}
+
+	// 配置文件和命令行指定的默认下载选项，URL文件中可按URL覆盖
+	defaultOptions, err := downloader.DefaultOptions(cfg)
+	if err != nil {
+		logger.GetLogger().Error("配置错误: %v", err)
+		exitCode = 1
+		return
+	}
+	defaultOptions.AudioOnly = *audioOnly
+	if *audioOnly {
+		logger.GetLogger().Info("音频模式: 只下载音频")
+	}
 
 	logger.GetLogger().Info("使用分辨率: %sp", cfg.DefaultResolution)
 	logger.GetLogger().Info("使用下载器: %s", cfg.DefaultDownloader)
@@ -82,12 +133,88 @@ func main() {
 	outputDir := cfg.DefaultOutputDir
 	if err := utils.EnsureDir(outputDir); err != nil {
 		logger.GetLogger().Error("创建输出目录失败: %v", err)
+		exitCode = 1
 		return
 	}
 
-	idx := indexer.NewIndexer(outputDir)
+	taskFile := cfg.TaskFile
+	if taskFile == "" {
+		taskFile = ".download_tasks.json"
+	}
+
+	// 默认使用文本索引文件和 JSON 任务文件，sqlite 后端把两者保存到同一个数据库
+	var indexStore indexer.Store = indexer.NewFileStore(filepath.Join(outputDir, indexer.IndexFileName))
+	var taskStore task.Store = task.NewFileStore(filepath.Join(outputDir, taskFile))
+	var deadLetters task.DeadLetterStore = task.NewFileDeadLetterStore(filepath.Join(outputDir, cfg.DeadLetterFile))
+	switch strings.ToLower(cfg.StorageBackend) {
+	case "", "file":
+	case "sqlite":
+		db, sqliteIndex, sqliteTasks, err := openSQLiteStores(filepath.Join(outputDir, cfg.DatabaseFile), indexStore, taskStore)
+		if err != nil {
+			logger.GetLogger().Error("打开数据库失败: %v", err)
+			exitCode = 1
+			return
+		}
+		defer db.Close()
+		sqliteDeadLetters, err := task.NewSQLiteDeadLetterStore(db)
+		if err != nil {
+			logger.GetLogger().Error("打开数据库失败: %v", err)
+			exitCode = 1
+			return
+		}
+		indexStore, taskStore, deadLetters = sqliteIndex, sqliteTasks, sqliteDeadLetters
+		logger.GetLogger().Info("使用 SQLite 存储: %s", filepath.Join(outputDir, cfg.DatabaseFile))
+	default:
+		logger.GetLogger().Error("不支持的存储后端: %s (支持: file/sqlite)", cfg.StorageBackend)
+		exitCode = 1
+		return
+	}
+
+	idx := indexer.NewIndexerWithStore(indexStore)
+	// 索引加载失败时不能继续：空索引会导致重新下载所有视频，保存时还会覆盖原索引
 	if err := idx.Load(); err != nil {
-		logger.GetLogger().Warn("初始化索引失败: %v", err)
+		logger.GetLogger().Error("初始化索引失败: %v", err)
+		exitCode = 1
+		return
+	}
+
+	switch command {
+	case "verify":
+		if err := runVerify(cfg, idx, taskStore, flag.Args()[1:]); err != nil {
+			logger.GetLogger().Error("校验索引失败: %v", err)
+			exitCode = 1
+		}
+		return
+	case "import-archive":
+		if err := runImportArchive(idx, flag.Args()[1:]); err != nil {
+			logger.GetLogger().Error("导入下载存档失败: %v", err)
+			exitCode = 1
+		}
+		return
+	case "export-archive":
+		if err := runExportArchive(idx, flag.Args()[1:]); err != nil {
+			logger.GetLogger().Error("导出下载存档失败: %v", err)
+			exitCode = 1
+		}
+		return
+	}
+
+	var retryClasses []string
+	if command == "retry-failed" {
+		classes, list, err := parseRetryFailed(flag.Args()[1:])
+		if err != nil {
+			logger.GetLogger().Error("解析 retry-failed 参数失败: %v", err)
+			exitCode = 1
+			return
+		}
+		if list {
+			if err := listFailed(deadLetters, classes); err != nil {
+				logger.GetLogger().Error("读取失败记录失败: %v", err)
+				exitCode = 1
+			}
+			return
+		}
+		retryClasses = classes
 	}
 
 	var dl downloader.Downloader
@@ -99,6 +226,7 @@ func main() {
 		dl = downloader.NewMultiPlatformDownloader(cfg, idx)
 		if err := dl.(*downloader.MultiPlatformDownloader).CheckYTDLP(); err != nil {
 			logger.GetLogger().Error("检查 yt-dlp 失败: %v", err)
+			exitCode = 1
 			return
 		}
 		logger.GetLogger().Info("使用多平台下载器（支持9+平台）")
@@ -107,38 +235,144 @@ func main() {
 		multiDL := downloader.NewMultiPlatformDownloader(cfg, idx)
 		if err := multiDL.CheckYTDLP(); err != nil {
 			logger.GetLogger().Error("检查 yt-dlp 失败: %v", err)
+			exitCode = 1
+			return
+		}
+		smartDL, err := downloader.NewSmartDownloaderWithRules(ytDL, multiDL, cfg.RoutingRules)
+		if err != nil {
+			logger.GetLogger().Error("路由规则配置错误: %v", err)
+			exitCode = 1
 			return
 		}
-		dl = downloader.NewSmartDownloader(ytDL, multiDL)
-		logger.GetLogger().Info("使用智能下载器（自动检测平台，YouTube用专用，其他用multi）")
+		dl = smartDL
+		logger.GetLogger().Info("使用智能下载器（按路由规则选择下载器，失败时依次尝试备用下载器）")
 	default:
 		logger.GetLogger().Error("不支持的下载器类型: %s (支持: youtube/multi/auto)", cfg.DefaultDownloader)
+		exitCode = 1
+		return
+	}
+
+	// Ctrl-C 或 SIGTERM 时取消所有正在进行的下载，未完成的任务保留在任务文件中
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// 任务状态加载失败时不能继续：空队列会在保存时覆盖上次未完成的任务
+	tm, err := task.OpenTaskManager(cfg.MaxConcurrency, taskStore)
+	if err != nil {
+		logger.GetLogger().Error("初始化任务队列失败: %v", err)
+		exitCode = 1
 		return
 	}
+	tm.SetRetryPolicy(downloader.NewRetryPolicy(cfg, "task"))
+	if recovered := tm.RecoverProcessing(); recovered > 0 {
+		logger.GetLogger().Info("上次运行中断，已恢复 %d 个未完成的任务", recovered)
+	}
+	sched := task.NewScheduler(tm, dl)
+	sched.SetDeadLetters(deadLetters)
 
-	if *filePath != "" {
-		if err := processFromFile(*filePath, cfg.DefaultResolution, outputDir, dl, idx, cfg.MaxConcurrency); err != nil {
+	if command == "retry-failed" {
+		if err := enqueueFailed(sched, deadLetters, retryClasses); err != nil {
+			logger.GetLogger().Error("重新排队失败的URL失败: %v", err)
+			exitCode = 1
+			return
+		}
+	} else if *filePath != "" {
+		if err := processFromFile(*filePath, cfg.DefaultResolution, outputDir, defaultOptions, sched); err != nil {
 			logger.GetLogger().Error("处理文件失败: %v", err)
+			exitCode = 1
 			return
 		}
 	} else {
-		if err := processFromDirectory(cfg.DefaultResolution, outputDir, dl, idx, cfg.MaxConcurrency); err != nil {
+		if err := processFromDirectory(cfg.DefaultResolution, outputDir, defaultOptions, sched); err != nil {
 			logger.GetLogger().Error("扫描目录失败: %v", err)
+			exitCode = 1
 			return
 		}
 	}
 
+	report := processURLs(ctx, sched, outputDir, cfg.MaxConcurrency)
+	if report.Fail > 0 {
+		exitCode = 1
+	}
+
+	// 命令行指定的报告文件相对于当前目录，配置文件中的相对于输出目录
+	paths := make([]string, 0, len(cfg.ReportFiles))
+	for _, path := range cfg.ReportFiles {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(outputDir, path)
+		}
+		paths = append(paths, path)
+	}
+	if *reportFiles != "" {
+		paths = strings.Split(*reportFiles, ",")
+	}
+	for _, path := range paths {
+		if path = strings.TrimSpace(path); path == "" {
+			continue
+		}
+		if err := report.WriteFile(path); err != nil {
+			logger.GetLogger().Error("写入运行报告失败: %v", err)
+			exitCode = 1
+			continue
+		}
+		logger.GetLogger().Info("运行报告已写入: %s", path)
+	}
+
 	if err := idx.Save(); err != nil {
 		logger.GetLogger().Error("保存索引失败: %v", err)
+		exitCode = 1
 	}
 
-	if err := updateDownloadRecord(outputDir); err != nil {
+	if err := updateDownloadRecord(outputDir, idx); err != nil {
 		logger.GetLogger().Error("更新下载记录失败: %v", err)
 	}
 
 	logger.GetLogger().Info("所有任务完成！")
 }
 
+// openSQLiteStores 打开数据库并创建索引和任务的存储后端
+// 数据库为空时（第一次切换到 sqlite 后端）导入原有索引文件和任务文件中的数据
+func openSQLiteStores(dbPath string, fileIndex indexer.Store, fileTasks task.Store) (*sql.DB, *indexer.SQLiteStore, *task.SQLiteStore, error) {
+	db, err := storage.OpenSQLite(dbPath)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	indexStore, err := indexer.NewSQLiteStore(db)
+	if err != nil {
+		db.Close()
+		return nil, nil, nil, err
+	}
+	if count, err := indexStore.Count(); err == nil && count == 0 {
+		imported, err := indexStore.Import(fileIndex)
+		if err != nil {
+			db.Close()
+			return nil, nil, nil, fmt.Errorf("导入索引文件失败: %w", err)
+		}
+		if imported > 0 {
+			logger.GetLogger().Info("已从索引文件导入 %d 条下载记录", imported)
+		}
+	}
+
+	taskStore, err := task.NewSQLiteStore(db)
+	if err != nil {
+		db.Close()
+		return nil, nil, nil, err
+	}
+	if count, err := taskStore.Count(); err == nil && count == 0 {
+		imported, err := taskStore.Import(fileTasks)
+		if err != nil {
+			db.Close()
+			return nil, nil, nil, fmt.Errorf("导入任务文件失败: %w", err)
+		}
+		if imported > 0 {
+			logger.GetLogger().Info("已从任务文件导入 %d 个任务", imported)
+		}
+	}
+
+	return db, indexStore, taskStore, nil
+}
+
 func parseLogLevel(level string) logger.LogLevel {
 	switch strings.ToLower(level) {
 	case "debug":
@@ -154,47 +388,81 @@ func parseLogLevel(level string) logger.LogLevel {
 	}
 }
 
-func processFromFile(filePath, resolution, outputDir string, dl downloader.Downloader, idx *indexer.Indexer, maxConcurrency int) error {
+// processFromFile 读取URL文件，将有效URL加入任务队列
+// 每行一个URL，URL后面可以跟下载选项，例如 "https://... audio=mp3"
+func processFromFile(filePath, resolution, outputDir string, defaults downloader.Options, sched *task.Scheduler) error {
 	file, err := os.Open(filePath)
 	if err != nil {
 		return fmt.Errorf("打开文件失败: %w", err)
 	}
 	defer file.Close()
 
-	var urls []string
+	total := 0
+	invalid := 0
+	added := 0
+	valid := 0
+	duplicates := 0
+	lineNumber := 0
+	// 规范化后的去重键，同一视频的不同写法只下载一次；音频和视频分别计算
+	seen := make(map[string]int)
 	scanner := bufio.NewScanner(file)
 	for scanner.Scan() {
-		url := strings.TrimSpace(scanner.Text())
-		if url == "" || strings.HasPrefix(url, "#") {
+		lineNumber++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		total++
+
+		normalized, err := utils.NormalizeURL(fields[0])
+		if err != nil {
+			logger.GetLogger().Error("URL验证失败: 第 %d 行: %v", lineNumber, err)
+			invalid++
+			continue
+		}
+		opts, err := downloader.ParseOptions(defaults, fields[1:])
+		if err != nil {
+			logger.GetLogger().Error("URL选项无效: 第 %d 行: %v", lineNumber, err)
+			invalid++
 			continue
 		}
-		urls = append(urls, url)
+
+		key := normalized.Key()
+		if opts.AudioOnly {
+			key += ":audio"
+		}
+		if first, ok := seen[key]; ok {
+			logger.GetLogger().Info("跳过重复的URL: 第 %d 行与第 %d 行是同一个视频 (%s)", lineNumber, first, key)
+			duplicates++
+			continue
+		}
+		seen[key] = lineNumber
+
+		valid++
+		if sched.EnqueueWithOptions(normalized.URL, outputDir, resolution, opts) {
+			added++
+		}
 	}
 
 	if err := scanner.Err(); err != nil {
 		return fmt.Errorf("读取文件失败: %w", err)
 	}
 
-	// 验证URL列表
-	validURLs, validationErrors := utils.ValidateURLs(urls)
-	if len(validationErrors) > 0 {
-		for _, err := range validationErrors {
-			logger.GetLogger().Error("URL验证失败: %v", err)
-		}
-		logger.GetLogger().Warn("发现 %d 个无效URL，将跳过这些URL", len(validationErrors))
+	if invalid > 0 {
+		logger.GetLogger().Warn("发现 %d 个无效URL，将跳过这些URL", invalid)
 	}
 
-	if len(validURLs) == 0 {
+	if valid == 0 {
 		logger.GetLogger().Error("没有有效的URL可以处理")
 		return nil
 	}
 
-	logger.GetLogger().Info("开始处理文件: %s (共 %d 个URL，其中 %d 个有效)", filePath, len(urls), len(validURLs))
+	logger.GetLogger().Info("开始处理文件: %s (共 %d 个URL，其中 %d 个有效，%d 个重复，新加入队列 %d 个)", filePath, total, valid, duplicates, added)
 
-	return processURLs(validURLs, resolution, outputDir, dl, maxConcurrency)
+	return nil
 }
 
-func processFromDirectory(resolution, outputDir string, dl downloader.Downloader, idx *indexer.Indexer, maxConcurrency int) error {
+func processFromDirectory(resolution, outputDir string, defaults downloader.Options, sched *task.Scheduler) error {
 	logger.GetLogger().Info("开始扫描 %s 目录...", "resource_urls")
 
 	entries, err := os.ReadDir("resource_urls")
@@ -221,7 +489,7 @@ func processFromDirectory(resolution, outputDir string, dl downloader.Downloader
 	logger.GetLogger().Info("找到 %d 个 URL 文件", len(urlFiles))
 
 	for _, file := range urlFiles {
-		if err := processFromFile(file, resolution, outputDir, dl, idx, maxConcurrency); err != nil {
+		if err := processFromFile(file, resolution, outputDir, defaults, sched); err != nil {
 			logger.GetLogger().Error("处理文件 %s 失败: %v", file, err)
 		}
 	}
@@ -229,133 +497,52 @@ func processFromDirectory(resolution, outputDir string, dl downloader.Downloader
 	return nil
 }
 
-func processURLs(urls []string, resolution, outputDir string, dl downloader.Downloader, maxConcurrency int) error {
-	if maxConcurrency <= 0 {
-		maxConcurrency = 3
+// processURLs 运行调度器，执行任务队列中的所有下载任务，返回本次运行的报告
+func processURLs(ctx context.Context, sched *task.Scheduler, outputDir string, maxConcurrency int) task.RunReport {
+	pending := len(sched.Manager().GetPendingTasks())
+	if pending == 0 {
+		logger.GetLogger().Info("任务队列为空，没有需要下载的URL")
+		now := time.Now()
+		return task.RunReport{StartedAt: now, FinishedAt: now}
 	}
 
-	// 动态并发控制：根据系统CPU核心数和网络状况调整
-	// 获取CPU核心数
-	cpuCount := runtime.NumCPU()
-
-	// 基础并发数：根据CPU核心数计算
-	baseConcurrency := cpuCount * 2
-
-	// 最大并发数限制：不超过配置的最大值，也不超过CPU核心数的4倍
-	maxPossibleConcurrency := min(baseConcurrency*2, maxConcurrency)
-	maxPossibleConcurrency = min(maxPossibleConcurrency, cpuCount*4)
-
-	// 最小并发数：确保至少有1个并发
-	minConcurrency := 1
-
-	// 推荐并发数：根据URL数量动态调整
-	recommendedConcurrency := baseConcurrency
-	if len(urls) < baseConcurrency {
-		// URL数量较少时，使用URL数量作为并发数
-		recommendedConcurrency = len(urls)
-	} else if len(urls) > maxPossibleConcurrency*2 {
-		// URL数量较多时，使用最大可能并发数
-		recommendedConcurrency = maxPossibleConcurrency
+	if maxConcurrency <= 0 {
+		maxConcurrency = 3
 	}
 
-	// 确保并发数在合理范围内
-	recommendedConcurrency = max(recommendedConcurrency, minConcurrency)
-	recommendedConcurrency = min(recommendedConcurrency, maxPossibleConcurrency)
-
-	semaphore := make(chan struct{}, recommendedConcurrency)
-	var wg sync.WaitGroup
-	var errMutex sync.Mutex
-	var batchErr error
-	successCount := 0
-	failCount := 0
-	skipCount := 0
-	completedCount := 0
+	// 按配置的并发数启动 worker：播放列表和频道在执行时才展开为多个视频，不能按当前的任务数减少并发
+	sched.Manager().MaxConcurrent = maxConcurrency
 
-	// 进度更新间隔
-	progressInterval := 2 * time.Second
-	lastProgressUpdate := time.Now()
-
-	logger.GetLogger().BatchStart(len(urls), recommendedConcurrency)
-	logger.GetLogger().Info("使用动态并发控制，并发数: %d (基于CPU核心数: %d, URL数量: %d)", recommendedConcurrency, cpuCount, len(urls))
-	logger.GetLogger().Info("并发数范围: 最小=%d, 最大=%d, 基础=%d", minConcurrency, maxPossibleConcurrency, baseConcurrency)
+	logger.GetLogger().BatchStart(pending, maxConcurrency)
+	logger.GetLogger().Info("并发数: %d, 任务数量: %d", maxConcurrency, pending)
 
 	// 启动进度显示goroutine
 	progressDone := make(chan struct{})
 	go func() {
+		ticker := time.NewTicker(2 * time.Second)
+		defer ticker.Stop()
 		for {
 			select {
 			case <-progressDone:
 				return
-			default:
-				if time.Since(lastProgressUpdate) >= progressInterval {
-					progress := float64(completedCount) / float64(len(urls)) * 100
-					logger.GetLogger().Info("整体下载进度: %.2f%% (完成 %d/%d, 成功 %d, 失败 %d, 跳过 %d)",
-						progress, completedCount, len(urls), successCount, failCount, skipCount)
-					lastProgressUpdate = time.Now()
-				}
-				time.Sleep(500 * time.Millisecond)
+			case <-ticker.C:
+				logProgress(sched.Stats())
 			}
 		}
 	}()
 
-	for i, url := range urls {
-		wg.Add(1)
-		semaphore <- struct{}{}
-
-		go func(url string, idx int) {
-			defer wg.Done()
-			defer func() {
-				// 释放信号量时添加短暂延迟，避免瞬间启动过多下载导致网络拥塞
-				time.Sleep(100 * time.Millisecond)
-				<-semaphore
-
-				// 更新完成计数和进度
-				errMutex.Lock()
-				completedCount++
-				errMutex.Unlock()
-			}()
-
-			logger.GetLogger().Debug("[%d/%d] 开始下载: %s", idx+1, len(urls), url)
-
-			result, err := dl.Download(url, outputDir, resolution)
-			if err != nil {
-				errMutex.Lock()
-				failCount++
-				batchErr = err
-				errMutex.Unlock()
-				logger.GetLogger().DownloadFail("", url, err, 0)
-			} else if result != nil {
-				if result.Success {
-					errMutex.Lock()
-					successCount++
-					errMutex.Unlock()
-					logger.GetLogger().DownloadSuccess(result.VideoID, result.Title, result.RetryCount, result.FileSize)
-				} else {
-					if result.Error != nil && result.Error.Error() == "视频已下载" {
-						errMutex.Lock()
-						skipCount++
-						errMutex.Unlock()
-						logger.GetLogger().DownloadSkip(result.VideoID, result.Title)
-					} else {
-						errMutex.Lock()
-						failCount++
-						errMutex.Unlock()
-						logger.GetLogger().DownloadFail(result.VideoID, result.Title, result.Error, result.RetryCount)
-					}
-				}
-			}
-		}(url, i)
-	}
-
-	wg.Wait()
+	stats := sched.Run(ctx)
 	close(progressDone)
 
 	// 最终进度更新
-	progress := float64(completedCount) / float64(len(urls)) * 100
-	logger.GetLogger().Info("整体下载进度: %.2f%% (完成 %d/%d, 成功 %d, 失败 %d, 跳过 %d)",
-		progress, completedCount, len(urls), successCount, failCount, skipCount)
+	logProgress(stats)
+	logger.GetLogger().BatchComplete(stats.Success, stats.Fail, stats.Skip, stats.Total)
 
-	logger.GetLogger().BatchComplete(successCount, failCount, skipCount, len(urls))
+	if ctx.Err() != nil {
+		// 未完成的 .part 等文件已保留，文件名只由平台和视频ID决定，下次运行时从任务文件恢复并继续下载
+		logger.GetLogger().Warn("下载已中断，剩余 %d 个任务已保存，下次运行时继续", len(sched.Manager().GetPendingTasks()))
+		return sched.Report()
+	}
 
 	// 清理临时文件
 	if err := utils.CleanupTempFilesRecursive(outputDir); err != nil {
@@ -363,13 +550,30 @@ func processURLs(urls []string, resolution, outputDir string, dl downloader.Down
 	} else {
 		logger.GetLogger().Info("临时文件清理完成")
 	}
+	return sched.Report()
+}
 
-	return batchErr
+// logProgress 输出整体下载进度
+func logProgress(stats task.SchedulerStats) {
+	if stats.Total == 0 {
+		return
+	}
+	progress := float64(stats.Completed()) / float64(stats.Total) * 100
+	logger.GetLogger().Info("整体下载进度: %.2f%% (完成 %d/%d, 成功 %d, 失败 %d, 跳过 %d)",
+		progress, stats.Completed(), stats.Total, stats.Success, stats.Fail, stats.Skip)
 }
 
-func updateDownloadRecord(baseDir string) error {
+// updateDownloadRecord 扫描输出目录生成下载记录，索引中有记录的文件使用索引中的视频ID、标题和下载时间
+func updateDownloadRecord(baseDir string, idx *indexer.Indexer) error {
 	recordFile := filepath.Join(baseDir, "下载记录.md")
 
+	records := make(map[string]indexer.Record)
+	for _, record := range idx.Records() {
+		if record.FilePath != "" {
+			records[indexPathKey(record.FilePath)] = record
+		}
+	}
+
 	totalSize := int64(0)
 	videoCount := 0
 	var videos []struct {
@@ -402,6 +606,16 @@ func updateDownloadRecord(baseDir string) error {
 
 		size := utils.FormatFileSize(info.Size())
 		downloadTime := info.ModTime().Format("2006-01-02 15:04")
+		videoID := "-"
+		if record, ok := records[indexPathKey(path)]; ok {
+			videoID = record.ID
+			if record.Title != "" {
+				title = record.Title
+			}
+			if !record.DownloadedAt.IsZero() {
+				downloadTime = record.DownloadedAt.Format("2006-01-02 15:04")
+			}
+		}
 
 		relPath := strings.TrimPrefix(path, baseDir+"/")
 		relPath = strings.TrimPrefix(relPath, "resource_urls/")
@@ -422,7 +636,7 @@ func updateDownloadRecord(baseDir string) error {
 			path         string
 		}{
 			title:        title,
-			videoID:      "-",
+			videoID:      videoID,
 			size:         size,
 			downloadTime: downloadTime,
 			path:         relPath,
@@ -492,11 +706,23 @@ func updateDownloadRecord(baseDir string) error {
 	return nil
 }
 
+// indexPathKey 返回用于匹配索引记录和文件的路径，统一为绝对路径
+func indexPathKey(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return filepath.Clean(path)
+}
+
 func printHelp() {
 	fmt.Println("批量视频下载工具 - 混合架构")
 	fmt.Println()
 	fmt.Println("用法:")
 	fmt.Println("  batch_download [选项]")
+	fmt.Println("  batch_download [选项] verify [--fix]")
+	fmt.Println("  batch_download [选项] import-archive [--audio] <存档文件>...")
+	fmt.Println("  batch_download [选项] export-archive [--platform 平台] [--audio] <存档文件>")
+	fmt.Println("  batch_download [选项] retry-failed [--class 错误类别,...] [--list]")
 	fmt.Println()
 	fmt.Println("选项:")
 	fmt.Println("  -r string")
@@ -514,15 +740,49 @@ func printHelp() {
 	fmt.Println("        日志目录 (默认: logs)")
 	fmt.Println("  -log-level string")
 	fmt.Println("        日志级别 (debug/info/warn/error) (默认: info)")
+	fmt.Println("  -x")
+	fmt.Println("        只下载音频，保存到平台输出目录下的 audio 子目录")
+	fmt.Println("  -audio-format string")
+	fmt.Println("        音频转码格式 (mp3/m4a/opus)，需要 ffmpeg (默认: 从配置文件读取，为空时保留原始格式)")
+	fmt.Println("  -audio-bitrate string")
+	fmt.Println("        音频转码比特率，例如 192k (默认: 从配置文件读取)")
+	fmt.Println("  -report string")
+	fmt.Println("        运行报告文件，多个文件用逗号分隔，.xml 为 JUnit XML 格式，其他为 JSON 格式")
+	fmt.Println("        有URL下载失败、报告写入失败或程序无法运行时以退出码 1 结束")
 	fmt.Println("  -help")
 	fmt.Println("        显示帮助信息")
 	fmt.Println("  -version")
 	fmt.Println("        显示版本信息")
 	fmt.Println()
+	fmt.Println("命令:")
+	fmt.Println("  verify         检查索引中的每条记录是否有对应的文件，报告缺失、为空或不完整的文件，")
+	fmt.Println("                 以及没有索引记录的文件")
+	fmt.Println("  verify --fix   同时删除失效的索引记录（下次运行时重新下载），并更新已移动文件的路径")
+	fmt.Println("  import-archive 把 yt-dlp 下载存档（--download-archive）中的视频导入索引")
+	fmt.Println("  export-archive 把索引中的记录追加到 yt-dlp 下载存档，存档中已有的行保持不变")
+	fmt.Println("  retry-failed   重新下载重试后仍然失败的URL，--class 只处理指定错误类别，--list 只列出不下载")
+	fmt.Println()
+	fmt.Println("URL文件格式:")
+	fmt.Println("  每行一个URL，# 开头的行为注释。URL后面可以跟下载选项，用空格分隔:")
+	fmt.Println("    audio              只下载音频")
+	fmt.Println("    audio=mp3          只下载音频并转码为 mp3/m4a/opus")
+	fmt.Println("    audio-bitrate=128k 音频转码比特率")
+	fmt.Println("    video              下载视频（覆盖 -x）")
+	fmt.Println("    subs=en,zh-Hans    下载指定语言的字幕（覆盖配置文件的 subtitle_langs）")
+	fmt.Println("    no-subs            不下载字幕")
+	fmt.Println("    embed-subs         将字幕嵌入到视频文件中，需要 ffmpeg")
+	fmt.Println("    limit=20           播放列表和频道最多下载 20 个视频（频道默认为 channel_max_items）")
+	fmt.Println("    range=5-20         只下载播放列表和频道中的第 5 到 20 个视频")
+	fmt.Println("    order=oldest       按相反的顺序选取（频道从最早的视频开始），order=newest 恢复原始顺序")
+	fmt.Println("    after=20240101     只下载该日期当天或之后上传的视频，也可以写 today-7days")
+	fmt.Println("    before=20241231    只下载该日期当天或之前上传的视频")
+	fmt.Println("    stop-at-indexed    遇到第一个已下载的视频时停止，用于增量同步频道")
+	fmt.Println("  例如: https://www.youtube.com/watch?v=xxxx audio=mp3")
+	fmt.Println()
 	fmt.Println("下载器说明:")
 	fmt.Println("  youtube  - YouTube 专用下载器（使用 Go 库，性能更好，支持 YouTube Shorts）")
 	fmt.Println("  multi    - 多平台下载器（使用 yt-dlp，支持9+平台）")
-	fmt.Println("  auto     - 自动检测（YouTube用专用下载器，其他平台用multi）")
+	fmt.Println("  auto     - 按 routing_rules 路由（默认YouTube视频先用专用下载器，失败后用multi；其他平台用multi）")
 	fmt.Println()
 	fmt.Println("配置文件 (config.json):")
 	fmt.Println("  {")
@@ -537,7 +797,17 @@ func printHelp() {
 	fmt.Println("    \"index_file\": \".video_downloaded.index\",")
 	fmt.Println("    \"record_file\": \"下载记录.md\",")
 	fmt.Println("    \"default_resolution\": \"720\",")
-	fmt.Println("    \"default_downloader\": \"auto\"")
+	fmt.Println("    \"default_downloader\": \"auto\",")
+	fmt.Println("    \"task_file\": \".download_tasks.json\",")
+	fmt.Println("    \"download_segments\": 4,")
+	fmt.Println("    \"subtitle_langs\": [\"en\", \"zh-Hans\"],")
+	fmt.Println("    \"embed_subtitles\": false,")
+	fmt.Println("    \"write_thumbnail\": true,")
+	fmt.Println("    \"embed_thumbnail\": false,")
+	fmt.Println("    \"storage_backend\": \"file\",")
+	fmt.Println("    \"channel_max_items\": 10,")
+	fmt.Println("    \"stop_at_indexed\": false,")
+	fmt.Println("    \"routing_rules\": [{\"platform\": \"youtube\", \"kinds\": [\"video\", \"short\"], \"downloaders\": [\"youtube\", \"multi\"]}]")
 	fmt.Println("  }")
 	fmt.Println()
 	fmt.Println("示例:")
@@ -553,6 +823,18 @@ func printHelp() {
 	fmt.Println("  # 下载指定文件")
 	fmt.Println("  ./batch_download -f resource_urls/example.txt")
 	fmt.Println()
+	fmt.Println("  # 只下载音频并转码为 mp3")
+	fmt.Println("  ./batch_download -f resource_urls/podcasts.txt -x -audio-format mp3 -audio-bitrate 192k")
+	fmt.Println()
+	fmt.Println("  # 生成 JSON 和 JUnit XML 格式的运行报告")
+	fmt.Println("  ./batch_download -report report.json,report.xml")
+	fmt.Println()
+	fmt.Println("  # 检查索引并删除文件已丢失的记录")
+	fmt.Println("  ./batch_download verify --fix")
+	fmt.Println()
+	fmt.Println("  # 重新下载因网络错误失败的URL")
+	fmt.Println("  ./batch_download retry-failed -class network")
+	fmt.Println()
 	fmt.Println("  # 启用调试日志")
 	fmt.Println("  ./batch_download -log-level debug")
 	fmt.Println()
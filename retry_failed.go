@@ -0,0 +1,65 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"batch_download_videos/logger"
+	"batch_download_videos/task"
+)
+
+// parseRetryFailed 解析 retry-failed 子命令的参数，返回要重试的错误类别和是否只列出失败记录
+func parseRetryFailed(args []string) (classes []string, list bool, err error) {
+	flags := flag.NewFlagSet("retry-failed", flag.ContinueOnError)
+	class := flags.String("class", "", "只处理指定错误类别的URL，多个类别用逗号分隔，例如 network,rate_limited")
+	listOnly := flags.Bool("list", false, "只列出失败的URL，不下载")
+	if err := flags.Parse(args); err != nil {
+		return nil, false, err
+	}
+	if flags.NArg() > 0 {
+		return nil, false, fmt.Errorf("未知的参数: %s", strings.Join(flags.Args(), " "))
+	}
+
+	for _, name := range strings.Split(*class, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			classes = append(classes, name)
+		}
+	}
+	return classes, *listOnly, nil
+}
+
+// listFailed 打印错误类别属于 classes 的失败记录
+func listFailed(store task.DeadLetterStore, classes []string) error {
+	letters, err := store.List(classes...)
+	if err != nil {
+		return err
+	}
+	for _, letter := range letters {
+		mode := "视频"
+		if letter.Options.AudioOnly {
+			mode = "音频"
+		}
+		fmt.Printf("%s [%s] %s 尝试 %d 次 %s\n", letter.FailedAt.Format("2006-01-02 15:04:05"), letter.ErrorClass, mode, letter.Attempts, letter.URL)
+		fmt.Printf("    %s\n", letter.Error)
+	}
+	fmt.Printf("共 %d 个失败的URL\n", len(letters))
+	return nil
+}
+
+// enqueueFailed 按失败记录中的输出目录、分辨率和下载选项重新排队，
+// 记录在下载成功后删除，再次失败时更新
+func enqueueFailed(sched *task.Scheduler, store task.DeadLetterStore, classes []string) error {
+	letters, err := store.List(classes...)
+	if err != nil {
+		return err
+	}
+	added := 0
+	for _, letter := range letters {
+		if sched.EnqueueWithOptions(letter.URL, letter.OutputDir, letter.Resolution, letter.Options) {
+			added++
+		}
+	}
+	logger.GetLogger().Info("从失败记录中重新排队 %d 个URL（共 %d 个）", added, len(letters))
+	return nil
+}
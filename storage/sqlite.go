@@ -0,0 +1,54 @@
+// Package storage 提供索引和任务状态共用的嵌入式 SQLite 数据库
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// TimeLayout 数据库中时间字段的格式（UTC），与 SQLite 的日期函数兼容，按字符串排序即按时间排序
+const TimeLayout = "2006-01-02 15:04:05.000"
+
+// OpenSQLite 打开 SQLite 数据库，文件不存在时创建
+// 启用 WAL 和忙等待，多个进程可以同时读写同一个数据库
+func OpenSQLite(path string) (*sql.DB, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("创建数据库目录失败: %w", err)
+	}
+
+	dsn := path + "?_pragma=busy_timeout(10000)&_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("打开数据库失败: %w", err)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("打开数据库失败: %w", err)
+	}
+	return db, nil
+}
+
+// FormatTime 把时间转换为数据库中的格式，零值返回 nil（写入 NULL）
+func FormatTime(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UTC().Format(TimeLayout)
+}
+
+// ParseTime 解析数据库中的时间，NULL 返回零值
+func ParseTime(value sql.NullString) (time.Time, error) {
+	if !value.Valid || value.String == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.ParseInLocation(TimeLayout, value.String, time.UTC)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("解析时间失败: %w", err)
+	}
+	return t, nil
+}
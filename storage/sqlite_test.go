@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestOpenSQLite(t *testing.T) {
+	db, err := OpenSQLite(filepath.Join(t.TempDir(), "data", "downloads.db"))
+	if err != nil {
+		t.Fatalf("OpenSQLite() error = %v", err)
+	}
+	defer db.Close()
+
+	var mode string
+	if err := db.QueryRow("PRAGMA journal_mode").Scan(&mode); err != nil {
+		t.Fatalf("query journal_mode: %v", err)
+	}
+	if mode != "wal" {
+		t.Errorf("journal_mode = %q, want %q", mode, "wal")
+	}
+}
+
+func TestFormatParseTime(t *testing.T) {
+	want := time.Date(2024, 5, 1, 12, 30, 45, 123000000, time.UTC)
+	formatted := FormatTime(want.In(time.FixedZone("CST", 8*3600)))
+	if formatted != "2024-05-01 12:30:45.123" {
+		t.Errorf("FormatTime() = %v", formatted)
+	}
+
+	got, err := ParseTime(sql.NullString{String: formatted.(string), Valid: true})
+	if err != nil {
+		t.Fatalf("ParseTime() error = %v", err)
+	}
+	if !got.Equal(want) {
+		t.Errorf("ParseTime() = %v, want %v", got, want)
+	}
+
+	if FormatTime(time.Time{}) != nil {
+		t.Error("FormatTime(zero) should be nil")
+	}
+	if got, _ := ParseTime(sql.NullString{}); !got.IsZero() {
+		t.Error("ParseTime(NULL) should be zero")
+	}
+}
@@ -0,0 +1,197 @@
+package task
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"batch_download_videos/downloader"
+)
+
+// DeadLetter 重试后仍然失败的URL，retry-failed 命令按记录中的选项重新排队
+type DeadLetter struct {
+	URL        string             `json:"url"`
+	OutputDir  string             `json:"output_dir"`
+	Resolution string             `json:"resolution"`
+	Options    downloader.Options `json:"options"`
+	VideoID    string             `json:"video_id,omitempty"`
+	Title      string             `json:"title,omitempty"`
+	// ErrorClass 错误类别名称（downloader.ErrorClassName），例如 rate_limited
+	ErrorClass string `json:"error_class"`
+	Error      string `json:"error"`
+	// Attempts 放弃前的总尝试次数，包括下载器内部的重试和任务重试
+	Attempts int `json:"attempts"`
+	// Stderr 最后一次失败时 yt-dlp 错误输出的摘要
+	Stderr   string    `json:"stderr,omitempty"`
+	FailedAt time.Time `json:"failed_at"`
+}
+
+// key 同一URL的音频和视频下载分别记录
+func (letter DeadLetter) key() string {
+	if letter.Options.AudioOnly {
+		return letter.URL + " audio"
+	}
+	return letter.URL
+}
+
+// DeadLetterStore 失败URL的存储后端
+type DeadLetterStore interface {
+	// Add 记录失败的URL，已有的同一URL的记录被替换
+	Add(letter DeadLetter) error
+	// List 返回错误类别属于 classes 的记录，classes 为空时返回全部，按失败时间排序
+	List(classes ...string) ([]DeadLetter, error)
+	// Remove 删除URL的记录，audio 区分音频和视频下载，记录不存在时不报错
+	Remove(url string, audio bool) error
+}
+
+// newDeadLetter 根据失败的任务生成失败记录
+func newDeadLetter(task *DownloadTask, err error, videoID, title string) DeadLetter {
+	task.Mutex.Lock()
+	defer task.Mutex.Unlock()
+
+	letter := DeadLetter{
+		URL:        task.URL,
+		OutputDir:  task.OutputDir,
+		Resolution: task.Resolution,
+		Options:    task.Options,
+		VideoID:    videoID,
+		Title:      title,
+		ErrorClass: downloader.ErrorClassName(err),
+		Attempts:   task.RetryCount + 1,
+		Stderr:     downloader.StderrExcerpt(err),
+		FailedAt:   time.Now(),
+	}
+	if err != nil {
+		letter.Error = err.Error()
+	}
+	return letter
+}
+
+// FileDeadLetterStore 把失败记录保存为 JSON 文件，每次修改都通过临时文件原子地替换整个文件
+type FileDeadLetterStore struct {
+	path  string
+	mutex sync.Mutex
+}
+
+// NewFileDeadLetterStore 创建以 path 为失败记录文件的存储后端
+func NewFileDeadLetterStore(path string) *FileDeadLetterStore {
+	return &FileDeadLetterStore{path: path}
+}
+
+// Add 记录失败的URL，已有的同一URL的记录被替换
+func (fs *FileDeadLetterStore) Add(letter DeadLetter) error {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	letters, err := fs.load()
+	if err != nil {
+		return err
+	}
+	letters = slices.DeleteFunc(letters, func(existing DeadLetter) bool {
+		return existing.key() == letter.key()
+	})
+	return fs.save(append(letters, letter))
+}
+
+// List 返回错误类别属于 classes 的记录，classes 为空时返回全部，按失败时间排序
+func (fs *FileDeadLetterStore) List(classes ...string) ([]DeadLetter, error) {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	letters, err := fs.load()
+	if err != nil {
+		return nil, err
+	}
+	if len(classes) > 0 {
+		letters = slices.DeleteFunc(letters, func(letter DeadLetter) bool {
+			return !slices.Contains(classes, letter.ErrorClass)
+		})
+	}
+	sort.SliceStable(letters, func(i, j int) bool {
+		return letters[i].FailedAt.Before(letters[j].FailedAt)
+	})
+	return letters, nil
+}
+
+// Remove 删除URL的记录，文件中没有该记录时不改写文件
+func (fs *FileDeadLetterStore) Remove(url string, audio bool) error {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	letters, err := fs.load()
+	if err != nil {
+		return err
+	}
+	key := DeadLetter{URL: url, Options: downloader.Options{AudioOnly: audio}}.key()
+	remaining := slices.DeleteFunc(slices.Clone(letters), func(letter DeadLetter) bool {
+		return letter.key() == key
+	})
+	if len(remaining) == len(letters) {
+		return nil
+	}
+	return fs.save(remaining)
+}
+
+// load 读取失败记录文件，文件不存在时返回空列表
+func (fs *FileDeadLetterStore) load() ([]DeadLetter, error) {
+	data, err := os.ReadFile(fs.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("读取失败记录失败: %w", err)
+	}
+	var letters []DeadLetter
+	if err := json.Unmarshal(data, &letters); err != nil {
+		return nil, fmt.Errorf("解析失败记录失败: %w", err)
+	}
+	return letters, nil
+}
+
+// save 把失败记录写入文件
+func (fs *FileDeadLetterStore) save(letters []DeadLetter) error {
+	if err := os.MkdirAll(filepath.Dir(fs.path), 0755); err != nil {
+		return fmt.Errorf("创建目录失败: %w", err)
+	}
+	if letters == nil {
+		letters = []DeadLetter{}
+	}
+	data, err := json.MarshalIndent(letters, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化失败记录失败: %w", err)
+	}
+	if err := writeFileAtomic(fs.path, data); err != nil {
+		return fmt.Errorf("写入失败记录失败: %w", err)
+	}
+	return nil
+}
+
+// newCollectionDeadLetter 频道/播放列表中有视频下载失败时，记录整个频道/播放列表，重新下载时已下载的视频会被跳过
+// 错误类别取第一个失败视频的类别，错误输出摘要为每个失败视频的ID和错误信息
+func newCollectionDeadLetter(task *DownloadTask, result *downloader.DownloadResult) DeadLetter {
+	var failed []*downloader.DownloadResult
+	for _, item := range result.Items {
+		if !item.Success && !errors.Is(item.Error, downloader.ErrAlreadyDownloaded) {
+			failed = append(failed, item)
+		}
+	}
+
+	letter := newDeadLetter(task, result.Error, "", result.Title)
+	if len(failed) == 0 {
+		return letter
+	}
+	letter.ErrorClass = downloader.ErrorClassName(failed[0].Error)
+	lines := make([]string, 0, len(failed))
+	for _, item := range failed {
+		lines = append(lines, fmt.Sprintf("%s: %v", item.VideoID, item.Error))
+	}
+	letter.Stderr = strings.Join(lines, "\n")
+	return letter
+}
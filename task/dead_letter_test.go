@@ -0,0 +1,122 @@
+package task
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"batch_download_videos/downloader"
+	"batch_download_videos/storage"
+)
+
+func testDeadLetterStore(t *testing.T, store DeadLetterStore) {
+	t.Helper()
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	letters := []DeadLetter{
+		{URL: "https://example.com/a", OutputDir: "Output", Resolution: "720", ErrorClass: "network", Attempts: 3, FailedAt: now.Add(time.Minute)},
+		{URL: "https://example.com/b", ErrorClass: "unavailable", Attempts: 1, Stderr: "ERROR: Video unavailable", FailedAt: now},
+		{URL: "https://example.com/a", Options: downloader.Options{AudioOnly: true}, ErrorClass: "rate_limited", Attempts: 2, FailedAt: now.Add(2 * time.Minute)},
+	}
+	for _, letter := range letters {
+		if err := store.Add(letter); err != nil {
+			t.Fatalf("Add() error = %v", err)
+		}
+	}
+
+	all, err := store.List()
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(all) != 3 || all[0].URL != "https://example.com/b" || all[0].Stderr != "ERROR: Video unavailable" || !all[2].Options.AudioOnly {
+		t.Errorf("List() = %+v, want 3 letters ordered by failure time", all)
+	}
+
+	// 同一URL再次失败时替换原有记录
+	updated := letters[0]
+	updated.ErrorClass, updated.Attempts = "rate_limited", 4
+	if err := store.Add(updated); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	limited, err := store.List("rate_limited", "geo_blocked")
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(limited) != 2 || limited[0].Attempts != 4 || limited[0].Resolution != "720" {
+		t.Errorf("List(rate_limited) = %+v, want the updated video letter and the audio letter", limited)
+	}
+
+	if err := store.Remove("https://example.com/a", false); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if err := store.Remove("https://example.com/missing", false); err != nil {
+		t.Fatalf("Remove() missing letter error = %v", err)
+	}
+	all, _ = store.List()
+	if len(all) != 2 || all[1].URL != "https://example.com/a" || !all[1].Options.AudioOnly {
+		t.Errorf("List() after Remove() = %+v, want only the audio letter left for the URL", all)
+	}
+}
+
+func TestFileDeadLetterStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "failed_downloads.json")
+	testDeadLetterStore(t, NewFileDeadLetterStore(path))
+
+	// 重新打开文件后记录仍然存在
+	letters, err := NewFileDeadLetterStore(path).List()
+	if err != nil || len(letters) != 2 {
+		t.Errorf("List() after reopen = %+v, %v, want 2 letters", letters, err)
+	}
+}
+
+func TestSQLiteDeadLetterStore(t *testing.T) {
+	db, err := storage.OpenSQLite(filepath.Join(t.TempDir(), "downloads.db"))
+	if err != nil {
+		t.Fatalf("OpenSQLite() error = %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	store, err := NewSQLiteDeadLetterStore(db)
+	if err != nil {
+		t.Fatalf("NewSQLiteDeadLetterStore() error = %v", err)
+	}
+	testDeadLetterStore(t, store)
+}
+
+func TestSchedulerRecordsDeadLetters(t *testing.T) {
+	taskManager := NewTaskManager(1, "")
+	store := NewFileDeadLetterStore(filepath.Join(t.TempDir(), "failed_downloads.json"))
+	sched := NewScheduler(taskManager, &flakyDownloader{})
+	sched.SetDeadLetters(store)
+	sched.Enqueue([]string{"https://example.com/flaky", "https://example.com/private"}, "Output", "720")
+	sched.Run(t.Context())
+
+	letters, err := store.List()
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	classes := map[string]string{}
+	for _, letter := range letters {
+		classes[letter.URL] = letter.ErrorClass
+		if letter.Attempts != 1 || letter.OutputDir != "Output" || letter.Resolution != "720" || letter.Error == "" {
+			t.Errorf("Dead letter = %+v, want one attempt with the task's output dir and resolution", letter)
+		}
+	}
+	if want := map[string]string{"https://example.com/flaky": "network", "https://example.com/private": "unavailable"}; fmt.Sprint(classes) != fmt.Sprint(want) {
+		t.Errorf("Dead letter classes = %v, want %v", classes, want)
+	}
+
+	// 按错误类别重新排队，下载成功后删除记录
+	network, _ := store.List("network")
+	for _, letter := range network {
+		sched.EnqueueWithOptions(letter.URL, letter.OutputDir, letter.Resolution, letter.Options)
+	}
+	stats := sched.Run(t.Context())
+	if stats.Total != 1 || stats.Success != 1 {
+		t.Errorf("Run() stats = %+v, want the network failure retried successfully", stats)
+	}
+	letters, _ = store.List()
+	if len(letters) != 1 || letters[0].URL != "https://example.com/private" {
+		t.Errorf("Dead letters after retry = %+v, want only the unavailable video", letters)
+	}
+}
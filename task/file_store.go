@@ -0,0 +1,119 @@
+package task
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// FileStore 基于 JSON 文件的存储后端（默认），每次保存都通过临时文件原子地替换整个文件
+type FileStore struct {
+	path string
+}
+
+// NewFileStore 创建以 path 为任务文件的存储后端
+func NewFileStore(path string) *FileStore {
+	return &FileStore{path: path}
+}
+
+// Load 读取任务文件，文件不存在时返回空状态
+func (fs *FileStore) Load() (*State, error) {
+	state := &State{Tasks: make(map[string]*DownloadTask)}
+
+	data, err := os.ReadFile(fs.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return state, nil
+		}
+		return nil, fmt.Errorf("读取任务数据失败: %w", err)
+	}
+
+	// 逐个解析任务，单个任务损坏不影响其他任务
+	var raw struct {
+		Tasks      map[string]json.RawMessage `json:"tasks"`
+		TaskQueue  []string                   `json:"task_queue"`
+		Processing []string                   `json:"processing"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("解析任务数据失败: %w", err)
+	}
+
+	for id, taskData := range raw.Tasks {
+		var task DownloadTask
+		if err := json.Unmarshal(taskData, &task); err == nil {
+			state.Tasks[id] = &task
+		}
+	}
+	state.TaskQueue = raw.TaskQueue
+	state.Processing = raw.Processing
+
+	return state, nil
+}
+
+// Save 把全部任务状态写入任务文件
+func (fs *FileStore) Save(state *State) error {
+	// 确保持久化文件目录存在
+	if err := os.MkdirAll(filepath.Dir(fs.path), 0755); err != nil {
+		return fmt.Errorf("创建目录失败: %w", err)
+	}
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化任务数据失败: %w", err)
+	}
+
+	if err := writeFileAtomic(fs.path, data); err != nil {
+		return fmt.Errorf("写入任务数据失败: %w", err)
+	}
+
+	return nil
+}
+
+// writeFileAtomic 把数据写入同一目录下的临时文件，同步到磁盘后原子地重命名为 path
+// 写入过程中程序崩溃或被中断时，原文件保持不变
+func writeFileAtomic(path string, data []byte) error {
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpPath := file.Name()
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Chmod(tmpPath, 0644); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+// Query 读取任务文件后按条件过滤
+func (fs *FileStore) Query(filter Filter) ([]*DownloadTask, error) {
+	state, err := fs.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	tasks := make([]*DownloadTask, 0, len(state.Tasks))
+	for _, task := range state.Tasks {
+		tasks = append(tasks, task)
+	}
+	return filter.apply(tasks), nil
+}
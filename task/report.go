@@ -0,0 +1,206 @@
+package task
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"batch_download_videos/downloader"
+)
+
+// 报告中每个URL的状态
+const (
+	ReportStatusSuccess = "success"
+	ReportStatusSkipped = "skipped"
+	ReportStatusFailed  = "failed"
+)
+
+// ReportEntry 一次运行中一个URL（或频道/播放列表中的一个视频）的下载结果
+// 频道/播放列表由 yt-dlp 整体下载时每个视频各一条，URL 为频道/播放列表的URL
+type ReportEntry struct {
+	URL      string `json:"url"`
+	Status   string `json:"status"`
+	VideoID  string `json:"video_id,omitempty"`
+	Title    string `json:"title,omitempty"`
+	FilePath string `json:"file_path,omitempty"`
+	Bytes    int64  `json:"bytes"`
+	// Duration 任务执行的总时长，包括任务重试的每次执行；频道/播放列表中的视频不单独计时，为 0
+	Duration time.Duration `json:"-"`
+	Retries  int           `json:"retries"`
+	// ErrorClass 错误类别名称（downloader.ErrorClassName），只有失败时才有
+	ErrorClass string `json:"error_class,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// MarshalJSON 时长以秒为单位输出
+func (e ReportEntry) MarshalJSON() ([]byte, error) {
+	type entry ReportEntry
+	return json.Marshal(struct {
+		entry
+		DurationSeconds float64 `json:"duration_seconds"`
+	}{entry(e), e.Duration.Seconds()})
+}
+
+// RunReport 一次运行的下载报告
+type RunReport struct {
+	StartedAt  time.Time     `json:"started_at"`
+	FinishedAt time.Time     `json:"finished_at"`
+	Success    int           `json:"success"`
+	Fail       int           `json:"fail"`
+	Skip       int           `json:"skip"`
+	Total      int           `json:"total"`
+	Entries    []ReportEntry `json:"urls"`
+}
+
+// WriteFile 把报告写入 path，扩展名为 .xml 时写 JUnit XML 格式，否则写 JSON 格式
+func (r RunReport) WriteFile(path string) error {
+	var data []byte
+	var err error
+	if strings.EqualFold(filepath.Ext(path), ".xml") {
+		data, err = r.junit()
+	} else {
+		data, err = r.json()
+	}
+	if err != nil {
+		return fmt.Errorf("生成报告失败: %w", err)
+	}
+
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("创建目录失败: %w", err)
+		}
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("写入报告失败: %w", err)
+	}
+	return nil
+}
+
+// json 生成 JSON 格式的报告
+func (r RunReport) json() ([]byte, error) {
+	if r.Entries == nil {
+		r.Entries = []ReportEntry{}
+	}
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// junitTestSuites 等 JUnit XML 报告的元素，每个URL是一个 testcase，失败为 failure，跳过为 skipped
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr,omitempty"`
+}
+
+// junit 生成 JUnit XML 格式的报告
+func (r RunReport) junit() ([]byte, error) {
+	elapsed := junitTime(r.FinishedAt.Sub(r.StartedAt))
+	suite := junitTestSuite{
+		Name:      "batch_download",
+		Tests:     len(r.Entries),
+		Time:      elapsed,
+		Timestamp: r.StartedAt.Format("2006-01-02T15:04:05"),
+	}
+	for _, entry := range r.Entries {
+		name := entry.URL
+		if entry.VideoID != "" {
+			name = fmt.Sprintf("%s (%s)", entry.URL, entry.VideoID)
+		}
+		testCase := junitTestCase{
+			Name:      name,
+			ClassName: "batch_download",
+			Time:      junitTime(entry.Duration),
+		}
+		switch entry.Status {
+		case ReportStatusFailed:
+			suite.Failures++
+			testCase.Failure = &junitMessage{Message: entry.Error, Type: entry.ErrorClass}
+		case ReportStatusSkipped:
+			suite.Skipped++
+			testCase.Skipped = &junitMessage{Message: "视频已下载"}
+		}
+
+		var out []string
+		if entry.Title != "" {
+			out = append(out, "标题: "+entry.Title)
+		}
+		if entry.FilePath != "" {
+			out = append(out, fmt.Sprintf("文件: %s (%d 字节)", entry.FilePath, entry.Bytes))
+		}
+		if entry.Retries > 0 {
+			out = append(out, fmt.Sprintf("重试: %d", entry.Retries))
+		}
+		testCase.SystemOut = strings.Join(out, "\n")
+		suite.Cases = append(suite.Cases, testCase)
+	}
+
+	data, err := xml.MarshalIndent(junitTestSuites{
+		Name:     "batch_download",
+		Tests:    suite.Tests,
+		Failures: suite.Failures,
+		Skipped:  suite.Skipped,
+		Time:     elapsed,
+		Suites:   []junitTestSuite{suite},
+	}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(data, '\n')...), nil
+}
+
+// junitTime 把时长格式化为 JUnit 报告使用的秒数
+func junitTime(d time.Duration) string {
+	return fmt.Sprintf("%.3f", max(d, 0).Seconds())
+}
+
+// newReportEntry 根据下载结果生成报告条目，result 可以为 nil，只有失败时记录错误
+func newReportEntry(url, status string, result *downloader.DownloadResult, err error) ReportEntry {
+	entry := ReportEntry{URL: url, Status: status}
+	if result != nil {
+		entry.VideoID = result.VideoID
+		entry.Title = result.Title
+		entry.FilePath = result.FilePath
+		entry.Bytes = result.FileSize
+		entry.Retries = result.RetryCount
+	}
+	if status == ReportStatusFailed && err != nil {
+		entry.ErrorClass = downloader.ErrorClassName(err)
+		entry.Error = err.Error()
+	}
+	return entry
+}
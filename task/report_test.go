@@ -0,0 +1,120 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSchedulerReport(t *testing.T) {
+	taskManager := NewTaskManager(1, "")
+	sched := NewScheduler(taskManager, &channelDownloader{})
+	sched.Enqueue([]string{"https://example.com/channel", "https://example.com/ok1", "https://example.com/fail"}, "Output", "720")
+	sched.Run(context.Background())
+
+	report := sched.Report()
+	if report.StartedAt.IsZero() || report.FinishedAt.Before(report.StartedAt) {
+		t.Errorf("Report() times = %v - %v", report.StartedAt, report.FinishedAt)
+	}
+	if report.Total != 6 || report.Success != 3 || report.Skip != 1 || report.Fail != 2 || len(report.Entries) != 6 {
+		t.Fatalf("Report() = %+v, want one entry per video and URL", report)
+	}
+
+	statuses := map[string]int{}
+	for _, entry := range report.Entries {
+		statuses[entry.Status]++
+		switch {
+		case entry.URL == "https://example.com/ok1":
+			if entry.Bytes != 1024 || entry.VideoID != "https://example.com/ok1" {
+				t.Errorf("ok1 entry = %+v, want downloaded video with 1024 bytes", entry)
+			}
+		case entry.URL == "https://example.com/fail":
+			if entry.Status != ReportStatusFailed || entry.ErrorClass != "unknown" || entry.Error != "network error" {
+				t.Errorf("fail entry = %+v, want failed with error class", entry)
+			}
+		case entry.VideoID == "v4":
+			if entry.URL != "https://example.com/channel" || entry.Status != ReportStatusFailed || entry.Error != "Private video" {
+				t.Errorf("v4 entry = %+v, want failed channel video", entry)
+			}
+		}
+	}
+	if statuses[ReportStatusSuccess] != 3 || statuses[ReportStatusSkipped] != 1 || statuses[ReportStatusFailed] != 2 {
+		t.Errorf("Report() statuses = %v", statuses)
+	}
+}
+
+func TestRunReportWriteFile(t *testing.T) {
+	started := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	report := RunReport{
+		StartedAt:  started,
+		FinishedAt: started.Add(90 * time.Second),
+		Success:    1,
+		Fail:       1,
+		Skip:       1,
+		Total:      3,
+		Entries: []ReportEntry{
+			{URL: "https://example.com/a", Status: ReportStatusSuccess, VideoID: "a", FilePath: "Output/a.mp4", Bytes: 2048, Duration: 1500 * time.Millisecond, Retries: 1},
+			{URL: "https://example.com/b", Status: ReportStatusFailed, ErrorClass: "geo_blocked", Error: "视频在当前地区不可用", Duration: time.Second},
+			{URL: "https://example.com/c", Status: ReportStatusSkipped, VideoID: "c"},
+		},
+	}
+	dir := t.TempDir()
+
+	jsonPath := filepath.Join(dir, "report.json")
+	if err := report.WriteFile(jsonPath); err != nil {
+		t.Fatalf("WriteFile(json) error = %v", err)
+	}
+	data, _ := os.ReadFile(jsonPath)
+	var decoded struct {
+		StartedAt time.Time `json:"started_at"`
+		Fail      int       `json:"fail"`
+		URLs      []struct {
+			URL             string  `json:"url"`
+			Status          string  `json:"status"`
+			FilePath        string  `json:"file_path"`
+			Bytes           int64   `json:"bytes"`
+			DurationSeconds float64 `json:"duration_seconds"`
+			Retries         int     `json:"retries"`
+			ErrorClass      string  `json:"error_class"`
+		} `json:"urls"`
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v\n%s", err, data)
+	}
+	if !decoded.StartedAt.Equal(started) || decoded.Fail != 1 || len(decoded.URLs) != 3 {
+		t.Errorf("JSON report = %+v", decoded)
+	}
+	if first := decoded.URLs[0]; first.FilePath != "Output/a.mp4" || first.Bytes != 2048 || first.DurationSeconds != 1.5 || first.Retries != 1 {
+		t.Errorf("JSON entry = %+v", first)
+	}
+	if decoded.URLs[1].ErrorClass != "geo_blocked" {
+		t.Errorf("JSON failed entry = %+v, want error class", decoded.URLs[1])
+	}
+
+	xmlPath := filepath.Join(dir, "junit", "report.xml")
+	if err := report.WriteFile(xmlPath); err != nil {
+		t.Fatalf("WriteFile(xml) error = %v", err)
+	}
+	data, _ = os.ReadFile(xmlPath)
+	var suites junitTestSuites
+	if err := xml.Unmarshal(data, &suites); err != nil {
+		t.Fatalf("xml.Unmarshal() error = %v\n%s", err, data)
+	}
+	if suites.Tests != 3 || suites.Failures != 1 || suites.Skipped != 1 || suites.Time != "90.000" || len(suites.Suites) != 1 {
+		t.Fatalf("JUnit report = %+v", suites)
+	}
+	cases := suites.Suites[0].Cases
+	if len(cases) != 3 || cases[0].Name != "https://example.com/a (a)" || cases[0].Time != "1.500" {
+		t.Errorf("JUnit test cases = %+v", cases)
+	}
+	if failure := cases[1].Failure; failure == nil || failure.Type != "geo_blocked" || failure.Message != "视频在当前地区不可用" {
+		t.Errorf("JUnit failure = %+v", failure)
+	}
+	if cases[2].Skipped == nil || cases[0].Failure != nil {
+		t.Errorf("JUnit test cases = %+v, want the third skipped and the first passed", cases)
+	}
+}
@@ -0,0 +1,347 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"batch_download_videos/downloader"
+	"batch_download_videos/logger"
+	"batch_download_videos/utils"
+)
+
+// SchedulerStats 定义调度器的运行统计
+type SchedulerStats struct {
+	Success int
+	Fail    int
+	Skip    int
+	Total   int
+}
+
+// Completed 返回已结束（成功、失败或跳过）的任务数
+func (s SchedulerStats) Completed() int {
+	return s.Success + s.Fail + s.Skip
+}
+
+// Scheduler 从 TaskManager 队列中取任务，并用最多 MaxConcurrent 个 worker 通过下载器执行
+type Scheduler struct {
+	manager    *TaskManager
+	downloader downloader.Downloader
+	stats      SchedulerStats
+	statsMutex sync.Mutex
+	// report 本次运行的报告，elapsed 为每个任务累计的执行时长，都由 statsMutex 保护
+	report  RunReport
+	elapsed map[string]time.Duration
+	// deadLetters 记录最终失败的URL，为 nil 时不记录
+	deadLetters DeadLetterStore
+}
+
+// NewScheduler 创建新的调度器
+func NewScheduler(manager *TaskManager, dl downloader.Downloader) *Scheduler {
+	return &Scheduler{
+		manager:    manager,
+		downloader: dl,
+	}
+}
+
+// SetDeadLetters 设置记录最终失败URL的存储后端，下载成功或跳过的URL会从中删除
+func (s *Scheduler) SetDeadLetters(store DeadLetterStore) {
+	s.deadLetters = store
+}
+
+// Manager 返回调度器使用的任务管理器
+func (s *Scheduler) Manager() *TaskManager {
+	return s.manager
+}
+
+// Enqueue 将URL列表加入任务队列，返回新加入（或重新排队）的任务数
+func (s *Scheduler) Enqueue(urls []string, outputDir, resolution string) int {
+	added := 0
+	for _, url := range urls {
+		if _, ok := s.manager.EnqueueURL(url, outputDir, resolution); ok {
+			added++
+		}
+	}
+	return added
+}
+
+// EnqueueWithOptions 将带下载选项的URL加入任务队列，返回是否新加入（或重新排队）
+func (s *Scheduler) EnqueueWithOptions(url, outputDir, resolution string, opts downloader.Options) bool {
+	_, ok := s.manager.EnqueueURLWithOptions(url, outputDir, resolution, opts)
+	return ok
+}
+
+// Stats 返回当前的运行统计
+func (s *Scheduler) Stats() SchedulerStats {
+	s.statsMutex.Lock()
+	defer s.statsMutex.Unlock()
+
+	return s.stats
+}
+
+// Run 执行队列中的所有任务，直到队列为空或 ctx 被取消
+// ctx 被取消时，正在执行的任务会被中止并放回队列，下次运行时继续
+func (s *Scheduler) Run(ctx context.Context) SchedulerStats {
+	workers := s.manager.MaxConcurrent
+	if workers <= 0 {
+		workers = 1
+	}
+
+	s.statsMutex.Lock()
+	s.stats = SchedulerStats{Total: len(s.manager.GetPendingTasks())}
+	s.report = RunReport{StartedAt: time.Now()}
+	s.elapsed = make(map[string]time.Duration)
+	s.statsMutex.Unlock()
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.worker(ctx)
+		}()
+	}
+	wg.Wait()
+
+	s.statsMutex.Lock()
+	s.report.FinishedAt = time.Now()
+	s.statsMutex.Unlock()
+	return s.Stats()
+}
+
+// Report 返回最近一次运行的报告，包括每个已结束的URL的结果
+// 因程序退出而放回队列的任务不在报告中
+func (s *Scheduler) Report() RunReport {
+	s.statsMutex.Lock()
+	defer s.statsMutex.Unlock()
+
+	report := s.report
+	report.Success, report.Fail, report.Skip, report.Total = s.stats.Success, s.stats.Fail, s.stats.Skip, s.stats.Total
+	report.Entries = slices.Clone(s.report.Entries)
+	return report
+}
+
+// worker 循环领取并执行任务
+func (s *Scheduler) worker(ctx context.Context) {
+	for ctx.Err() == nil {
+		task, err := s.manager.NextTaskContext(ctx)
+		if err != nil {
+			if errors.Is(err, ErrNoPendingTask) {
+				// 其他 worker 正在执行的任务可能是播放列表/频道，展开后会加入新的任务
+				if len(s.manager.GetProcessingTasks()) == 0 {
+					return
+				}
+				if sleepErr := utils.SleepContext(ctx, 500*time.Millisecond); sleepErr != nil {
+					return
+				}
+				continue
+			}
+			if errors.Is(err, ErrMaxConcurrent) || errors.Is(err, ErrRetryWaiting) {
+				// 其他 worker 占满了并发数，或队列中的任务都在等待重试，稍后再试
+				if sleepErr := utils.SleepContext(ctx, 500*time.Millisecond); sleepErr != nil {
+					return
+				}
+				continue
+			}
+			// 队列中的任务记录已丢失，NextTask 已将其移除，继续领取下一个
+			logger.GetLogger().Warn("领取任务失败: %v", err)
+			continue
+		}
+
+		s.execute(ctx, task)
+	}
+}
+
+// execute 执行单个任务并根据结果更新任务状态
+func (s *Scheduler) execute(runCtx context.Context, task *DownloadTask) {
+	logger.GetLogger().Debug("开始下载: %s (任务: %s)", task.URL, task.ID)
+	started := time.Now()
+
+	// 传入任务的下载选项，下载器上报的进度写入任务状态
+	ctx := downloader.WithOptions(task.Ctx, task.Options)
+	ctx = downloader.WithProgress(ctx, func(progress downloader.DownloadProgress) {
+		s.manager.UpdateTaskProgress(task.ID, progress.Progress, progress.Speed, progress.ETA)
+	})
+
+	var result *downloader.DownloadResult
+	var err error
+	expanded := false
+	if expander, ok := s.downloader.(downloader.Expander); ok {
+		expanded, err = s.expand(ctx, expander, task)
+	}
+	// 展开出错（例如下载被取消）时不再下载整个播放列表/频道
+	if !expanded && err == nil {
+		result, err = s.downloader.DownloadContext(ctx, task.URL, task.OutputDir, task.Resolution)
+	}
+
+	if task.Ctx.Err() != nil {
+		if runCtx.Err() != nil {
+			// 程序正在退出，归还任务，下次运行时继续
+			if requeueErr := s.manager.ReturnTask(task.ID); requeueErr != nil {
+				logger.GetLogger().Warn("归还任务失败: %v", requeueErr)
+			}
+			return
+		}
+		// 任务被 PauseTask/CancelTask 中止，状态已由对应方法更新
+		logger.GetLogger().Info("任务已中止: %s", task.ID)
+		return
+	}
+
+	// 累计下载器内部的重试次数，任务整体重试的次数由 RetryTask 累加
+	retries := 0
+	if result != nil {
+		retries = result.RetryCount
+	} else if err != nil {
+		retries = downloader.Attempts(err) - 1
+	}
+	task.Mutex.Lock()
+	task.RetryCount += retries
+	task.Mutex.Unlock()
+	s.count(func(*SchedulerStats) { s.elapsed[task.ID] += time.Since(started) })
+
+	switch {
+	case expanded && err == nil:
+		// 播放列表/频道本身不计入统计，展开得到的视频已计入总数
+	case err != nil:
+		s.fail(task, err, "", task.URL, retries)
+	case result == nil:
+		s.manager.CompleteTask(task.ID, nil)
+		s.count(func(stats *SchedulerStats) { stats.Success++ })
+		s.record(task, ReportStatusSuccess, nil, nil)
+	case len(result.Items) > 0:
+		s.recordItems(task, result)
+	case result.Success:
+		s.manager.CompleteTask(task.ID, result)
+		s.count(func(stats *SchedulerStats) { stats.Success++ })
+		s.record(task, ReportStatusSuccess, result, nil)
+		logger.GetLogger().DownloadSuccess(result.VideoID, result.Title, result.RetryCount, result.FileSize)
+	case errors.Is(result.Error, downloader.ErrAlreadyDownloaded):
+		s.manager.CompleteTask(task.ID, result)
+		s.count(func(stats *SchedulerStats) { stats.Skip++ })
+		s.record(task, ReportStatusSkipped, result, nil)
+		logger.GetLogger().DownloadSkip(result.VideoID, result.Title)
+	default:
+		s.fail(task, result.Error, result.VideoID, result.Title, result.RetryCount)
+	}
+
+	// 下载成功或跳过的URL不再保留失败记录
+	task.Mutex.Lock()
+	completed := task.Status == TaskStatusCompleted
+	task.Mutex.Unlock()
+	if completed && s.deadLetters != nil {
+		if err := s.deadLetters.Remove(task.URL, task.Options.AudioOnly); err != nil {
+			logger.GetLogger().Warn("删除失败记录失败: %v", err)
+		}
+	}
+}
+
+// addDeadLetter 记录最终失败的URL
+func (s *Scheduler) addDeadLetter(letter DeadLetter) {
+	if s.deadLetters == nil {
+		return
+	}
+	if err := s.deadLetters.Add(letter); err != nil {
+		logger.GetLogger().Warn("记录失败URL失败: %v", err)
+	}
+}
+
+// fail 处理失败的任务：错误可以按任务重试策略重试时任务重新排队，暂不计入统计；否则标记为失败
+func (s *Scheduler) fail(task *DownloadTask, err error, videoID, title string, retryCount int) {
+	if s.manager.RetryTask(task.ID, err) {
+		logger.GetLogger().Warn("下载失败，稍后重试: %s, 错误: %v", task.URL, err)
+		return
+	}
+	s.manager.FailTask(task.ID, err)
+	s.count(func(stats *SchedulerStats) { stats.Fail++ })
+	s.record(task, ReportStatusFailed, &downloader.DownloadResult{VideoID: videoID, Title: title}, err)
+	logger.GetLogger().DownloadFail(videoID, title, err, retryCount)
+	s.addDeadLetter(newDeadLetter(task, err, videoID, title))
+}
+
+// recordItems 按频道/播放列表中每个视频的结果更新统计和日志，频道/播放列表任务本身不计入统计
+// 有视频下载失败时与单个URL一样按任务重试策略重试，重新排队时这次的结果暂不计入统计（重试时已下载的视频会被跳过）；
+// 不再重试时频道/播放列表任务标记为失败
+func (s *Scheduler) recordItems(task *DownloadTask, result *downloader.DownloadResult) {
+	if !result.Success && s.manager.RetryTask(task.ID, result.Error) {
+		logger.GetLogger().Warn("频道/播放列表有视频下载失败，稍后重试: %s, 错误: %v", task.URL, result.Error)
+		return
+	}
+
+	s.count(func(stats *SchedulerStats) { stats.Total += len(result.Items) - 1 })
+	for _, item := range result.Items {
+		switch {
+		case item.Success:
+			s.count(func(stats *SchedulerStats) { stats.Success++ })
+			s.addEntry(newReportEntry(task.URL, ReportStatusSuccess, item, nil))
+			logger.GetLogger().DownloadSuccess(item.VideoID, item.Title, item.RetryCount, item.FileSize)
+		case errors.Is(item.Error, downloader.ErrAlreadyDownloaded):
+			s.count(func(stats *SchedulerStats) { stats.Skip++ })
+			s.addEntry(newReportEntry(task.URL, ReportStatusSkipped, item, nil))
+			logger.GetLogger().DownloadSkip(item.VideoID, item.Title)
+		default:
+			s.count(func(stats *SchedulerStats) { stats.Fail++ })
+			s.addEntry(newReportEntry(task.URL, ReportStatusFailed, item, item.Error))
+			logger.GetLogger().DownloadFail(item.VideoID, item.Title, item.Error, item.RetryCount)
+		}
+	}
+
+	if result.Success {
+		s.manager.CompleteTask(task.ID, result)
+	} else {
+		s.manager.FailTask(task.ID, result.Error)
+		s.addDeadLetter(newCollectionDeadLetter(task, result))
+	}
+}
+
+// record 把任务的最终结果加入本次运行的报告，重试次数和执行时长按整个任务累计
+func (s *Scheduler) record(task *DownloadTask, status string, result *downloader.DownloadResult, err error) {
+	entry := newReportEntry(task.URL, status, result, err)
+	task.Mutex.Lock()
+	entry.Retries = task.RetryCount
+	task.Mutex.Unlock()
+
+	s.count(func(*SchedulerStats) {
+		entry.Duration = s.elapsed[task.ID]
+		s.report.Entries = append(s.report.Entries, entry)
+	})
+}
+
+// addEntry 把频道/播放列表中一个视频的结果加入本次运行的报告
+func (s *Scheduler) addEntry(entry ReportEntry) {
+	s.count(func(*SchedulerStats) { s.report.Entries = append(s.report.Entries, entry) })
+}
+
+// expand 把播放列表/频道任务展开为单个视频任务，返回任务是否由下载器展开
+// 展开成功时播放列表/频道任务标记为完成，每个视频作为单独的任务加入队列，分别检查索引、重试和记录结果
+func (s *Scheduler) expand(ctx context.Context, expander downloader.Expander, task *DownloadTask) (bool, error) {
+	items, ok, err := expander.ExpandContext(ctx, task.URL)
+	if !ok || err != nil {
+		return ok, err
+	}
+
+	added := 0
+	for _, item := range items {
+		if s.EnqueueWithOptions(item.URL, task.OutputDir, task.Resolution, task.Options) {
+			added++
+		}
+	}
+	s.count(func(stats *SchedulerStats) { stats.Total += added - 1 })
+
+	s.manager.CompleteTask(task.ID, &downloader.DownloadResult{
+		Success: true,
+		Title:   fmt.Sprintf("播放列表/频道展开为 %d 个视频", len(items)),
+	})
+	logger.GetLogger().Info("播放列表/频道 %s 展开为 %d 个视频，新加入队列 %d 个", task.URL, len(items), added)
+	return true, nil
+}
+
+// count 在锁保护下更新统计
+func (s *Scheduler) count(update func(stats *SchedulerStats)) {
+	s.statsMutex.Lock()
+	defer s.statsMutex.Unlock()
+
+	update(&s.stats)
+}
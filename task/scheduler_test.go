@@ -0,0 +1,306 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"batch_download_videos/downloader"
+)
+
+// fakeDownloader 根据URL返回预设结果的下载器
+type fakeDownloader struct {
+	mutex sync.Mutex
+	calls []string
+}
+
+func (f *fakeDownloader) Name() string                 { return "fake" }
+func (f *fakeDownloader) SupportedPlatforms() []string { return nil }
+func (f *fakeDownloader) GetVideoInfo(url string) (*downloader.VideoInfo, error) {
+	return f.GetVideoInfoContext(context.Background(), url)
+}
+func (f *fakeDownloader) GetVideoInfoContext(ctx context.Context, url string) (*downloader.VideoInfo, error) {
+	return &downloader.VideoInfo{ID: url}, nil
+}
+func (f *fakeDownloader) Download(url, outputDir, resolution string) (*downloader.DownloadResult, error) {
+	return f.DownloadContext(context.Background(), url, outputDir, resolution)
+}
+func (f *fakeDownloader) DownloadContext(ctx context.Context, url, outputDir, resolution string) (*downloader.DownloadResult, error) {
+	f.mutex.Lock()
+	f.calls = append(f.calls, url)
+	f.mutex.Unlock()
+
+	switch {
+	case strings.HasSuffix(url, "fail"):
+		return nil, fmt.Errorf("network error")
+	case strings.HasSuffix(url, "skip"):
+		return &downloader.DownloadResult{VideoID: url, Error: downloader.ErrAlreadyDownloaded}, nil
+	default:
+		return &downloader.DownloadResult{Success: true, VideoID: url, FileSize: 1024}, nil
+	}
+}
+func (f *fakeDownloader) IsDownloaded(videoID string) bool    { return false }
+func (f *fakeDownloader) MarkDownloaded(videoID string) error { return nil }
+
+func TestSchedulerRun(t *testing.T) {
+	taskManager := NewTaskManager(2, "")
+	dl := &fakeDownloader{}
+	sched := NewScheduler(taskManager, dl)
+
+	added := sched.Enqueue([]string{
+		"https://example.com/ok1",
+		"https://example.com/ok2",
+		"https://example.com/fail",
+		"https://example.com/skip",
+		"https://example.com/ok1",
+	}, "Output", "720")
+	if added != 4 {
+		t.Errorf("Enqueue() = %d, want 4", added)
+	}
+
+	stats := sched.Run(context.Background())
+
+	if stats.Total != 4 || stats.Success != 2 || stats.Fail != 1 || stats.Skip != 1 {
+		t.Errorf("Run() stats = %+v, want total=4 success=2 fail=1 skip=1", stats)
+	}
+
+	if len(dl.calls) != 4 {
+		t.Errorf("Downloader called %d times, want 4", len(dl.calls))
+	}
+
+	if len(taskManager.TaskQueue) != 0 || len(taskManager.Processing) != 0 {
+		t.Errorf("Queue = %v, processing = %v, want both empty", taskManager.TaskQueue, taskManager.Processing)
+	}
+
+	if task := taskManager.FindTaskByURL("https://example.com/fail"); task == nil || task.Status != TaskStatusFailed {
+		t.Errorf("Failed URL task = %+v, want status %q", task, TaskStatusFailed)
+	}
+}
+
+func TestSchedulerRunCanceled(t *testing.T) {
+	taskManager := NewTaskManager(1, "")
+	sched := NewScheduler(taskManager, &fakeDownloader{})
+	sched.Enqueue([]string{"https://example.com/ok1", "https://example.com/ok2"}, "Output", "720")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	stats := sched.Run(ctx)
+	if stats.Completed() != 0 {
+		t.Errorf("Run() with canceled ctx completed %d tasks, want 0", stats.Completed())
+	}
+
+	if len(taskManager.TaskQueue) != 2 {
+		t.Errorf("Task queue length = %d, want 2", len(taskManager.TaskQueue))
+	}
+}
+
+// expandingDownloader 把以 /playlist 结尾的URL展开为三个视频
+type expandingDownloader struct {
+	fakeDownloader
+}
+
+func (e *expandingDownloader) ExpandContext(ctx context.Context, url string) ([]downloader.PlaylistItem, bool, error) {
+	if !strings.HasSuffix(url, "/playlist") {
+		return nil, false, nil
+	}
+	return []downloader.PlaylistItem{
+		{ID: "ok1", URL: "https://example.com/ok1"},
+		{ID: "ok2", URL: "https://example.com/ok2"},
+		{ID: "skip", URL: "https://example.com/skip"},
+	}, true, nil
+}
+
+func TestSchedulerRunExpandsPlaylists(t *testing.T) {
+	taskManager := NewTaskManager(2, "")
+	dl := &expandingDownloader{}
+	sched := NewScheduler(taskManager, dl)
+	sched.Enqueue([]string{"https://example.com/playlist", "https://example.com/ok1"}, "Output", "720")
+
+	stats := sched.Run(context.Background())
+
+	if stats.Total != 3 || stats.Success != 2 || stats.Skip != 1 {
+		t.Errorf("Run() stats = %+v, want total=3 success=2 skip=1", stats)
+	}
+	if len(dl.calls) != 3 {
+		t.Errorf("Downloader called %v, want each video once", dl.calls)
+	}
+	if task := taskManager.FindTaskByURL("https://example.com/playlist"); task == nil || task.Status != TaskStatusCompleted {
+		t.Errorf("Playlist task = %+v, want status %q", task, TaskStatusCompleted)
+	}
+}
+
+// cancelingExpander 展开时取消运行，返回 ctx 的错误
+type cancelingExpander struct {
+	fakeDownloader
+	cancel context.CancelFunc
+}
+
+func (e *cancelingExpander) ExpandContext(ctx context.Context, url string) ([]downloader.PlaylistItem, bool, error) {
+	e.cancel()
+	return nil, false, ctx.Err()
+}
+
+func TestSchedulerExpandCanceled(t *testing.T) {
+	taskManager := NewTaskManager(1, "")
+	ctx, cancel := context.WithCancel(context.Background())
+	dl := &cancelingExpander{cancel: cancel}
+	sched := NewScheduler(taskManager, dl)
+	sched.Enqueue([]string{"https://example.com/playlist"}, "Output", "720")
+
+	sched.Run(ctx)
+
+	// 取消后不再下载整个播放列表，任务放回队列
+	if len(dl.calls) != 0 {
+		t.Errorf("Downloader called %v after cancel, want none", dl.calls)
+	}
+	if len(taskManager.TaskQueue) != 1 {
+		t.Errorf("Task queue length = %d, want 1", len(taskManager.TaskQueue))
+	}
+}
+
+// channelDownloader 下载以 /channel 结尾的URL时返回每个视频的结果
+type channelDownloader struct {
+	fakeDownloader
+}
+
+func (c *channelDownloader) DownloadContext(ctx context.Context, url, outputDir, resolution string) (*downloader.DownloadResult, error) {
+	if !strings.HasSuffix(url, "/channel") {
+		return c.fakeDownloader.DownloadContext(ctx, url, outputDir, resolution)
+	}
+	return &downloader.DownloadResult{
+		Success: false,
+		Error:   fmt.Errorf("频道/播放列表中 1/4 个视频下载失败"),
+		Items: []*downloader.DownloadResult{
+			{Success: true, VideoID: "v1"},
+			{Success: true, VideoID: "v2"},
+			{VideoID: "v3", Error: downloader.ErrAlreadyDownloaded},
+			{VideoID: "v4", Error: fmt.Errorf("Private video")},
+		},
+	}, nil
+}
+
+func TestSchedulerRunCountsCollectionItems(t *testing.T) {
+	taskManager := NewTaskManager(1, "")
+	sched := NewScheduler(taskManager, &channelDownloader{})
+	sched.Enqueue([]string{"https://example.com/channel", "https://example.com/ok1"}, "Output", "720")
+
+	stats := sched.Run(context.Background())
+
+	if stats.Total != 5 || stats.Success != 3 || stats.Skip != 1 || stats.Fail != 1 {
+		t.Errorf("Run() stats = %+v, want total=5 success=3 skip=1 fail=1", stats)
+	}
+	if task := taskManager.FindTaskByURL("https://example.com/channel"); task == nil || task.Status != TaskStatusFailed {
+		t.Errorf("Channel task = %+v, want status %q", task, TaskStatusFailed)
+	}
+}
+
+// flakyDownloader 以 /flaky 结尾的URL前两次返回服务器错误，以 /private 结尾的URL总是返回视频不可用
+type flakyDownloader struct {
+	fakeDownloader
+}
+
+func (f *flakyDownloader) DownloadContext(ctx context.Context, url, outputDir, resolution string) (*downloader.DownloadResult, error) {
+	f.mutex.Lock()
+	f.calls = append(f.calls, url)
+	calls := len(f.calls)
+	f.mutex.Unlock()
+
+	switch {
+	case strings.HasSuffix(url, "/private"):
+		return nil, fmt.Errorf("获取视频失败: %w", downloader.ErrUnavailable)
+	case strings.HasSuffix(url, "/flaky") && calls <= 2:
+		return nil, fmt.Errorf("下载失败: %w", &downloader.StatusError{StatusCode: 503})
+	default:
+		return &downloader.DownloadResult{Success: true, VideoID: url, RetryCount: 1}, nil
+	}
+}
+
+func TestSchedulerRunRetriesByErrorClass(t *testing.T) {
+	taskManager := NewTaskManager(1, "")
+	taskManager.SetRetryPolicy(&downloader.RetryPolicy{
+		MaxAttempts: 3,
+		Backoff:     "constant",
+		BaseDelay:   10 * time.Millisecond,
+		RetryOn:     []string{"network"},
+	})
+	dl := &flakyDownloader{}
+	sched := NewScheduler(taskManager, dl)
+	sched.Enqueue([]string{"https://example.com/flaky"}, "Output", "720")
+
+	stats := sched.Run(context.Background())
+	if stats.Total != 1 || stats.Success != 1 || stats.Fail != 0 {
+		t.Errorf("Run() stats = %+v, want total=1 success=1", stats)
+	}
+	task := taskManager.FindTaskByURL("https://example.com/flaky")
+	// 两次任务重试加上最后一次下载器内部的一次重试
+	if task == nil || task.Status != TaskStatusCompleted || task.RetryCount != 3 || task.Attempts != 3 {
+		t.Errorf("Flaky task = %+v, want completed with 3 retries in 3 attempts", task)
+	}
+
+	sched.Enqueue([]string{"https://example.com/private"}, "Output", "720")
+	stats = sched.Run(context.Background())
+	if stats.Fail != 1 {
+		t.Errorf("Run() stats = %+v, want fail=1", stats)
+	}
+	if len(dl.calls) != 4 {
+		t.Errorf("Downloader called %v, want the unavailable video tried once", dl.calls)
+	}
+	if task := taskManager.FindTaskByURL("https://example.com/private"); task == nil || task.Status != TaskStatusFailed || task.RetryCount != 0 {
+		t.Errorf("Private task = %+v, want failed without retries", task)
+	}
+}
+
+// flakyCollectionDownloader 第一次下载频道时一个视频遇到服务器错误，第二次时之前下载的视频已在索引中
+type flakyCollectionDownloader struct {
+	fakeDownloader
+}
+
+func (f *flakyCollectionDownloader) DownloadContext(ctx context.Context, url, outputDir, resolution string) (*downloader.DownloadResult, error) {
+	f.mutex.Lock()
+	f.calls = append(f.calls, url)
+	calls := len(f.calls)
+	f.mutex.Unlock()
+
+	if calls == 1 {
+		return &downloader.DownloadResult{
+			Error: fmt.Errorf("频道/播放列表中 1/2 个视频下载失败: %w", &downloader.StatusError{StatusCode: 503}),
+			Items: []*downloader.DownloadResult{
+				{Success: true, VideoID: "v1"},
+				{VideoID: "v2", Error: &downloader.StatusError{StatusCode: 503}},
+			},
+		}, nil
+	}
+	return &downloader.DownloadResult{
+		Success: true,
+		Items: []*downloader.DownloadResult{
+			{VideoID: "v1", Error: downloader.ErrAlreadyDownloaded},
+			{Success: true, VideoID: "v2"},
+		},
+	}, nil
+}
+
+func TestSchedulerRetriesFailedCollections(t *testing.T) {
+	taskManager := NewTaskManager(1, "")
+	taskManager.SetRetryPolicy(&downloader.RetryPolicy{
+		MaxAttempts: 3,
+		Backoff:     "constant",
+		BaseDelay:   10 * time.Millisecond,
+		RetryOn:     []string{"network"},
+	})
+	dl := &flakyCollectionDownloader{}
+	sched := NewScheduler(taskManager, dl)
+	sched.Enqueue([]string{"https://example.com/channel"}, "Output", "720")
+
+	// 重试前的结果不计入统计，重试时已下载的视频被跳过
+	stats := sched.Run(context.Background())
+	if len(dl.calls) != 2 || stats.Total != 2 || stats.Success != 1 || stats.Skip != 1 || stats.Fail != 0 {
+		t.Errorf("Run() calls = %d, stats = %+v, want 2 calls with total=2 success=1 skip=1", len(dl.calls), stats)
+	}
+	if task := taskManager.FindTaskByURL("https://example.com/channel"); task == nil || task.Status != TaskStatusCompleted || task.RetryCount != 1 {
+		t.Errorf("Channel task = %+v, want completed after 1 retry", task)
+	}
+}
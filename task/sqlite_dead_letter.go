@@ -0,0 +1,103 @@
+package task
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"batch_download_videos/storage"
+)
+
+// deadLetterSchema 失败记录表，同一URL的音频和视频下载各一行
+// data 保存完整的记录 JSON，其他列用于按错误类别查询
+const deadLetterSchema = `
+CREATE TABLE IF NOT EXISTS dead_letters (
+	url         TEXT NOT NULL,
+	audio       INTEGER NOT NULL DEFAULT 0,
+	error_class TEXT NOT NULL,
+	attempts    INTEGER NOT NULL DEFAULT 0,
+	failed_at   TEXT,
+	data        TEXT NOT NULL,
+	PRIMARY KEY (url, audio)
+);
+CREATE INDEX IF NOT EXISTS idx_dead_letters_class ON dead_letters(error_class, failed_at);
+`
+
+// SQLiteDeadLetterStore 把失败记录保存在 SQLite 数据库的 dead_letters 表中
+type SQLiteDeadLetterStore struct {
+	db *sql.DB
+}
+
+// NewSQLiteDeadLetterStore 在 db 中创建失败记录表，db 由调用方关闭
+func NewSQLiteDeadLetterStore(db *sql.DB) (*SQLiteDeadLetterStore, error) {
+	if _, err := db.Exec(deadLetterSchema); err != nil {
+		return nil, fmt.Errorf("创建失败记录表失败: %w", err)
+	}
+	return &SQLiteDeadLetterStore{db: db}, nil
+}
+
+// Add 记录失败的URL，已有的同一URL的记录被替换
+func (ds *SQLiteDeadLetterStore) Add(letter DeadLetter) error {
+	data, err := json.Marshal(letter)
+	if err != nil {
+		return fmt.Errorf("序列化失败记录失败: %w", err)
+	}
+	_, err = ds.db.Exec(`INSERT INTO dead_letters (url, audio, error_class, attempts, failed_at, data)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(url, audio) DO UPDATE SET
+			error_class = excluded.error_class,
+			attempts = excluded.attempts,
+			failed_at = excluded.failed_at,
+			data = excluded.data`,
+		letter.URL, letter.Options.AudioOnly, letter.ErrorClass, letter.Attempts,
+		storage.FormatTime(letter.FailedAt), string(data))
+	if err != nil {
+		return fmt.Errorf("写入失败记录失败: %w", err)
+	}
+	return nil
+}
+
+// List 返回错误类别属于 classes 的记录，classes 为空时返回全部，按失败时间排序
+func (ds *SQLiteDeadLetterStore) List(classes ...string) ([]DeadLetter, error) {
+	query := "SELECT data FROM dead_letters"
+	args := make([]any, len(classes))
+	if len(classes) > 0 {
+		for i, class := range classes {
+			args[i] = class
+		}
+		query += " WHERE error_class IN (?" + strings.Repeat(", ?", len(classes)-1) + ")"
+	}
+	query += " ORDER BY failed_at, url"
+
+	rows, err := ds.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("查询失败记录失败: %w", err)
+	}
+	defer rows.Close()
+
+	var letters []DeadLetter
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("读取失败记录失败: %w", err)
+		}
+		var letter DeadLetter
+		if err := json.Unmarshal([]byte(data), &letter); err != nil {
+			return nil, fmt.Errorf("解析失败记录失败: %w", err)
+		}
+		letters = append(letters, letter)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("读取失败记录失败: %w", err)
+	}
+	return letters, nil
+}
+
+// Remove 删除URL的记录，记录不存在时不报错
+func (ds *SQLiteDeadLetterStore) Remove(url string, audio bool) error {
+	if _, err := ds.db.Exec("DELETE FROM dead_letters WHERE url = ? AND audio = ?", url, audio); err != nil {
+		return fmt.Errorf("删除失败记录失败: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,304 @@
+package task
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"batch_download_videos/storage"
+	"batch_download_videos/utils"
+)
+
+// sqliteSchema 任务表，按状态、平台和创建时间建立索引
+// data 保存完整的任务 JSON，其他列用于查询和恢复队列顺序
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS download_tasks (
+	id             TEXT PRIMARY KEY,
+	url            TEXT NOT NULL,
+	platform       TEXT NOT NULL DEFAULT '',
+	status         TEXT NOT NULL,
+	created_at     TEXT,
+	started_at     TEXT,
+	completed_at   TEXT,
+	queue_position INTEGER,
+	processing     INTEGER NOT NULL DEFAULT 0,
+	data           TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_download_tasks_status ON download_tasks(status, created_at);
+CREATE INDEX IF NOT EXISTS idx_download_tasks_platform ON download_tasks(platform, created_at);
+CREATE INDEX IF NOT EXISTS idx_download_tasks_created_at ON download_tasks(created_at);
+`
+
+// SQLiteStore 基于嵌入式 SQLite 数据库的存储后端
+// 保存时只写入发生变化的任务，进度更新只更新一行
+type SQLiteStore struct {
+	db    *sql.DB
+	mutex sync.Mutex
+	// saved 上次写入数据库的任务 JSON，用于跳过没有变化的任务
+	saved map[string]string
+	// queue、processing 上次写入数据库的队列，没有变化时不更新
+	queue      []string
+	processing []string
+}
+
+// NewSQLiteStore 在 db 中创建任务表，db 由调用方关闭
+func NewSQLiteStore(db *sql.DB) (*SQLiteStore, error) {
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		return nil, fmt.Errorf("创建任务表失败: %w", err)
+	}
+	return &SQLiteStore{
+		db:    db,
+		saved: make(map[string]string),
+	}, nil
+}
+
+// Load 读取所有任务，按 queue_position 恢复等待队列
+func (ss *SQLiteStore) Load() (*State, error) {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+
+	rows, err := ss.db.Query(`SELECT id, data, queue_position, processing FROM download_tasks
+		ORDER BY queue_position IS NULL, queue_position, created_at, id`)
+	if err != nil {
+		return nil, fmt.Errorf("读取任务数据失败: %w", err)
+	}
+	defer rows.Close()
+
+	state := &State{
+		Tasks:      make(map[string]*DownloadTask),
+		TaskQueue:  make([]string, 0),
+		Processing: make([]string, 0),
+	}
+	saved := make(map[string]string)
+	for rows.Next() {
+		var id, data string
+		var position sql.NullInt64
+		var processing bool
+		if err := rows.Scan(&id, &data, &position, &processing); err != nil {
+			return nil, fmt.Errorf("读取任务数据失败: %w", err)
+		}
+
+		var task DownloadTask
+		if err := json.Unmarshal([]byte(data), &task); err != nil {
+			continue
+		}
+		state.Tasks[id] = &task
+		saved[id] = data
+		if position.Valid {
+			state.TaskQueue = append(state.TaskQueue, id)
+		}
+		if processing {
+			state.Processing = append(state.Processing, id)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("读取任务数据失败: %w", err)
+	}
+
+	ss.saved = saved
+	ss.queue = slices.Clone(state.TaskQueue)
+	ss.processing = slices.Clone(state.Processing)
+	return state, nil
+}
+
+// Save 在一个事务中写入变化的任务、删除已移除的任务，并在队列变化时更新队列顺序
+func (ss *SQLiteStore) Save(state *State) error {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+
+	tx, err := ss.db.Begin()
+	if err != nil {
+		return fmt.Errorf("开始事务失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	saved := make(map[string]string, len(state.Tasks))
+	for id, task := range state.Tasks {
+		data, err := json.Marshal(task)
+		if err != nil {
+			return fmt.Errorf("序列化任务数据失败: %w", err)
+		}
+		saved[id] = string(data)
+		if ss.saved[id] == string(data) {
+			continue
+		}
+		if err := upsertTask(tx, task, string(data)); err != nil {
+			return err
+		}
+	}
+	for id := range ss.saved {
+		if _, exists := saved[id]; exists {
+			continue
+		}
+		if _, err := tx.Exec("DELETE FROM download_tasks WHERE id = ?", id); err != nil {
+			return fmt.Errorf("删除任务失败: %w", err)
+		}
+	}
+
+	queueChanged := !slices.Equal(ss.queue, state.TaskQueue) || !slices.Equal(ss.processing, state.Processing)
+	if queueChanged {
+		if err := saveQueue(tx, state.TaskQueue, state.Processing); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("提交事务失败: %w", err)
+	}
+
+	ss.saved = saved
+	if queueChanged {
+		ss.queue = slices.Clone(state.TaskQueue)
+		ss.processing = slices.Clone(state.Processing)
+	}
+	return nil
+}
+
+// SaveTask 只更新一个任务，不改变队列
+func (ss *SQLiteStore) SaveTask(task *DownloadTask) error {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+
+	data, err := json.Marshal(task)
+	if err != nil {
+		return fmt.Errorf("序列化任务数据失败: %w", err)
+	}
+	if ss.saved[task.ID] == string(data) {
+		return nil
+	}
+	if err := upsertTask(ss.db, task, string(data)); err != nil {
+		return err
+	}
+	ss.saved[task.ID] = string(data)
+	return nil
+}
+
+// Query 按条件查询任务，结果按创建时间排序
+func (ss *SQLiteStore) Query(filter Filter) ([]*DownloadTask, error) {
+	var conditions []string
+	var args []any
+	if filter.Status != "" {
+		conditions = append(conditions, "status = ?")
+		args = append(args, string(filter.Status))
+	}
+	if filter.Platform != "" {
+		conditions = append(conditions, "platform = ?")
+		args = append(args, strings.ToLower(filter.Platform))
+	}
+	if !filter.Since.IsZero() {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, storage.FormatTime(filter.Since))
+	}
+	if !filter.Until.IsZero() {
+		conditions = append(conditions, "created_at < ?")
+		args = append(args, storage.FormatTime(filter.Until))
+	}
+
+	query := "SELECT data FROM download_tasks"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY created_at, id"
+	if filter.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", filter.Limit)
+	}
+
+	rows, err := ss.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("查询任务失败: %w", err)
+	}
+	defer rows.Close()
+
+	var tasks []*DownloadTask
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("读取任务数据失败: %w", err)
+		}
+		var task DownloadTask
+		if err := json.Unmarshal([]byte(data), &task); err != nil {
+			return nil, fmt.Errorf("解析任务数据失败: %w", err)
+		}
+		tasks = append(tasks, &task)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("读取任务数据失败: %w", err)
+	}
+	return tasks, nil
+}
+
+// Count 返回数据库中的任务数
+func (ss *SQLiteStore) Count() (int, error) {
+	var count int
+	if err := ss.db.QueryRow("SELECT COUNT(*) FROM download_tasks").Scan(&count); err != nil {
+		return 0, fmt.Errorf("统计任务失败: %w", err)
+	}
+	return count, nil
+}
+
+// Import 把 src 中的任务和队列导入数据库，用于从文件后端切换到数据库后端，返回导入的任务数
+// 同名任务以 src 为准，等待队列替换为 src 中的队列
+func (ss *SQLiteStore) Import(src Store) (int, error) {
+	state, err := src.Load()
+	if err != nil {
+		return 0, err
+	}
+	if err := ss.Save(state); err != nil {
+		return 0, fmt.Errorf("导入任务失败: %w", err)
+	}
+	return len(state.Tasks), nil
+}
+
+// execer 是 *sql.DB 和 *sql.Tx 共有的方法
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// upsertTask 写入一个任务的查询列和完整 JSON，不改变它在队列中的位置
+func upsertTask(db execer, task *DownloadTask, data string) error {
+	var startedAt, completedAt any
+	if task.StartedAt != nil {
+		startedAt = storage.FormatTime(*task.StartedAt)
+	}
+	if task.CompletedAt != nil {
+		completedAt = storage.FormatTime(*task.CompletedAt)
+	}
+
+	_, err := db.Exec(`INSERT INTO download_tasks (id, url, platform, status, created_at, started_at, completed_at, data)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET
+			url = excluded.url,
+			platform = excluded.platform,
+			status = excluded.status,
+			created_at = excluded.created_at,
+			started_at = excluded.started_at,
+			completed_at = excluded.completed_at,
+			data = excluded.data`,
+		task.ID, task.URL, utils.GetWebsiteType(task.URL), string(task.Status),
+		storage.FormatTime(task.CreatedAt), startedAt, completedAt, data)
+	if err != nil {
+		return fmt.Errorf("写入任务失败: %w", err)
+	}
+	return nil
+}
+
+// saveQueue 重写等待队列的顺序和处理中标记
+func saveQueue(tx *sql.Tx, queue, processing []string) error {
+	if _, err := tx.Exec("UPDATE download_tasks SET queue_position = NULL, processing = 0 WHERE queue_position IS NOT NULL OR processing = 1"); err != nil {
+		return fmt.Errorf("更新任务队列失败: %w", err)
+	}
+	for position, id := range queue {
+		if _, err := tx.Exec("UPDATE download_tasks SET queue_position = ? WHERE id = ?", position, id); err != nil {
+			return fmt.Errorf("更新任务队列失败: %w", err)
+		}
+	}
+	for _, id := range processing {
+		if _, err := tx.Exec("UPDATE download_tasks SET processing = 1 WHERE id = ?", id); err != nil {
+			return fmt.Errorf("更新任务队列失败: %w", err)
+		}
+	}
+	return nil
+}
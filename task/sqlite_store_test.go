@@ -0,0 +1,126 @@
+package task
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"batch_download_videos/storage"
+)
+
+func newTestSQLiteStore(t *testing.T) *SQLiteStore {
+	t.Helper()
+	db, err := storage.OpenSQLite(filepath.Join(t.TempDir(), "downloads.db"))
+	if err != nil {
+		t.Fatalf("OpenSQLite() error = %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	store, err := NewSQLiteStore(db)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore() error = %v", err)
+	}
+	return store
+}
+
+func TestSQLiteStoreSaveLoad(t *testing.T) {
+	store := newTestSQLiteStore(t)
+	taskManager := NewTaskManagerWithStore(3, store)
+
+	first := taskManager.AddTask("https://www.youtube.com/watch?v=first", "Output", "720")
+	second := taskManager.AddTask("https://www.douyin.com/video/123", "Output", "720")
+	third := taskManager.AddTask("https://www.youtube.com/watch?v=third", "Output", "1080")
+	if err := taskManager.StartTask(second.ID); err != nil {
+		t.Fatalf("StartTask() error = %v", err)
+	}
+	if err := taskManager.UpdateTaskProgress(second.ID, 42.5, "1MB/s", "10s"); err != nil {
+		t.Fatalf("UpdateTaskProgress() error = %v", err)
+	}
+
+	loaded := NewTaskManagerWithStore(3, store)
+	if len(loaded.Tasks) != 3 {
+		t.Fatalf("loaded tasks = %d, want 3", len(loaded.Tasks))
+	}
+	if want := []string{first.ID, third.ID}; len(loaded.TaskQueue) != 2 || loaded.TaskQueue[0] != want[0] || loaded.TaskQueue[1] != want[1] {
+		t.Errorf("TaskQueue = %v, want %v", loaded.TaskQueue, want)
+	}
+	if len(loaded.Processing) != 1 || loaded.Processing[0] != second.ID {
+		t.Errorf("Processing = %v, want [%s]", loaded.Processing, second.ID)
+	}
+	if task := loaded.Tasks[second.ID]; task.Progress != 42.5 {
+		t.Errorf("Progress = %v, want 42.5", task.Progress)
+	}
+	if task := loaded.Tasks[third.ID]; task.Resolution != "1080" || task.Status != TaskStatusPending {
+		t.Errorf("loaded task = %+v", task)
+	}
+}
+
+func TestSQLiteStoreQuery(t *testing.T) {
+	store := newTestSQLiteStore(t)
+	taskManager := NewTaskManagerWithStore(3, store)
+
+	youtube := taskManager.AddTask("https://www.youtube.com/watch?v=a", "Output", "720")
+	taskManager.AddTask("https://www.douyin.com/video/123", "Output", "720")
+	taskManager.AddTask("https://www.youtube.com/watch?v=b", "Output", "720")
+	if err := taskManager.StartTask(youtube.ID); err != nil {
+		t.Fatalf("StartTask() error = %v", err)
+	}
+	if err := taskManager.FailTask(youtube.ID, errors.New("network error")); err != nil {
+		t.Fatalf("FailTask() error = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   int
+	}{
+		{"all", Filter{}, 3},
+		{"platform", Filter{Platform: "YouTube"}, 2},
+		{"status", Filter{Status: TaskStatusFailed}, 1},
+		{"status and platform", Filter{Status: TaskStatusPending, Platform: "youtube"}, 1},
+		{"since", Filter{Since: time.Now().Add(-time.Hour)}, 3},
+		{"until", Filter{Until: time.Now().Add(-time.Hour)}, 0},
+		{"limit", Filter{Limit: 2}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tasks, err := taskManager.Query(tt.filter)
+			if err != nil {
+				t.Fatalf("Query() error = %v", err)
+			}
+			if len(tasks) != tt.want {
+				t.Errorf("Query() returned %d tasks, want %d", len(tasks), tt.want)
+			}
+		})
+	}
+
+	failed, _ := taskManager.Query(Filter{Status: TaskStatusFailed})
+	if len(failed) != 1 || failed[0].Error != "network error" {
+		t.Errorf("Query(failed) = %+v", failed)
+	}
+}
+
+func TestSQLiteStoreImport(t *testing.T) {
+	fileStore := NewFileStore(filepath.Join(t.TempDir(), "tasks.json"))
+	fileManager := NewTaskManagerWithStore(3, fileStore)
+	first := fileManager.AddTask("https://www.youtube.com/watch?v=first", "Output", "720")
+	second := fileManager.AddTask("https://www.youtube.com/watch?v=second", "Output", "720")
+
+	store := newTestSQLiteStore(t)
+	imported, err := store.Import(fileStore)
+	if err != nil {
+		t.Fatalf("Import() error = %v", err)
+	}
+	if imported != 2 {
+		t.Errorf("Import() = %d, want 2", imported)
+	}
+	if count, _ := store.Count(); count != 2 {
+		t.Errorf("Count() = %d, want 2", count)
+	}
+
+	loaded := NewTaskManagerWithStore(3, store)
+	if len(loaded.TaskQueue) != 2 || loaded.TaskQueue[0] != first.ID || loaded.TaskQueue[1] != second.ID {
+		t.Errorf("TaskQueue = %v, want [%s %s]", loaded.TaskQueue, first.ID, second.ID)
+	}
+}
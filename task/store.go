@@ -0,0 +1,80 @@
+package task
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"batch_download_videos/utils"
+)
+
+// State 持久化的任务状态
+type State struct {
+	Tasks      map[string]*DownloadTask `json:"tasks"`
+	TaskQueue  []string                 `json:"task_queue"`
+	Processing []string                 `json:"processing"`
+}
+
+// Store 任务状态的存储后端
+// 默认使用 FileStore（JSON 文件），也可以使用 SQLiteStore（嵌入式数据库）
+type Store interface {
+	// Load 返回保存的任务状态，没有保存过时返回空状态
+	Load() (*State, error)
+	// Save 保存全部任务和队列，state 中的任务是不含上下文的副本
+	Save(state *State) error
+	// Query 按条件查询任务，结果按创建时间排序
+	Query(filter Filter) ([]*DownloadTask, error)
+}
+
+// TaskSaver 可以单独保存一个任务的存储后端，进度更新时不必保存全部任务
+type TaskSaver interface {
+	SaveTask(task *DownloadTask) error
+}
+
+// Filter 任务的查询条件，零值字段表示不限制
+type Filter struct {
+	Status   TaskStatus
+	Platform string
+	// Since、Until 任务创建时间范围 [Since, Until)
+	Since time.Time
+	Until time.Time
+	// Limit 最多返回的任务数，0 表示不限制
+	Limit int
+}
+
+// Match 判断任务是否满足查询条件
+func (f Filter) Match(task *DownloadTask) bool {
+	if f.Status != "" && task.Status != f.Status {
+		return false
+	}
+	if f.Platform != "" && !strings.EqualFold(utils.GetWebsiteType(task.URL), f.Platform) {
+		return false
+	}
+	if !f.Since.IsZero() && task.CreatedAt.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !task.CreatedAt.Before(f.Until) {
+		return false
+	}
+	return true
+}
+
+// apply 过滤任务并按创建时间排序
+func (f Filter) apply(tasks []*DownloadTask) []*DownloadTask {
+	matched := make([]*DownloadTask, 0, len(tasks))
+	for _, task := range tasks {
+		if f.Match(task) {
+			matched = append(matched, task)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		if !matched[i].CreatedAt.Equal(matched[j].CreatedAt) {
+			return matched[i].CreatedAt.Before(matched[j].CreatedAt)
+		}
+		return matched[i].ID < matched[j].ID
+	})
+	if f.Limit > 0 && len(matched) > f.Limit {
+		matched = matched[:f.Limit]
+	}
+	return matched
+}
@@ -2,15 +2,14 @@ package task
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"os"
-	"path/filepath"
 	"sync"
 	"time"
 
 	"batch_download_videos/downloader"
 	"batch_download_videos/logger"
+	"batch_download_videos/utils"
 )
 
 // TaskStatus 定义任务状态
@@ -25,12 +24,22 @@ const (
 	TaskStatusCanceled  TaskStatus = "canceled"  // 取消
 )
 
+var (
+	// ErrNoPendingTask 表示任务队列为空
+	ErrNoPendingTask = errors.New("没有待处理的任务")
+	// ErrMaxConcurrent 表示处理中的任务已达到并发上限
+	ErrMaxConcurrent = errors.New("达到最大并发数限制")
+	// ErrRetryWaiting 表示队列中的任务都在等待重试
+	ErrRetryWaiting = errors.New("任务正在等待重试")
+)
+
 // DownloadTask 定义下载任务
 type DownloadTask struct {
 	ID          string          `json:"id"`
 	URL         string          `json:"url"`
 	OutputDir   string          `json:"output_dir"`
 	Resolution  string          `json:"resolution"`
+	Options     downloader.Options `json:"options"`
 	Status      TaskStatus      `json:"status"`
 	Error       string          `json:"error"`
 	Progress    float64         `json:"progress"`
@@ -38,6 +47,9 @@ type DownloadTask struct {
 	ETA         string          `json:"eta"`
 	FileSize    int64           `json:"file_size"`
 	RetryCount  int             `json:"retry_count"`
+	Attempts    int             `json:"attempts,omitempty"`   // 本次排队后任务被执行的次数
+	RetryAt     *time.Time      `json:"retry_at,omitempty"`   // 失败后重新排队的任务在此时间之后才会被领取
+	Downloader  string          `json:"downloader,omitempty"`
 	CreatedAt   time.Time       `json:"created_at"`
 	StartedAt   *time.Time      `json:"started_at"`
 	CompletedAt *time.Time      `json:"completed_at"`
@@ -47,6 +59,33 @@ type DownloadTask struct {
 	Mutex       sync.Mutex      `json:"-"`
 }
 
+// snapshot 返回用于持久化的任务副本，不包含上下文、结果和锁
+func (task *DownloadTask) snapshot() *DownloadTask {
+	task.Mutex.Lock()
+	defer task.Mutex.Unlock()
+	
+	return &DownloadTask{
+		ID:          task.ID,
+		URL:         task.URL,
+		OutputDir:   task.OutputDir,
+		Resolution:  task.Resolution,
+		Options:     task.Options,
+		Status:      task.Status,
+		Error:       task.Error,
+		Progress:    task.Progress,
+		Speed:       task.Speed,
+		ETA:         task.ETA,
+		FileSize:    task.FileSize,
+		RetryCount:  task.RetryCount,
+		Attempts:    task.Attempts,
+		RetryAt:     task.RetryAt,
+		Downloader:  task.Downloader,
+		CreatedAt:   task.CreatedAt,
+		StartedAt:   task.StartedAt,
+		CompletedAt: task.CompletedAt,
+	}
+}
+
 // TaskManager 定义任务管理器
 type TaskManager struct {
 	Tasks      map[string]*DownloadTask `json:"tasks"`
@@ -54,27 +93,68 @@ type TaskManager struct {
 	Processing []string                 `json:"processing"`
 	MaxConcurrent int                   `json:"max_concurrent"`
 	Mutex      sync.RWMutex             `json:"-"`
-	PersistFile string                  `json:"-"`
+	store      Store
+	saveMutex  sync.Mutex
+	retryPolicy *downloader.RetryPolicy // 任务失败后整体重试的策略
 }
 
-// NewTaskManager 创建新的任务管理器
+// NewTaskManager 创建新的任务管理器，任务状态保存到 persistFile，为空时不持久化
 func NewTaskManager(maxConcurrent int, persistFile string) *TaskManager {
-	manager := &TaskManager{
+	if persistFile == "" {
+		return NewTaskManagerWithStore(maxConcurrent, nil)
+	}
+	return NewTaskManagerWithStore(maxConcurrent, NewFileStore(persistFile))
+}
+
+// NewTaskManagerWithStore 创建使用指定存储后端的任务管理器，store 为 nil 时不持久化
+// 加载任务状态失败时只记录警告；加载失败时需要停止运行的调用方使用 OpenTaskManager
+func NewTaskManagerWithStore(maxConcurrent int, store Store) *TaskManager {
+	manager := newTaskManager(maxConcurrent, store)
+	
+	// 尝试加载持久化的任务状态
+	if err := manager.Load(); err != nil {
+		logger.GetLogger().Warn("加载任务状态失败: %v", err)
+	}
+	
+	return manager
+}
+
+// OpenTaskManager 创建使用指定存储后端的任务管理器并加载任务状态
+// 加载失败时返回错误：以空队列继续运行会在下次保存时覆盖已保存的任务
+func OpenTaskManager(maxConcurrent int, store Store) (*TaskManager, error) {
+	manager := newTaskManager(maxConcurrent, store)
+	if err := manager.Load(); err != nil {
+		return nil, fmt.Errorf("加载任务状态失败: %w", err)
+	}
+	return manager, nil
+}
+
+// newTaskManager 创建空的任务管理器
+func newTaskManager(maxConcurrent int, store Store) *TaskManager {
+	return &TaskManager{
 		Tasks:      make(map[string]*DownloadTask),
 		TaskQueue:  make([]string, 0),
 		Processing: make([]string, 0),
 		MaxConcurrent: maxConcurrent,
-		PersistFile: persistFile,
+		store:      store,
 	}
+}
+
+// SetRetryPolicy 设置任务失败后整体重试的策略，为 nil 时失败的任务不再重试
+func (tm *TaskManager) SetRetryPolicy(policy *downloader.RetryPolicy) {
+	tm.Mutex.Lock()
+	defer tm.Mutex.Unlock()
 	
-	// 尝试加载持久化的任务状态
-	manager.Load()
-	
-	return manager
+	tm.retryPolicy = policy
 }
 
 // AddTask 添加新的下载任务
 func (tm *TaskManager) AddTask(url, outputDir, resolution string) *DownloadTask {
+	return tm.AddTaskWithOptions(url, outputDir, resolution, downloader.Options{})
+}
+
+// AddTaskWithOptions 添加带下载选项的下载任务
+func (tm *TaskManager) AddTaskWithOptions(url, outputDir, resolution string, opts downloader.Options) *DownloadTask {
 	tm.Mutex.Lock()
 	defer tm.Mutex.Unlock()
 	
@@ -87,6 +167,7 @@ func (tm *TaskManager) AddTask(url, outputDir, resolution string) *DownloadTask
 		URL:        url,
 		OutputDir:  outputDir,
 		Resolution: resolution,
+		Options:    opts,
 		Status:     TaskStatusPending,
 		Progress:   0,
 		CreatedAt:  time.Now(),
@@ -97,7 +178,7 @@ func (tm *TaskManager) AddTask(url, outputDir, resolution string) *DownloadTask
 	tm.TaskQueue = append(tm.TaskQueue, taskID)
 	
 	// 持久化任务状态
-	tm.Save()
+	tm.saveLocked()
 	
 	logger.GetLogger().Info("添加下载任务: %s (URL: %s)", taskID, url)
 	
@@ -144,7 +225,7 @@ func (tm *TaskManager) StartTask(taskID string) error {
 	tm.Processing = append(tm.Processing, taskID)
 	
 	// 持久化任务状态
-	tm.Save()
+	tm.saveLocked()
 	tm.Mutex.Unlock()
 	
 	logger.GetLogger().Info("开始执行任务: %s", taskID)
@@ -187,7 +268,7 @@ func (tm *TaskManager) PauseTask(taskID string) error {
 	tm.TaskQueue = append(tm.TaskQueue, taskID)
 	
 	// 持久化任务状态
-	tm.Save()
+	tm.saveLocked()
 	
 	logger.GetLogger().Info("暂停任务: %s", taskID)
 	return nil
@@ -234,7 +315,7 @@ func (tm *TaskManager) CancelTask(taskID string) error {
 	}
 	
 	// 持久化任务状态
-	tm.Save()
+	tm.saveLocked()
 	
 	logger.GetLogger().Info("取消任务: %s", taskID)
 	return nil
@@ -258,6 +339,7 @@ func (tm *TaskManager) CompleteTask(taskID string, result *downloader.DownloadRe
 	task.Result = result
 	if result != nil {
 		task.FileSize = result.FileSize
+		task.Downloader = result.Downloader
 	}
 	now := time.Now()
 	task.CompletedAt = &now
@@ -272,7 +354,7 @@ func (tm *TaskManager) CompleteTask(taskID string, result *downloader.DownloadRe
 	}
 	
 	// 持久化任务状态
-	tm.Save()
+	tm.saveLocked()
 	
 	logger.GetLogger().Info("任务完成: %s", taskID)
 	return nil
@@ -308,12 +390,54 @@ func (tm *TaskManager) FailTask(taskID string, err error) error {
 	}
 	
 	// 持久化任务状态
-	tm.Save()
+	tm.saveLocked()
 	
 	logger.GetLogger().Info("任务失败: %s, 错误: %v", taskID, err)
 	return nil
 }
 
+// RetryTask 按重试策略处理失败的任务：错误可以重试且次数未用完时，任务重新排到队尾，
+// 等待策略给出的时间后再被领取，返回 true；否则返回 false，由调用方标记任务失败
+func (tm *TaskManager) RetryTask(taskID string, err error) bool {
+	tm.Mutex.Lock()
+	defer tm.Mutex.Unlock()
+	
+	task, exists := tm.Tasks[taskID]
+	if !exists || tm.retryPolicy == nil {
+		return false
+	}
+	
+	task.Mutex.Lock()
+	delay, ok := tm.retryPolicy.Next(err, task.Attempts)
+	if !ok {
+		task.Mutex.Unlock()
+		return false
+	}
+	if task.CancelFunc != nil {
+		task.CancelFunc()
+	}
+	retryAt := time.Now().Add(delay)
+	task.Status = TaskStatusPending
+	task.Error = err.Error()
+	task.Progress = 0
+	task.Speed = ""
+	task.ETA = ""
+	task.RetryCount++
+	task.RetryAt = &retryAt
+	task.Ctx = nil
+	task.CancelFunc = nil
+	task.Mutex.Unlock()
+	
+	tm.removeFromProcessing(taskID)
+	tm.removeFromQueue(taskID)
+	tm.TaskQueue = append(tm.TaskQueue, taskID)
+	
+	tm.saveLocked()
+	
+	logger.GetLogger().Info("任务将在 %v 后重试: %s, 错误: %v", delay, taskID, err)
+	return true
+}
+
 // UpdateTaskProgress 更新任务进度
 func (tm *TaskManager) UpdateTaskProgress(taskID string, progress float64, speed, eta string) error {
 	tm.Mutex.RLock()
@@ -325,13 +449,19 @@ func (tm *TaskManager) UpdateTaskProgress(taskID string, progress float64, speed
 	}
 	
 	task.Mutex.Lock()
+	previous := task.Progress
 	task.Progress = progress
 	task.Speed = speed
 	task.ETA = eta
 	task.Mutex.Unlock()
 	
-	// 每5%进度持久化一次，避免频繁IO操作
-	if int(progress)%5 == 0 {
+	// 支持单独保存任务的后端每跨过1%只更新这一个任务，
+	// 其他后端每跨过5%保存一次全部任务，避免频繁IO操作
+	if saver, ok := tm.store.(TaskSaver); ok {
+		if int(progress) != int(previous) {
+			saver.SaveTask(task.snapshot())
+		}
+	} else if int(progress)/5 != int(previous)/5 {
 		tm.Save()
 	}
 	
@@ -396,155 +526,355 @@ func (tm *TaskManager) GetProcessingTasks() []*DownloadTask {
 
 // Save 持久化任务状态
 func (tm *TaskManager) Save() error {
-	if tm.PersistFile == "" {
+	tm.Mutex.RLock()
+	defer tm.Mutex.RUnlock()
+	
+	return tm.saveLocked()
+}
+
+// saveLocked 持久化任务状态，调用方必须已持有 tm.Mutex（读锁或写锁）
+func (tm *TaskManager) saveLocked() error {
+	if tm.store == nil {
 		return nil
 	}
 	
-	// 确保持久化文件目录存在
-	dir := filepath.Dir(tm.PersistFile)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return fmt.Errorf("创建目录失败: %w", err)
-	}
+	// 多个读锁持有者可能同时保存，串行化写入
+	tm.saveMutex.Lock()
+	defer tm.saveMutex.Unlock()
 	
 	// 创建一个不包含上下文的任务副本
 	tasksCopy := make(map[string]*DownloadTask)
-	tm.Mutex.RLock()
 	for id, task := range tm.Tasks {
-		taskCopy := *task
-		taskCopy.Ctx = nil
-		taskCopy.CancelFunc = nil
-		taskCopy.Result = nil
-		tasksCopy[id] = &taskCopy
-	}
-	
-	// 保存任务队列和处理中的任务
-	taskQueue := tm.TaskQueue
-	processing := tm.Processing
-	tm.Mutex.RUnlock()
-	
-	// 构建保存数据
-	saveData := map[string]interface{}{
-		"tasks":      tasksCopy,
-		"task_queue": taskQueue,
-		"processing": processing,
-	}
-	
-	// 写入文件
-	data, err := json.MarshalIndent(saveData, "", "  ")
-	if err != nil {
-		return fmt.Errorf("序列化任务数据失败: %w", err)
+		tasksCopy[id] = task.snapshot()
 	}
 	
-	if err := os.WriteFile(tm.PersistFile, data, 0644); err != nil {
-		return fmt.Errorf("写入任务数据失败: %w", err)
-	}
-	
-	return nil
+	// 保存任务、任务队列和处理中的任务
+	return tm.store.Save(&State{
+		Tasks:      tasksCopy,
+		TaskQueue:  tm.TaskQueue,
+		Processing: tm.Processing,
+	})
 }
 
-// Load 加载任务状态
+// Load 从存储后端加载任务状态
 func (tm *TaskManager) Load() error {
-	if tm.PersistFile == "" {
-		return nil
-	}
-	
-	// 检查文件是否存在
-	if _, err := os.Stat(tm.PersistFile); os.IsNotExist(err) {
+	if tm.store == nil {
 		return nil
 	}
 	
-	// 读取文件
-	data, err := os.ReadFile(tm.PersistFile)
+	state, err := tm.store.Load()
 	if err != nil {
-		return fmt.Errorf("读取任务数据失败: %w", err)
+		return err
 	}
 	
-	// 解析数据
-	var loadData map[string]interface{}
-	if err := json.Unmarshal(data, &loadData); err != nil {
-		return fmt.Errorf("解析任务数据失败: %w", err)
-	}
+	tm.Mutex.Lock()
+	defer tm.Mutex.Unlock()
 	
-	// 加载任务
-	if tasksData, ok := loadData["tasks"].(map[string]interface{}); ok {
-		for id, taskData := range tasksData {
-			if taskJSON, err := json.Marshal(taskData); err == nil {
-				var task DownloadTask
-				if err := json.Unmarshal(taskJSON, &task); err == nil {
-					tm.Tasks[id] = &task
-				}
-			}
-		}
+	for id, task := range state.Tasks {
+		tm.Tasks[id] = task
 	}
+	tm.TaskQueue = append(tm.TaskQueue, state.TaskQueue...)
+	tm.Processing = append(tm.Processing, state.Processing...)
 	
-	// 加载任务队列
-	if queueData, ok := loadData["task_queue"].([]interface{}); ok {
-		for _, idData := range queueData {
-			if id, ok := idData.(string); ok {
-				tm.TaskQueue = append(tm.TaskQueue, id)
-			}
-		}
+	if len(state.Tasks) > 0 {
+		logger.GetLogger().Info("加载任务状态: %d 个任务, %d 个等待中, %d 个处理中", 
+			len(tm.Tasks), len(tm.TaskQueue), len(tm.Processing))
 	}
 	
-	// 加载处理中的任务
-	if processingData, ok := loadData["processing"].([]interface{}); ok {
-		for _, idData := range processingData {
-			if id, ok := idData.(string); ok {
-				tm.Processing = append(tm.Processing, id)
-			}
+	return nil
+}
+
+// Query 按条件查询任务，未配置存储后端时查询内存中的任务
+func (tm *TaskManager) Query(filter Filter) ([]*DownloadTask, error) {
+	if tm.store != nil {
+		// 先保存，确保查询结果包含最新的进度
+		if err := tm.Save(); err != nil {
+			return nil, err
 		}
+		return tm.store.Query(filter)
 	}
 	
-	logger.GetLogger().Info("加载任务状态: %d 个任务, %d 个等待中, %d 个处理中", 
-		len(tm.Tasks), len(tm.TaskQueue), len(tm.Processing))
+	tm.Mutex.RLock()
+	tasks := make([]*DownloadTask, 0, len(tm.Tasks))
+	for _, task := range tm.Tasks {
+		tasks = append(tasks, task.snapshot())
+	}
+	tm.Mutex.RUnlock()
 	
-	return nil
+	return filter.apply(tasks), nil
 }
 
 // NextTask 获取下一个待处理的任务
 func (tm *TaskManager) NextTask() (*DownloadTask, error) {
+	return tm.NextTaskContext(context.Background())
+}
+
+// NextTaskContext 获取下一个待处理的任务，任务上下文派生自 parent
+// 取消 parent 会同时取消所有由它派生的任务
+func (tm *TaskManager) NextTaskContext(parent context.Context) (*DownloadTask, error) {
 	tm.Mutex.Lock()
 	defer tm.Mutex.Unlock()
 	
 	if len(tm.TaskQueue) == 0 {
-		return nil, fmt.Errorf("没有待处理的任务")
+		return nil, ErrNoPendingTask
 	}
 	
 	// 检查并发数限制
 	if len(tm.Processing) >= tm.MaxConcurrent {
-		return nil, fmt.Errorf("达到最大并发数限制: %d", tm.MaxConcurrent)
+		return nil, fmt.Errorf("%w: %d", ErrMaxConcurrent, tm.MaxConcurrent)
+	}
+	
+	// 获取第一个未暂停且不在等待重试的任务，暂停的任务需要通过 StartTask 恢复
+	taskID := ""
+	waiting := false
+	now := time.Now()
+	for _, id := range tm.TaskQueue {
+		if task, exists := tm.Tasks[id]; exists {
+			if task.Status == TaskStatusPaused {
+				continue
+			}
+			if task.RetryAt != nil && task.RetryAt.After(now) {
+				waiting = true
+				continue
+			}
+		}
+		taskID = id
+		break
+	}
+	if taskID == "" {
+		if waiting {
+			return nil, ErrRetryWaiting
+		}
+		return nil, ErrNoPendingTask
 	}
 	
-	// 获取第一个任务
-	taskID := tm.TaskQueue[0]
 	task, exists := tm.Tasks[taskID]
 	if !exists {
 		// 任务不存在，从队列中移除
-		tm.TaskQueue = tm.TaskQueue[1:]
-		tm.Save()
+		tm.removeFromQueue(taskID)
+		tm.saveLocked()
 		return nil, fmt.Errorf("任务不存在: %s", taskID)
 	}
 	
 	// 创建任务上下文
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := context.WithCancel(parent)
 	task.Ctx = ctx
 	task.CancelFunc = cancel
 	
 	// 更新任务状态
 	task.Mutex.Lock()
 	task.Status = TaskStatusDownloading
-	now := time.Now()
 	task.StartedAt = &now
+	task.RetryAt = nil
+	task.Attempts++
 	task.Mutex.Unlock()
 	
 	// 将任务从队列移到处理中
-	tm.TaskQueue = tm.TaskQueue[1:]
+	tm.removeFromQueue(taskID)
 	tm.Processing = append(tm.Processing, taskID)
 	
 	// 持久化任务状态
-	tm.Save()
+	tm.saveLocked()
 	
 	logger.GetLogger().Info("开始处理任务: %s (URL: %s)", taskID, task.URL)
 	
 	return task, nil
 }
+
+// FindTaskByURL 查找指定URL最近创建的任务
+func (tm *TaskManager) FindTaskByURL(url string) *DownloadTask {
+	return tm.findTask(url, nil)
+}
+
+// findTask 查找URL对应的最新任务，match 不为空时只考虑满足条件的任务
+func (tm *TaskManager) findTask(url string, match func(task *DownloadTask) bool) *DownloadTask {
+	tm.Mutex.RLock()
+	defer tm.Mutex.RUnlock()
+	
+	var found *DownloadTask
+	for _, task := range tm.Tasks {
+		if task.URL != url {
+			continue
+		}
+		if match != nil && !match(task) {
+			continue
+		}
+		if found == nil || task.CreatedAt.After(found.CreatedAt) {
+			found = task
+		}
+	}
+	
+	return found
+}
+
+// EnqueueURL 将URL加入任务队列
+// 已存在的等待中、处理中、暂停或已完成的任务不会重复添加；失败或取消的任务会被重新排队
+// 返回的布尔值表示队列是否发生了变化
+func (tm *TaskManager) EnqueueURL(url, outputDir, resolution string) (*DownloadTask, bool) {
+	return tm.EnqueueURLWithOptions(url, outputDir, resolution, downloader.Options{})
+}
+
+// EnqueueURLWithOptions 将带下载选项的URL加入任务队列
+// 同一URL的音频和视频下载是不同的任务；重新排队的任务使用新的选项
+// 已完成的播放列表和频道任务也会重新排队，每次运行时同步新增的视频
+func (tm *TaskManager) EnqueueURLWithOptions(url, outputDir, resolution string, opts downloader.Options) (*DownloadTask, bool) {
+	existing := tm.findTask(url, func(task *DownloadTask) bool {
+		return task.Options.AudioOnly == opts.AudioOnly
+	})
+	if existing == nil {
+		return tm.AddTaskWithOptions(url, outputDir, resolution, opts), true
+	}
+	
+	existing.Mutex.Lock()
+	status := existing.Status
+	existing.Mutex.Unlock()
+	
+	resync := status == TaskStatusCompleted && utils.MatchURL(url).Kind.IsCollection()
+	if status != TaskStatusFailed && status != TaskStatusCanceled && !resync {
+		return existing, false
+	}
+	
+	existing.Mutex.Lock()
+	existing.Options = opts
+	existing.Mutex.Unlock()
+	
+	if err := tm.RequeueTask(existing.ID); err != nil {
+		logger.GetLogger().Warn("重新排队任务失败: %v", err)
+		return existing, false
+	}
+	return existing, true
+}
+
+// RequeueCompleted 将URL已完成的任务重新排队，audioOnly 区分同一URL的音频和视频任务
+// 用于 verify --fix 删除失效的索引记录后重新下载，否则URL文件中的URL会因任务已完成而被跳过
+// 返回是否有任务重新排队
+func (tm *TaskManager) RequeueCompleted(url string, audioOnly bool) bool {
+	existing := tm.findTask(url, func(task *DownloadTask) bool {
+		task.Mutex.Lock()
+		defer task.Mutex.Unlock()
+		return task.Options.AudioOnly == audioOnly && task.Status == TaskStatusCompleted
+	})
+	if existing == nil {
+		return false
+	}
+	
+	if err := tm.RequeueTask(existing.ID); err != nil {
+		logger.GetLogger().Warn("重新排队任务失败: %v", err)
+		return false
+	}
+	return true
+}
+
+// RequeueTask 将任务重置为等待中并放回队列，重试次数清零
+// 用于URL文件或 retry-failed 命令中再次出现的失败/取消的任务
+func (tm *TaskManager) RequeueTask(taskID string) error {
+	return tm.requeue(taskID, true)
+}
+
+// ReturnTask 将程序退出时被中断的任务放回队首，下次运行时继续
+// 重试次数保持不变，被中断的这次执行不计入尝试次数，任务重试策略的次数上限跨运行有效
+func (tm *TaskManager) ReturnTask(taskID string) error {
+	return tm.requeue(taskID, false)
+}
+
+// requeue 将任务重置为等待中并放回队首，reset 为 true 时清零重试次数
+func (tm *TaskManager) requeue(taskID string, reset bool) error {
+	tm.Mutex.Lock()
+	defer tm.Mutex.Unlock()
+	
+	task, exists := tm.Tasks[taskID]
+	if !exists {
+		return fmt.Errorf("任务不存在: %s", taskID)
+	}
+	
+	if task.CancelFunc != nil {
+		task.CancelFunc()
+	}
+	
+	task.Mutex.Lock()
+	task.Status = TaskStatusPending
+	task.Error = ""
+	task.Progress = 0
+	task.Speed = ""
+	task.ETA = ""
+	task.StartedAt = nil
+	task.CompletedAt = nil
+	if reset {
+		task.RetryCount = 0
+		task.Attempts = 0
+	} else if task.Attempts > 0 {
+		task.Attempts--
+	}
+	task.RetryAt = nil
+	task.Ctx = nil
+	task.CancelFunc = nil
+	task.Mutex.Unlock()
+	
+	tm.removeFromProcessing(taskID)
+	tm.removeFromQueue(taskID)
+	// 放回队首，保证中断的任务优先恢复
+	tm.TaskQueue = append([]string{taskID}, tm.TaskQueue...)
+	
+	tm.saveLocked()
+	
+	logger.GetLogger().Info("任务重新排队: %s", taskID)
+	return nil
+}
+
+// RecoverProcessing 将上次运行中断时仍处于处理中的任务放回队首
+// 与 ReturnTask 一样保留重试次数，被中断的执行不计入尝试次数
+// 返回恢复的任务数
+func (tm *TaskManager) RecoverProcessing() int {
+	tm.Mutex.Lock()
+	defer tm.Mutex.Unlock()
+	
+	if len(tm.Processing) == 0 {
+		return 0
+	}
+	
+	recovered := make([]string, 0, len(tm.Processing))
+	for _, taskID := range tm.Processing {
+		task, exists := tm.Tasks[taskID]
+		if !exists {
+			continue
+		}
+		task.Mutex.Lock()
+		task.Status = TaskStatusPending
+		task.Progress = 0
+		task.StartedAt = nil
+		if task.Attempts > 0 {
+			task.Attempts--
+		}
+		task.Mutex.Unlock()
+		tm.removeFromQueue(taskID)
+		recovered = append(recovered, taskID)
+	}
+	
+	tm.TaskQueue = append(recovered, tm.TaskQueue...)
+	tm.Processing = make([]string, 0)
+	
+	tm.saveLocked()
+	
+	logger.GetLogger().Info("恢复 %d 个中断的任务", len(recovered))
+	return len(recovered)
+}
+
+// removeFromQueue 从等待队列中移除任务，调用方必须持有写锁
+func (tm *TaskManager) removeFromQueue(taskID string) {
+	for i, id := range tm.TaskQueue {
+		if id == taskID {
+			tm.TaskQueue = append(tm.TaskQueue[:i], tm.TaskQueue[i+1:]...)
+			return
+		}
+	}
+}
+
+// removeFromProcessing 从处理中列表移除任务，调用方必须持有写锁
+func (tm *TaskManager) removeFromProcessing(taskID string) {
+	for i, id := range tm.Processing {
+		if id == taskID {
+			tm.Processing = append(tm.Processing[:i], tm.Processing[i+1:]...)
+			return
+		}
+	}
+}
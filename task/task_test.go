@@ -2,7 +2,11 @@ package task
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
+
+	"batch_download_videos/downloader"
 )
 
 func TestNewTaskManager(t *testing.T) {
@@ -293,10 +297,8 @@ func TestTaskManagerNextTask(t *testing.T) {
 }
 
 // TestTaskManagerSaveLoad 测试任务保存和加载
-// 注意：由于锁的问题，这个测试暂时注释掉
-/*
 func TestTaskManagerSaveLoad(t *testing.T) {
-	tempFile := fmt.Sprintf("test_tasks_%d.json", time.Now().UnixNano())
+	tempFile := filepath.Join(t.TempDir(), "tasks.json")
 	taskManager1 := NewTaskManager(3, tempFile)
 
 	// Add a task
@@ -314,5 +316,180 @@ func TestTaskManagerSaveLoad(t *testing.T) {
 	if len(taskManager2.Tasks) != 1 {
 		t.Errorf("Tasks length after Load = %d, want 1", len(taskManager2.Tasks))
 	}
+
+	// 保存通过临时文件替换任务文件，完成后不留下临时文件
+	entries, err := os.ReadDir(filepath.Dir(tempFile))
+	if err != nil || len(entries) != 1 || entries[0].Name() != "tasks.json" {
+		t.Errorf("Task file directory = %v, %v, want only tasks.json", entries, err)
+	}
+}
+
+func TestOpenTaskManagerLoadError(t *testing.T) {
+	tempFile := filepath.Join(t.TempDir(), "tasks.json")
+	if err := os.WriteFile(tempFile, []byte("{not json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := OpenTaskManager(3, NewFileStore(tempFile)); err == nil {
+		t.Fatal("OpenTaskManager() error = nil, want load error")
+	}
+	// 加载失败时不能保存空队列覆盖原任务文件
+	if data, _ := os.ReadFile(tempFile); string(data) != "{not json" {
+		t.Errorf("task file = %q, want untouched", data)
+	}
+
+	taskManager, err := OpenTaskManager(3, NewFileStore(filepath.Join(t.TempDir(), "missing.json")))
+	if err != nil || len(taskManager.Tasks) != 0 {
+		t.Errorf("OpenTaskManager() missing file = %v, %v, want empty manager", taskManager, err)
+	}
+}
+
+func TestTaskManagerRecoverProcessing(t *testing.T) {
+	tempFile := filepath.Join(t.TempDir(), "tasks.json")
+	taskManager1 := NewTaskManager(3, tempFile)
+
+	taskManager1.AddTask("https://www.youtube.com/watch?v=test1", "Output", "720")
+	taskManager1.AddTask("https://www.youtube.com/watch?v=test2", "Output", "720")
+
+	// 模拟运行中崩溃：第一个任务处于处理中
+	running, err := taskManager1.NextTask()
+	if err != nil {
+		t.Fatalf("NextTask() failed: %v", err)
+	}
+
+	taskManager2 := NewTaskManager(3, tempFile)
+	if recovered := taskManager2.RecoverProcessing(); recovered != 1 {
+		t.Errorf("RecoverProcessing() = %d, want 1", recovered)
+	}
+
+	if len(taskManager2.Processing) != 0 {
+		t.Errorf("Processing length after RecoverProcessing = %d, want 0", len(taskManager2.Processing))
+	}
+
+	if len(taskManager2.TaskQueue) != 2 || taskManager2.TaskQueue[0] != running.ID {
+		t.Errorf("Task queue after RecoverProcessing = %v, want %s first", taskManager2.TaskQueue, running.ID)
+	}
+
+	if status := taskManager2.Tasks[running.ID].Status; status != TaskStatusPending {
+		t.Errorf("Recovered task Status = %q, want %q", status, TaskStatusPending)
+	}
+}
+
+func TestTaskManagerKeepsRetryCountsAcrossRuns(t *testing.T) {
+	tempFile := filepath.Join(t.TempDir(), "tasks.json")
+	taskManager1 := NewTaskManager(3, tempFile)
+	url := "https://www.youtube.com/watch?v=test1"
+	task := taskManager1.AddTask(url, "Output", "720")
+
+	// 已经按任务重试策略重试过两次，第三次执行时程序崩溃
+	task.RetryCount, task.Attempts = 2, 2
+	if _, err := taskManager1.NextTask(); err != nil {
+		t.Fatalf("NextTask() failed: %v", err)
+	}
+
+	taskManager2 := NewTaskManager(3, tempFile)
+	taskManager2.RecoverProcessing()
+	recovered := taskManager2.Tasks[task.ID]
+	if recovered.RetryCount != 2 || recovered.Attempts != 2 {
+		t.Errorf("Recovered task RetryCount = %d, Attempts = %d, want 2, 2", recovered.RetryCount, recovered.Attempts)
+	}
+
+	// 程序退出时归还的任务同样保留重试次数
+	if _, err := taskManager2.NextTask(); err != nil {
+		t.Fatalf("NextTask() failed: %v", err)
+	}
+	if err := taskManager2.ReturnTask(task.ID); err != nil {
+		t.Fatalf("ReturnTask() failed: %v", err)
+	}
+	if recovered.RetryCount != 2 || recovered.Attempts != 2 {
+		t.Errorf("Returned task RetryCount = %d, Attempts = %d, want 2, 2", recovered.RetryCount, recovered.Attempts)
+	}
+
+	// URL文件中再次出现失败的URL时重新计数
+	if _, err := taskManager2.NextTask(); err != nil {
+		t.Fatalf("NextTask() failed: %v", err)
+	}
+	taskManager2.FailTask(task.ID, fmt.Errorf("network error"))
+	if _, ok := taskManager2.EnqueueURL(url, "Output", "720"); !ok {
+		t.Fatal("EnqueueURL() did not requeue the failed task")
+	}
+	if recovered.RetryCount != 0 || recovered.Attempts != 0 {
+		t.Errorf("Re-enqueued task RetryCount = %d, Attempts = %d, want 0, 0", recovered.RetryCount, recovered.Attempts)
+	}
+}
+
+func TestTaskManagerEnqueueURL(t *testing.T) {
+	taskManager := NewTaskManager(3, "")
+
+	task, added := taskManager.EnqueueURL("https://www.youtube.com/watch?v=test", "Output", "720")
+	if !added {
+		t.Fatal("EnqueueURL() should add a new task")
+	}
+
+	if _, added := taskManager.EnqueueURL("https://www.youtube.com/watch?v=test", "Output", "720"); added {
+		t.Error("EnqueueURL() should not add a duplicate pending task")
+	}
+
+	taskManager.NextTask()
+	taskManager.FailTask(task.ID, fmt.Errorf("network error"))
+
+	if _, added := taskManager.EnqueueURL("https://www.youtube.com/watch?v=test", "Output", "720"); !added {
+		t.Error("EnqueueURL() should requeue a failed task")
+	}
+
+	if len(taskManager.Tasks) != 1 {
+		t.Errorf("Tasks length = %d, want 1", len(taskManager.Tasks))
+	}
+
+	if task.Status != TaskStatusPending {
+		t.Errorf("Requeued task Status = %q, want %q", task.Status, TaskStatusPending)
+	}
+}
+
+func TestTaskManagerEnqueueURLWithOptions(t *testing.T) {
+	taskManager := NewTaskManager(3, "")
+	url := "https://www.youtube.com/watch?v=test"
+
+	video, _ := taskManager.EnqueueURL(url, "Output", "720")
+	audio, added := taskManager.EnqueueURLWithOptions(url, "Output", "720", downloader.Options{AudioOnly: true, AudioFormat: "mp3"})
+	if !added {
+		t.Fatal("EnqueueURLWithOptions() should add an audio task for a URL queued as video")
+	}
+	if audio.ID == video.ID {
+		t.Error("Audio and video tasks should be different")
+	}
+	if audio.Options.AudioFormat != "mp3" {
+		t.Errorf("Task Options.AudioFormat = %q, want %q", audio.Options.AudioFormat, "mp3")
+	}
+
+	if _, added := taskManager.EnqueueURLWithOptions(url, "Output", "720", downloader.Options{AudioOnly: true}); added {
+		t.Error("EnqueueURLWithOptions() should not add a duplicate audio task")
+	}
+
+	if len(taskManager.Tasks) != 2 {
+		t.Errorf("Tasks length = %d, want 2", len(taskManager.Tasks))
+	}
+}
+
+func TestTaskManagerEnqueueURLResyncsCollections(t *testing.T) {
+	taskManager := NewTaskManager(3, "")
+	channel := "https://www.youtube.com/@someone"
+	video := "https://www.youtube.com/watch?v=test"
+
+	for _, url := range []string{channel, video} {
+		task, _ := taskManager.EnqueueURL(url, "Output", "720")
+		taskManager.NextTask()
+		taskManager.CompleteTask(task.ID, nil)
+	}
+
+	// 已完成的频道重新排队以同步新增的视频，已完成的单个视频不再下载
+	if _, added := taskManager.EnqueueURL(channel, "Output", "720"); !added {
+		t.Error("EnqueueURL() should requeue a completed channel task")
+	}
+	if _, added := taskManager.EnqueueURL(video, "Output", "720"); added {
+		t.Error("EnqueueURL() should not requeue a completed video task")
+	}
+	if len(taskManager.TaskQueue) != 1 {
+		t.Errorf("Task queue length = %d, want 1", len(taskManager.TaskQueue))
+	}
 }
-*/
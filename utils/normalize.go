@@ -0,0 +1,83 @@
+package utils
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// NormalizedURL 规范化后的URL
+type NormalizedURL struct {
+	// URL 规范形式，同一视频的不同写法得到相同的URL
+	URL string
+	// Platform 平台名称，与 MatchURL 一致
+	Platform string
+	// ID 视频ID，频道、播放列表或无法识别的URL为空
+	ID string
+	// Kind 内容类型
+	Kind ContentKind
+}
+
+// Key 返回稳定的去重键：能识别视频ID时为 "platform:id"，否则为规范URL
+func (n NormalizedURL) Key() string {
+	if n.ID == "" {
+		return n.URL
+	}
+	return n.Platform + ":" + n.ID
+}
+
+// trackingParams 不影响内容的分享、统计参数，规范化时去掉
+var trackingParams = map[string]bool{
+	"si": true, "feature": true, "pp": true, "fbclid": true, "gclid": true,
+	"share_source": true, "share_medium": true, "spm_id_from": true, "vd_source": true,
+	"is_from_webapp": true, "sender_device": true, "igsh": true, "igshid": true,
+}
+
+// NormalizeURL 把URL规范化：去掉首尾空白、片段和分享参数，统一协议和主机名，
+// 并把各平台同一视频的不同写法（例如 youtu.be/X、youtube.com/shorts/X、watch?v=X&list=...）映射为同一个规范URL
+func NormalizeURL(rawURL string) (NormalizedURL, error) {
+	rawURL = strings.TrimSpace(rawURL)
+	if err := ValidateURL(rawURL); err != nil {
+		return NormalizedURL{}, err
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return NormalizedURL{}, fmt.Errorf("URL格式无效: %w", err)
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	if u.Scheme == "http" {
+		u.Scheme = "https"
+	}
+	u.Host = strings.ToLower(u.Host)
+	u.Fragment = ""
+	u.RawFragment = ""
+	if len(u.Path) > 1 {
+		u.Path = strings.TrimRight(u.Path, "/")
+		u.RawPath = ""
+	}
+
+	match := matchParsedURL(u)
+	normalized := NormalizedURL{URL: match.Canonical, Platform: match.Platform, Kind: match.Kind}
+	// 只有单个视频才以视频ID作为去重键
+	if !match.Kind.IsCollection() {
+		normalized.ID = match.ID
+	}
+
+	if normalized.URL == "" {
+		stripTrackingParams(u)
+		normalized.URL = u.String()
+	}
+	return normalized, nil
+}
+
+// stripTrackingParams 去掉统计参数（utm_* 等），其余参数按名称排序
+func stripTrackingParams(u *url.URL) {
+	query := u.Query()
+	for name := range query {
+		if trackingParams[strings.ToLower(name)] || strings.HasPrefix(strings.ToLower(name), "utm_") {
+			query.Del(name)
+		}
+	}
+	u.RawQuery = query.Encode()
+}
@@ -0,0 +1,48 @@
+package utils
+
+import "testing"
+
+func TestNormalizeURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		url     string
+		wantURL string
+		wantKey string
+	}{
+		{"YouTube watch", "https://www.youtube.com/watch?v=dQw4w9WgXcQ", "https://www.youtube.com/watch?v=dQw4w9WgXcQ", "youtube:dQw4w9WgXcQ"},
+		{"YouTube shorts with si", "  https://youtube.com/shorts/dQw4w9WgXcQ?si=abc123  ", "https://www.youtube.com/watch?v=dQw4w9WgXcQ", "youtube:dQw4w9WgXcQ"},
+		{"youtu.be", "https://youtu.be/dQw4w9WgXcQ?t=42", "https://www.youtube.com/watch?v=dQw4w9WgXcQ", "youtube:dQw4w9WgXcQ"},
+		{"watch with list", "https://m.youtube.com/watch?v=dQw4w9WgXcQ&list=PL123&index=2", "https://www.youtube.com/watch?v=dQw4w9WgXcQ", "youtube:dQw4w9WgXcQ"},
+		{"YouTube embed over http", "http://www.youtube.com/embed/dQw4w9WgXcQ", "https://www.youtube.com/watch?v=dQw4w9WgXcQ", "youtube:dQw4w9WgXcQ"},
+		{"YouTube playlist", "https://www.youtube.com/playlist?list=PL123&si=x", "https://www.youtube.com/playlist?list=PL123", "https://www.youtube.com/playlist?list=PL123"},
+		{"YouTube channel", "https://youtube.com/@someone/videos/?si=x", "https://www.youtube.com/@someone/videos", "https://www.youtube.com/@someone/videos"},
+		{"TikTok", "https://www.tiktok.com/@user/video/7001234567890?is_from_webapp=1", "https://www.tiktok.com/@user/video/7001234567890", "tiktok:7001234567890"},
+		{"Douyin video", "https://www.douyin.com/video/7301234567890/", "https://www.douyin.com/video/7301234567890", "douyin:7301234567890"},
+		{"Douyin modal", "https://www.douyin.com/user/MS4wLjAB?modal_id=7301234567890", "https://www.douyin.com/video/7301234567890", "douyin:7301234567890"},
+		{"Bilibili", "https://www.bilibili.com/video/BV1xx411c7mD/?spm_id_from=333", "https://www.bilibili.com/video/BV1xx411c7mD", "bilibili:BV1xx411c7mD"},
+		{"Bilibili page", "https://www.bilibili.com/video/BV1xx411c7mD?p=2", "https://www.bilibili.com/video/BV1xx411c7mD?p=2", "bilibili:BV1xx411c7mD_p2"},
+		{"Vimeo player", "https://player.vimeo.com/video/76979871", "https://vimeo.com/76979871", "vimeo:76979871"},
+		{"Twitter", "https://twitter.com/user/status/123456?s=20", "https://x.com/user/status/123456", "twitter:123456"},
+		{"Instagram reel", "https://www.instagram.com/reel/Cabc_123/?igsh=xyz", "https://www.instagram.com/reel/Cabc_123", "instagram:Cabc_123"},
+		{"Unknown", "https://Example.com/video/1?utm_source=x&id=2#top", "https://example.com/video/1?id=2", "https://example.com/video/1?id=2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			normalized, err := NormalizeURL(tt.url)
+			if err != nil {
+				t.Fatalf("NormalizeURL(%q) error = %v", tt.url, err)
+			}
+			if normalized.URL != tt.wantURL {
+				t.Errorf("NormalizeURL(%q).URL = %q, want %q", tt.url, normalized.URL, tt.wantURL)
+			}
+			if normalized.Key() != tt.wantKey {
+				t.Errorf("NormalizeURL(%q).Key() = %q, want %q", tt.url, normalized.Key(), tt.wantKey)
+			}
+		})
+	}
+
+	if _, err := NormalizeURL("not a url"); err == nil {
+		t.Error("NormalizeURL(\"not a url\") error = nil, want error")
+	}
+}
@@ -0,0 +1,321 @@
+package utils
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// ContentKind URL指向的内容类型
+type ContentKind string
+
+const (
+	KindUnknown  ContentKind = ""         // 无法识别
+	KindVideo    ContentKind = "video"    // 单个视频
+	KindShort    ContentKind = "short"    // 短视频（YouTube Shorts、Instagram Reels 等）
+	KindLive     ContentKind = "live"     // 直播
+	KindPlaylist ContentKind = "playlist" // 播放列表
+	KindChannel  ContentKind = "channel"  // 频道或用户主页
+)
+
+// IsCollection 判断是否为包含多个视频的频道或播放列表
+func (kind ContentKind) IsCollection() bool {
+	return kind == KindPlaylist || kind == KindChannel
+}
+
+// URLMatch 平台匹配结果
+type URLMatch struct {
+	// Platform 平台名称，无法识别时为 "unknown"
+	Platform string
+	Kind     ContentKind
+	// ID 视频ID；播放列表为列表ID，频道为频道ID或用户名；无法识别时为空
+	ID string
+	// Canonical 规范URL，为空时由 NormalizeURL 去掉分享参数后使用原URL
+	Canonical string
+}
+
+// PlatformMatcher 一个平台的URL匹配规则
+type PlatformMatcher struct {
+	Platform string
+	// Hosts 平台的域名，同时匹配它们的子域名，例如 youtube.com 也匹配 m.youtube.com
+	Hosts []string
+	// Match 根据路径和参数识别内容类型、ID和规范URL，返回值的 Platform 字段会被忽略
+	Match func(u *url.URL) URLMatch
+}
+
+// matchesHost 判断主机名是否属于该平台
+func (m PlatformMatcher) matchesHost(host string) bool {
+	for _, h := range m.Hosts {
+		if host == h || strings.HasSuffix(host, "."+h) {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	platformMutex    sync.RWMutex
+	platformMatchers []PlatformMatcher
+)
+
+// RegisterPlatform 注册平台匹配规则，后注册的规则优先
+func RegisterPlatform(matcher PlatformMatcher) {
+	platformMutex.Lock()
+	defer platformMutex.Unlock()
+
+	platformMatchers = append([]PlatformMatcher{matcher}, platformMatchers...)
+}
+
+// MatchURL 按主机名查找平台，再按路径识别内容类型和ID
+// 没有匹配的平台时 Platform 为 "unknown"，按通用规则识别频道和播放列表
+func MatchURL(rawURL string) URLMatch {
+	u, err := parseLooseURL(rawURL)
+	if err != nil {
+		return URLMatch{Platform: "unknown"}
+	}
+	return matchParsedURL(u)
+}
+
+// matchParsedURL 匹配已解析的URL，主机名需已转换为小写
+func matchParsedURL(u *url.URL) URLMatch {
+	host := u.Hostname()
+
+	platformMutex.RLock()
+	defer platformMutex.RUnlock()
+
+	for _, matcher := range platformMatchers {
+		if !matcher.matchesHost(host) {
+			continue
+		}
+		match := matcher.Match(u)
+		match.Platform = matcher.Platform
+		return match
+	}
+
+	match := matchGeneric(u)
+	match.Platform = "unknown"
+	return match
+}
+
+// parseLooseURL 解析URL，缺少协议时按 https 解析，主机名转换为小写
+func parseLooseURL(rawURL string) (*url.URL, error) {
+	rawURL = strings.TrimSpace(rawURL)
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "https://" + rawURL
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	u.Host = strings.ToLower(u.Host)
+	return u, nil
+}
+
+// pathSegments 返回去掉首尾斜杠后的路径分段
+func pathSegments(u *url.URL) []string {
+	path := strings.Trim(u.Path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+var (
+	youtubeIDPattern  = regexp.MustCompile(`^[A-Za-z0-9_-]{11}$`)
+	numericIDPattern  = regexp.MustCompile(`^[0-9]+$`)
+	bilibiliIDPattern = regexp.MustCompile(`^(?i:BV[0-9A-Za-z]{10}|av[0-9]+)$`)
+	shortcodePattern  = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+)
+
+func init() {
+	RegisterPlatform(PlatformMatcher{Platform: "facebook", Hosts: []string{"facebook.com", "fb.watch"}, Match: matchFacebook})
+	RegisterPlatform(PlatformMatcher{Platform: "twitter", Hosts: []string{"twitter.com", "x.com"}, Match: matchTwitter})
+	RegisterPlatform(PlatformMatcher{Platform: "instagram", Hosts: []string{"instagram.com"}, Match: matchInstagram})
+	RegisterPlatform(PlatformMatcher{Platform: "vimeo", Hosts: []string{"vimeo.com"}, Match: matchVimeo})
+	RegisterPlatform(PlatformMatcher{Platform: "tiktok", Hosts: []string{"tiktok.com"}, Match: matchTikTok})
+	RegisterPlatform(PlatformMatcher{Platform: "bilibili", Hosts: []string{"bilibili.com", "b23.tv"}, Match: matchBilibili})
+	RegisterPlatform(PlatformMatcher{Platform: "weibo", Hosts: []string{"weibo.com", "weibo.cn"}, Match: matchWeibo})
+	RegisterPlatform(PlatformMatcher{Platform: "douyin", Hosts: []string{"douyin.com", "iesdouyin.com"}, Match: matchDouyin})
+	RegisterPlatform(PlatformMatcher{Platform: "youtube", Hosts: []string{"youtube.com", "youtu.be", "youtube-nocookie.com"}, Match: matchYouTube})
+}
+
+// matchGeneric 未知平台的通用规则：带 list 参数的是播放列表，/@name、/channel/、/c/、/user/ 是频道
+func matchGeneric(u *url.URL) URLMatch {
+	if u.Query().Get("list") != "" {
+		return URLMatch{Kind: KindPlaylist, ID: u.Query().Get("list")}
+	}
+	segments := pathSegments(u)
+	if len(segments) > 0 && strings.HasPrefix(segments[0], "@") {
+		return URLMatch{Kind: KindChannel, ID: segments[0]}
+	}
+	if len(segments) > 1 && (segments[0] == "channel" || segments[0] == "c" || segments[0] == "user") {
+		return URLMatch{Kind: KindChannel, ID: segments[1]}
+	}
+	return URLMatch{}
+}
+
+// matchYouTube 识别 watch、shorts、live、embed、youtu.be、播放列表和频道链接
+// 单个视频统一为 watch?v=ID，watch 链接中的 list、index、t 等参数会被去掉，只有 /playlist?list=X 才是播放列表
+func matchYouTube(u *url.URL) URLMatch {
+	segments := pathSegments(u)
+
+	kind, id := KindUnknown, ""
+	switch {
+	case u.Hostname() == "youtu.be" && len(segments) > 0:
+		kind, id = KindVideo, segments[0]
+	case u.Path == "/watch":
+		kind, id = KindVideo, u.Query().Get("v")
+	case len(segments) == 2 && segments[0] == "shorts":
+		kind, id = KindShort, segments[1]
+	case len(segments) == 2 && segments[0] == "live":
+		kind, id = KindLive, segments[1]
+	case len(segments) == 2 && (segments[0] == "embed" || segments[0] == "v"):
+		kind, id = KindVideo, segments[1]
+	case len(segments) == 1 && segments[0] == "playlist" && u.Query().Get("list") != "":
+		list := u.Query().Get("list")
+		return URLMatch{Kind: KindPlaylist, ID: list, Canonical: "https://www.youtube.com/playlist?list=" + url.QueryEscape(list)}
+	case len(segments) > 0 && strings.HasPrefix(segments[0], "@"):
+		return URLMatch{Kind: KindChannel, ID: segments[0], Canonical: "https://www.youtube.com" + strings.TrimRight(u.EscapedPath(), "/")}
+	case len(segments) > 1 && (segments[0] == "channel" || segments[0] == "c" || segments[0] == "user"):
+		return URLMatch{Kind: KindChannel, ID: segments[1], Canonical: "https://www.youtube.com" + strings.TrimRight(u.EscapedPath(), "/")}
+	}
+
+	if kind == KindUnknown || !youtubeIDPattern.MatchString(id) {
+		return URLMatch{}
+	}
+	return URLMatch{Kind: kind, ID: id, Canonical: "https://www.youtube.com/watch?v=" + id}
+}
+
+// matchDouyin 识别 /video/ID、/note/ID、带 modal_id 的链接（在用户主页中打开的视频）和 /user/ 用户主页
+func matchDouyin(u *url.URL) URLMatch {
+	segments := pathSegments(u)
+
+	id := u.Query().Get("modal_id")
+	if len(segments) == 2 && (segments[0] == "video" || segments[0] == "note") {
+		id = segments[1]
+	}
+	if numericIDPattern.MatchString(id) {
+		return URLMatch{Kind: KindVideo, ID: id, Canonical: "https://www.douyin.com/video/" + id}
+	}
+	if len(segments) == 2 && segments[0] == "user" {
+		return URLMatch{Kind: KindChannel, ID: segments[1]}
+	}
+	return URLMatch{}
+}
+
+// matchBilibili 识别 /video/BV...（多P视频的 p 参数保留，ID 与 yt-dlp 一致，例如 BVxxx_p2）、
+// space.bilibili.com 用户空间和 live.bilibili.com 直播间
+func matchBilibili(u *url.URL) URLMatch {
+	segments := pathSegments(u)
+
+	switch u.Hostname() {
+	case "space.bilibili.com":
+		if len(segments) > 0 && numericIDPattern.MatchString(segments[0]) {
+			return URLMatch{Kind: KindChannel, ID: segments[0], Canonical: "https://space.bilibili.com/" + segments[0]}
+		}
+		return URLMatch{}
+	case "live.bilibili.com":
+		if len(segments) == 1 && numericIDPattern.MatchString(segments[0]) {
+			return URLMatch{Kind: KindLive, ID: segments[0], Canonical: "https://live.bilibili.com/" + segments[0]}
+		}
+		return URLMatch{}
+	}
+
+	if len(segments) != 2 || segments[0] != "video" || !bilibiliIDPattern.MatchString(segments[1]) {
+		return URLMatch{}
+	}
+	id := segments[1]
+	canonical := "https://www.bilibili.com/video/" + id
+	if page := u.Query().Get("p"); numericIDPattern.MatchString(page) && page != "1" {
+		canonical += "?p=" + page
+		id += "_p" + page
+	}
+	return URLMatch{Kind: KindVideo, ID: id, Canonical: canonical}
+}
+
+// matchWeibo 微博只识别平台，内容类型交给 yt-dlp 判断
+func matchWeibo(u *url.URL) URLMatch {
+	segments := pathSegments(u)
+	if len(segments) == 3 && segments[0] == "tv" && segments[1] == "show" {
+		return URLMatch{Kind: KindVideo, ID: segments[2]}
+	}
+	return URLMatch{}
+}
+
+// matchTikTok 识别 /@user/video/ID 和 /@user 用户主页，vm.tiktok.com 短链接无法离线识别
+func matchTikTok(u *url.URL) URLMatch {
+	segments := pathSegments(u)
+	if len(segments) == 0 || !strings.HasPrefix(segments[0], "@") {
+		return URLMatch{}
+	}
+	if len(segments) == 3 && segments[1] == "video" && numericIDPattern.MatchString(segments[2]) {
+		return URLMatch{Kind: KindVideo, ID: segments[2], Canonical: "https://www.tiktok.com/" + strings.Join(segments, "/")}
+	}
+	if len(segments) == 1 {
+		return URLMatch{Kind: KindChannel, ID: segments[0], Canonical: "https://www.tiktok.com/" + segments[0]}
+	}
+	return URLMatch{}
+}
+
+// matchVimeo 识别 vimeo.com/ID、player.vimeo.com/video/ID、频道和合集
+func matchVimeo(u *url.URL) URLMatch {
+	segments := pathSegments(u)
+	if u.Hostname() == "player.vimeo.com" && len(segments) == 2 && segments[0] == "video" {
+		segments = segments[1:]
+	}
+
+	switch {
+	case len(segments) == 1 && numericIDPattern.MatchString(segments[0]):
+		return URLMatch{Kind: KindVideo, ID: segments[0], Canonical: "https://vimeo.com/" + segments[0]}
+	case len(segments) == 2 && (segments[0] == "channels" || segments[0] == "user"):
+		return URLMatch{Kind: KindChannel, ID: segments[1]}
+	case len(segments) == 2 && (segments[0] == "showcase" || segments[0] == "album"):
+		return URLMatch{Kind: KindPlaylist, ID: segments[1]}
+	}
+	return URLMatch{}
+}
+
+// matchTwitter 识别 /user/status/ID 和用户主页，规范URL统一使用 x.com
+func matchTwitter(u *url.URL) URLMatch {
+	segments := pathSegments(u)
+	if len(segments) >= 3 && segments[1] == "status" && numericIDPattern.MatchString(segments[2]) {
+		return URLMatch{Kind: KindVideo, ID: segments[2], Canonical: "https://x.com/" + strings.Join(segments[:3], "/")}
+	}
+	if len(segments) == 1 && segments[0] != "home" && segments[0] != "i" && segments[0] != "search" {
+		return URLMatch{Kind: KindChannel, ID: segments[0]}
+	}
+	return URLMatch{}
+}
+
+// matchInstagram 识别帖子（/p/）、Reels（/reel/）、IGTV（/tv/）和用户主页
+func matchInstagram(u *url.URL) URLMatch {
+	segments := pathSegments(u)
+	if len(segments) == 2 && shortcodePattern.MatchString(segments[1]) {
+		switch segments[0] {
+		case "p", "tv":
+			return URLMatch{Kind: KindVideo, ID: segments[1], Canonical: "https://www.instagram.com/" + strings.Join(segments, "/")}
+		case "reel", "reels":
+			return URLMatch{Kind: KindShort, ID: segments[1], Canonical: "https://www.instagram.com/" + strings.Join(segments, "/")}
+		}
+	}
+	if len(segments) == 1 && shortcodePattern.MatchString(segments[0]) {
+		return URLMatch{Kind: KindChannel, ID: segments[0]}
+	}
+	return URLMatch{}
+}
+
+// matchFacebook 识别 /watch?v=ID、/reel/ID 和 /user/videos/ID
+func matchFacebook(u *url.URL) URLMatch {
+	segments := pathSegments(u)
+	switch {
+	case u.Path == "/watch" && numericIDPattern.MatchString(u.Query().Get("v")):
+		id := u.Query().Get("v")
+		return URLMatch{Kind: KindVideo, ID: id, Canonical: "https://www.facebook.com/watch?v=" + id}
+	case len(segments) == 2 && segments[0] == "reel" && numericIDPattern.MatchString(segments[1]):
+		return URLMatch{Kind: KindShort, ID: segments[1], Canonical: "https://www.facebook.com/reel/" + segments[1]}
+	case len(segments) == 3 && segments[1] == "videos" && numericIDPattern.MatchString(segments[2]):
+		return URLMatch{Kind: KindVideo, ID: segments[2]}
+	}
+	return URLMatch{}
+}
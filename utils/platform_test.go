@@ -0,0 +1,77 @@
+package utils
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestMatchURL(t *testing.T) {
+	tests := []struct {
+		url      string
+		platform string
+		kind     ContentKind
+		id       string
+	}{
+		{"https://www.youtube.com/watch?v=dQw4w9WgXcQ&list=PL123", "youtube", KindVideo, "dQw4w9WgXcQ"},
+		{"https://youtube.com/shorts/dQw4w9WgXcQ", "youtube", KindShort, "dQw4w9WgXcQ"},
+		{"https://www.youtube.com/live/dQw4w9WgXcQ", "youtube", KindLive, "dQw4w9WgXcQ"},
+		{"https://youtu.be/dQw4w9WgXcQ", "youtube", KindVideo, "dQw4w9WgXcQ"},
+		{"https://www.youtube.com/playlist?list=PL123", "youtube", KindPlaylist, "PL123"},
+		{"https://www.youtube.com/@someone/videos", "youtube", KindChannel, "@someone"},
+		{"https://www.youtube.com/channel/UC123", "youtube", KindChannel, "UC123"},
+		{"https://www.youtube.com/feed/subscriptions", "youtube", KindUnknown, ""},
+		{"https://www.tiktok.com/@user/video/7001", "tiktok", KindVideo, "7001"},
+		{"https://www.tiktok.com/@user", "tiktok", KindChannel, "@user"},
+		{"https://www.douyin.com/video/7301", "douyin", KindVideo, "7301"},
+		{"https://www.douyin.com/user/MS4wLjAB?modal_id=7301", "douyin", KindVideo, "7301"},
+		{"https://www.douyin.com/user/MS4wLjAB", "douyin", KindChannel, "MS4wLjAB"},
+		{"https://space.bilibili.com/12345", "bilibili", KindChannel, "12345"},
+		{"https://live.bilibili.com/678", "bilibili", KindLive, "678"},
+		{"https://vimeo.com/showcase/99", "vimeo", KindPlaylist, "99"},
+		{"https://x.com/user/status/123", "twitter", KindVideo, "123"},
+		{"https://twitter.com/user", "twitter", KindChannel, "user"},
+		{"https://www.instagram.com/reel/Cabc", "instagram", KindShort, "Cabc"},
+		{"https://www.facebook.com/watch?v=555", "facebook", KindVideo, "555"},
+		{"https://box.com/s/abc", "unknown", KindUnknown, ""},
+		{"https://example.com/watch?v=1&list=abc", "unknown", KindPlaylist, "abc"},
+		{"https://example.com/@someone", "unknown", KindChannel, "@someone"},
+		{"www.youtube.com/watch?v=dQw4w9WgXcQ", "youtube", KindVideo, "dQw4w9WgXcQ"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			match := MatchURL(tt.url)
+			if match.Platform != tt.platform || match.Kind != tt.kind || match.ID != tt.id {
+				t.Errorf("MatchURL(%q) = {%s %q %s}, want {%s %q %s}",
+					tt.url, match.Platform, match.Kind, match.ID, tt.platform, tt.kind, tt.id)
+			}
+		})
+	}
+}
+
+func TestRegisterPlatform(t *testing.T) {
+	platformMutex.Lock()
+	saved := platformMatchers
+	platformMutex.Unlock()
+	defer func() {
+		platformMutex.Lock()
+		platformMatchers = saved
+		platformMutex.Unlock()
+	}()
+
+	RegisterPlatform(PlatformMatcher{
+		Platform: "example",
+		Hosts:    []string{"example.com"},
+		Match: func(u *url.URL) URLMatch {
+			return URLMatch{Kind: KindVideo, ID: u.Query().Get("id")}
+		},
+	})
+
+	match := MatchURL("https://video.example.com/play?id=42")
+	if match.Platform != "example" || match.Kind != KindVideo || match.ID != "42" {
+		t.Errorf("MatchURL() = %+v, want example video 42", match)
+	}
+	if GetWebsiteType("https://notexample.com/") != "unknown" {
+		t.Error("matcher for example.com should not match notexample.com")
+	}
+}
@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"context"
 	"fmt"
 	"net/url"
 	"os"
@@ -9,49 +10,116 @@ import (
 	"time"
 )
 
+// GetWebsiteType 返回URL所属的平台名称，无法识别时返回 "unknown"
 func GetWebsiteType(url string) string {
-	if strings.Contains(url, "youtube.com") || strings.Contains(url, "youtu.be") {
-		return "youtube"
-	}
-	if strings.Contains(url, "douyin.com") {
-		return "douyin"
+	return MatchURL(url).Platform
+}
+
+func GetQualityFormat(resolution string) string {
+	return GetQualityFormatWithPreference(resolution, FormatPreference{})
+}
+
+// FormatPreference 定义格式选择的偏好
+type FormatPreference struct {
+	// Codecs 按优先级排列的视频编码，例如 avc1、vp9、av01
+	Codecs []string
+	// Containers 按优先级排列的容器格式，例如 mp4、webm
+	Containers []string
+	// MaxBitrate 视频比特率上限（kbps），0 表示不限制
+	MaxBitrate int
+	// MuxedOnly 只选择音视频合一的格式，没有 ffmpeg 无法合并时使用
+	MuxedOnly bool
+}
+
+// GetQualityFormatWithPreference 生成 yt-dlp 的 -f 格式选择字符串
+// 按编码、容器的优先级依次尝试，都没有匹配时退回到只限制分辨率的格式
+func GetQualityFormatWithPreference(resolution string, pref FormatPreference) string {
+	height := "720"
+	switch resolution {
+	case "2160", "4k":
+		height = "2160"
+	case "1440", "2k":
+		height = "1440"
+	case "1080", "hd1080":
+		height = "1080"
+	case "720", "hd720":
+		height = "720"
+	case "480", "medium":
+		height = "480"
+	case "360", "small":
+		height = "360"
 	}
-	if strings.Contains(url, "weibo.com") {
-		return "weibo"
+
+	codecs := pref.Codecs
+	if len(codecs) == 0 {
+		codecs = []string{""}
 	}
-	if strings.Contains(url, "bilibili.com") {
-		return "bilibili"
+	containers := pref.Containers
+	if len(containers) == 0 {
+		containers = []string{""}
 	}
-	if strings.Contains(url, "tiktok.com") {
-		return "tiktok"
+	bitrate := ""
+	if pref.MaxBitrate > 0 {
+		bitrate = fmt.Sprintf("[tbr<=%d]", pref.MaxBitrate)
 	}
-	if strings.Contains(url, "vimeo.com") {
-		return "vimeo"
+
+	var selectors []string
+	add := func(selector string) {
+		for _, existing := range selectors {
+			if existing == selector {
+				return
+			}
+		}
+		selectors = append(selectors, selector)
 	}
-	if strings.Contains(url, "instagram.com") {
-		return "instagram"
+
+	for _, codec := range codecs {
+		for _, container := range containers {
+			filter := fmt.Sprintf("[height<=%s]", height)
+			if codec != "" {
+				filter += fmt.Sprintf("[vcodec^=%s]", codec)
+			}
+			if container != "" {
+				filter += fmt.Sprintf("[ext=%s]", container)
+			}
+			filter += bitrate
+
+			if pref.MuxedOnly {
+				add("best" + filter)
+				continue
+			}
+			// 优先选择与视频容器匹配的音频，合并时不需要转换容器
+			if ext := audioExtForContainer(container); ext != "" {
+				add(fmt.Sprintf("bestvideo%s+bestaudio[ext=%s]", filter, ext))
+			}
+			add(fmt.Sprintf("bestvideo%s+bestaudio", filter))
+		}
 	}
-	if strings.Contains(url, "twitter.com") || strings.Contains(url, "x.com") {
-		return "twitter"
+
+	// 退回到只限制分辨率的格式
+	if !pref.MuxedOnly {
+		if bitrate != "" {
+			add(fmt.Sprintf("bestvideo[height<=%s]%s+bestaudio", height, bitrate))
+		}
+		add(fmt.Sprintf("bestvideo[height<=%s]+bestaudio", height))
 	}
-	if strings.Contains(url, "facebook.com") {
-		return "facebook"
+	if bitrate != "" {
+		add(fmt.Sprintf("best[height<=%s]%s", height, bitrate))
 	}
-	return "unknown"
+	add(fmt.Sprintf("best[height<=%s]", height))
+
+	return strings.Join(selectors, "/")
 }
 
-func GetQualityFormat(resolution string) string {
-	switch resolution {
-	case "1080", "hd1080":
-		return "bestvideo[height<=1080]+bestaudio/best[height<=1080]"
-	case "720", "hd720":
-		return "bestvideo[height<=720]+bestaudio/best[height<=720]"
-	case "480", "medium":
-		return "bestvideo[height<=480]+bestaudio/best[height<=480]"
-	case "360", "small":
-		return "bestvideo[height<=360]+bestaudio/best[height<=360]"
+// audioExtForContainer 返回与视频容器匹配的音频扩展名，未知容器返回空字符串
+func audioExtForContainer(container string) string {
+	switch container {
+	case "mp4":
+		return "m4a"
+	case "webm":
+		return "webm"
 	default:
-		return "bestvideo[height<=720]+bestaudio/best[height<=720]"
+		return ""
 	}
 }
 
@@ -236,3 +304,19 @@ func CleanupTempFilesRecursive(dir string) error {
 
 	return nil
 }
+
+// SleepContext 等待指定时长，ctx 被取消时提前返回 ctx.Err()
+func SleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
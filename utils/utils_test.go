@@ -1,7 +1,10 @@
 package utils
 
 import (
+	"context"
+	"errors"
 	"testing"
+	"time"
 )
 
 func TestGetWebsiteType(t *testing.T) {
@@ -22,6 +25,9 @@ func TestGetWebsiteType(t *testing.T) {
 		{"X.com", "https://x.com/user/status/test", "twitter"},
 		{"Facebook", "https://www.facebook.com/watch?v=test", "facebook"},
 		{"Unknown", "https://unknown.com/video", "unknown"},
+		{"Box is not X", "https://app.box.com/s/abc", "unknown"},
+		{"Max is not X", "https://play.max.com/video/watch/1", "unknown"},
+		{"YouTube in query", "https://example.com/?ref=youtube.com", "unknown"},
 	}
 
 	for _, tt := range tests {
@@ -134,3 +140,60 @@ func TestTruncateString(t *testing.T) {
 		})
 	}
 }
+
+func TestGetQualityFormatWithPreference(t *testing.T) {
+	tests := []struct {
+		name     string
+		res      string
+		pref     FormatPreference
+		expected string
+	}{
+		{
+			"no preference",
+			"1080",
+			FormatPreference{},
+			"bestvideo[height<=1080]+bestaudio/best[height<=1080]",
+		},
+		{
+			"codec and container",
+			"1080",
+			FormatPreference{Codecs: []string{"avc1"}, Containers: []string{"mp4"}},
+			"bestvideo[height<=1080][vcodec^=avc1][ext=mp4]+bestaudio[ext=m4a]/bestvideo[height<=1080][vcodec^=avc1][ext=mp4]+bestaudio/bestvideo[height<=1080]+bestaudio/best[height<=1080]",
+		},
+		{
+			"max bitrate",
+			"720",
+			FormatPreference{MaxBitrate: 2000},
+			"bestvideo[height<=720][tbr<=2000]+bestaudio/bestvideo[height<=720]+bestaudio/best[height<=720][tbr<=2000]/best[height<=720]",
+		},
+		{
+			"muxed only",
+			"2160",
+			FormatPreference{Codecs: []string{"vp9", "avc1"}, MuxedOnly: true},
+			"best[height<=2160][vcodec^=vp9]/best[height<=2160][vcodec^=avc1]/best[height<=2160]",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := GetQualityFormatWithPreference(tt.res, tt.pref)
+			if result != tt.expected {
+				t.Errorf("GetQualityFormatWithPreference(%q) = %q, want %q", tt.res, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSleepContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	start := time.Now()
+	err := SleepContext(ctx, time.Minute)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("SleepContext() error = %v, want %v", err, context.Canceled)
+	}
+	if time.Since(start) > time.Second {
+		t.Error("SleepContext() should return immediately when ctx is canceled")
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"batch_download_videos/config"
+	"batch_download_videos/indexer"
+	"batch_download_videos/logger"
+	"batch_download_videos/task"
+)
+
+// runVerify 执行 verify 子命令：检查索引中的记录是否都有完整的文件，并列出没有索引记录的文件
+// 使用 --fix 时删除失效的记录，并把这些视频已完成的任务重新排队，下次运行会重新下载这些视频
+func runVerify(cfg *config.Config, idx *indexer.Indexer, taskStore task.Store, args []string) error {
+	flags := flag.NewFlagSet("verify", flag.ContinueOnError)
+	fix := flags.Bool("fix", false, "删除失效的索引记录，下次运行时重新下载")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	report, err := indexer.Verify(idx.Records(), verifyDirs(cfg))
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("检查了 %d 条索引记录\n", report.Checked)
+	for _, issue := range report.Issues {
+		fmt.Println("  " + issue.String())
+	}
+	if len(report.Orphans) > 0 {
+		fmt.Printf("%d 个文件没有索引记录:\n", len(report.Orphans))
+		for _, orphan := range report.Orphans {
+			fmt.Println("  " + orphan)
+		}
+	}
+
+	if len(report.Issues) == 0 {
+		fmt.Println("索引中的记录都有完整的文件")
+		return nil
+	}
+	if !*fix {
+		fmt.Printf("发现 %d 条有问题的记录，使用 verify --fix 修复\n", len(report.Issues))
+		return nil
+	}
+
+	removed, err := idx.Fix(report)
+	if err != nil {
+		return fmt.Errorf("修复索引失败: %w", err)
+	}
+	if err := idx.Save(); err != nil {
+		return fmt.Errorf("保存索引失败: %w", err)
+	}
+	requeued, err := requeueStale(cfg, taskStore, report)
+	if err != nil {
+		return fmt.Errorf("重新排队任务失败: %w", err)
+	}
+	logger.GetLogger().Info("索引修复完成: 删除 %d 条失效记录，更新 %d 条记录的文件路径，重新排队 %d 个任务",
+		removed, len(report.Issues)-removed, requeued)
+	fmt.Printf("已删除 %d 条失效记录，下次运行时会重新下载\n", removed)
+	return nil
+}
+
+// requeueStale 把失效记录的来源URL对应的已完成任务重新排队，返回重新排队的任务数
+// 已完成的任务不会因为URL文件中再次出现而重新排队，不重新排队的话删除记录后也不会重新下载
+func requeueStale(cfg *config.Config, taskStore task.Store, report *indexer.VerifyReport) (int, error) {
+	tm, err := task.OpenTaskManager(cfg.MaxConcurrency, taskStore)
+	if err != nil {
+		return 0, err
+	}
+
+	requeued := 0
+	for _, issue := range report.Issues {
+		if !issue.Stale() || issue.Record.SourceURL == "" {
+			continue
+		}
+		if tm.RequeueCompleted(issue.Record.SourceURL, indexer.IsAudioKey(issue.Record.ID)) {
+			requeued++
+		}
+	}
+	return requeued, nil
+}
+
+// verifyDirs 返回需要扫描的目录：默认输出目录和各平台的输出目录
+func verifyDirs(cfg *config.Config) []string {
+	dirs := []string{cfg.DefaultOutputDir}
+	for _, dir := range cfg.PlatformOutputDirs {
+		dirs = append(dirs, dir)
+	}
+	return dirs
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"batch_download_videos/config"
+	"batch_download_videos/downloader"
+	"batch_download_videos/indexer"
+	"batch_download_videos/task"
+)
+
+func TestRunVerifyFixRequeuesStaleTasks(t *testing.T) {
+	outputDir := t.TempDir()
+	cfg := config.DefaultConfig()
+	cfg.DefaultOutputDir = outputDir
+	cfg.PlatformOutputDirs = nil
+
+	const videoURL = "https://www.youtube.com/watch?v=dQw4w9WgXcQ"
+	idx := indexer.NewIndexerWithStore(indexer.NewFileStore(filepath.Join(outputDir, indexer.IndexFileName)))
+	// 记录的文件已被删除
+	if err := idx.AddRecord(indexer.Record{
+		ID:           "dQw4w9WgXcQ",
+		SourceURL:    videoURL,
+		FilePath:     filepath.Join(outputDir, "deleted_dQw4w9WgXcQ.mp4"),
+		DownloadedAt: time.Now(),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	taskStore := task.NewFileStore(filepath.Join(outputDir, "tasks.json"))
+	tm := task.NewTaskManagerWithStore(1, taskStore)
+	audioTask := tm.AddTaskWithOptions(videoURL, outputDir, "720", downloader.Options{AudioOnly: true})
+	videoTask := tm.AddTask(videoURL, outputDir, "720")
+	for _, id := range []string{audioTask.ID, videoTask.ID} {
+		if err := tm.StartTask(id); err != nil {
+			t.Fatal(err)
+		}
+		if err := tm.CompleteTask(id, &downloader.DownloadResult{Success: true}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := runVerify(cfg, idx, taskStore, []string{"--fix"}); err != nil {
+		t.Fatalf("runVerify() error = %v", err)
+	}
+	if idx.IsDownloaded("dQw4w9WgXcQ") {
+		t.Error("stale record should have been removed")
+	}
+
+	// 下次运行时URL文件中的URL重新加入队列，视频任务重新下载，音频任务保持完成
+	next, err := task.OpenTaskManager(1, taskStore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next.EnqueueURL(videoURL, outputDir, "720")
+	pending := next.GetPendingTasks()
+	if len(pending) != 1 || pending[0].ID != videoTask.ID {
+		t.Fatalf("pending tasks = %+v, want the video task requeued", pending)
+	}
+	if got, _ := next.GetTask(audioTask.ID); got.Status != task.TaskStatusCompleted {
+		t.Errorf("audio task status = %s, want completed", got.Status)
+	}
+}